@@ -1,9 +1,12 @@
 package main
 
 import (
+	"gocalc/internal/calculator"
 	"gocalc/internal/grpc"
 	pb "gocalc/proto"
 	"log"
+	"math"
+	"math/big"
 	"os"
 	"strconv"
 	"sync"
@@ -21,6 +24,7 @@ var (
 	TIME_MULTIPLICATIONS_MS int
 	TIME_DIVISIONS_MS       int
 	COMPUTING_POWER         int
+	CANCEL_CHECK_MS         int // Период проверки отмены выражения выполняемой задачи, 0 - не проверять
 )
 
 func loadConfig() {
@@ -56,6 +60,11 @@ func loadConfig() {
 	if err != nil {
 		log.Fatal("Invalid COMPUTING_POWER")
 	}
+
+	CANCEL_CHECK_MS, err = strconv.Atoi(getEnvOrDefault("CANCEL_CHECK_MS", "200"))
+	if err != nil {
+		log.Fatal("Invalid CANCEL_CHECK_MS")
+	}
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -146,13 +155,41 @@ func processTaskGRPC(client *grpc.CalculatorClient, workerID int, agentID string
 	log.Printf("Worker %d (агент %s): Получена задача: ID=%s, операция=%s, время=%d мс, arg1=%f, arg2=%f",
 		workerID, agentID, task.Id, task.Operation, task.OperationTime, task.Arg1, task.Arg2)
 
-	result := calculateResultWithTime(task.Operation, task.Arg1, task.Arg2, int(task.OperationTime))
+	cancelled, stopWatching := watchCancellation(client, task.Id)
+	defer stopWatching()
+
+	var result float64
+	var decimalResult string
+	var tensorResult *calculator.Tensor
+	switch {
+	case task.Arg1Tensor != nil || task.Arg2Tensor != nil:
+		tensorResult = calculateTensorResultWithTime(task, int(task.OperationTime), cancelled)
+		result = tensorResult.Value()
+	case task.Precision == calculator.PrecisionDecimal:
+		decimalResult, result = calculateDecimalResultWithTime(task, int(task.OperationTime), cancelled)
+	case task.Precision == calculator.PrecisionInterval:
+		decimalResult, result = calculateIntervalResultWithTime(task, int(task.OperationTime), cancelled)
+	default:
+		result = calculateResultWithTime(task.Operation, task.Arg1, task.Arg2, task.Args, int(task.OperationTime), cancelled)
+	}
+
+	select {
+	case <-cancelled:
+		log.Printf("Worker %d (агент %s): Выражение задачи %s отменено, результат не отправляется",
+			workerID, agentID, task.Id)
+		return
+	default:
+	}
 
-	log.Printf("Worker %d (агент %s): Завершено вычисление для задачи %s, результат: %f",
-		workerID, agentID, task.Id, result)
+	log.Printf("Worker %d (агент %s): Завершено вычисление для задачи %s, результат: %f %s",
+		workerID, agentID, task.Id, result, decimalResult)
 
 	for retry := 0; retry < maxRetries; retry++ {
-		err = client.SubmitTaskResult(task.Id, result)
+		if tensorResult != nil {
+			err = client.SubmitTensorTaskResult(task.Id, *tensorResult)
+		} else {
+			err = client.SubmitDecimalTaskResult(task.Id, result, decimalResult)
+		}
 
 		if err == nil {
 			log.Printf("Worker %d (агент %s): Результат для задачи %s успешно отправлен",
@@ -174,6 +211,44 @@ func processTaskGRPC(client *grpc.CalculatorClient, workerID int, agentID string
 	}
 }
 
+// watchCancellation раз в CANCEL_CHECK_MS спрашивает оркестратор, нужен ли ещё результат
+// задачи. Возвращённый канал закрывается, когда выражение задачи отменено или завершено;
+// stop прекращает проверки
+func watchCancellation(client *grpc.CalculatorClient, taskID string) (cancelled <-chan struct{}, stop func()) {
+	if CANCEL_CHECK_MS <= 0 {
+		return nil, func() {}
+	}
+
+	done := make(chan struct{})
+	cancelledCh := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Duration(CANCEL_CHECK_MS) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if isCancelled, err := client.TaskCancelled(taskID); err == nil && isCancelled {
+					close(cancelledCh)
+					return
+				}
+			}
+		}
+	}()
+	return cancelledCh, func() { close(done) }
+}
+
+// emulateDelay имитирует время вычисления операции; ожидание прерывается отменой выражения
+func emulateDelay(delay time.Duration, cancelled <-chan struct{}) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-cancelled:
+	}
+}
+
 // calculateResult вычисляет результат операции с симуляцией задержки
 func calculateResult(operation string, arg1, arg2 float64) float64 {
 	var delay time.Duration
@@ -215,23 +290,139 @@ func calculateResult(operation string, arg1, arg2 float64) float64 {
 }
 
 // calculateResultWithTime вычисляет результат с указанной задержкой в миллисекундах
-func calculateResultWithTime(operation string, arg1, arg2 float64, operationTimeMs int) float64 {
+func calculateResultWithTime(operation string, arg1, arg2 float64, args []float64, operationTimeMs int, cancelled <-chan struct{}) float64 {
 	delay := time.Duration(operationTimeMs) * time.Millisecond
 
-	log.Printf("НАЧАЛО выполнения операции %s: %f %s %f с задержкой %d мс",
-		operation, arg1, operation, arg2, operationTimeMs)
+	if calculator.IsFunction(operation) {
+		log.Printf("НАЧАЛО выполнения функции %s%v с задержкой %d мс", operation, args, operationTimeMs)
+	} else {
+		log.Printf("НАЧАЛО выполнения операции %s: %f %s %f с задержкой %d мс",
+			operation, arg1, operation, arg2, operationTimeMs)
+	}
 
 	startTime := time.Now()
-	time.Sleep(delay)
+	emulateDelay(delay, cancelled)
 	elapsedTime := time.Since(startTime)
 	log.Printf("ЗАВЕРШЕНИЕ операции %s: результат = %f, выполнялось %v",
-		operation, getOperationResult(operation, arg1, arg2), elapsedTime)
+		operation, getOperationResult(operation, arg1, arg2, args), elapsedTime)
+
+	return getOperationResult(operation, arg1, arg2, args)
+}
 
-	return getOperationResult(operation, arg1, arg2)
+// calculateDecimalResultWithTime вычисляет задачу в точном режиме с указанной задержкой.
+// Возвращает точный результат и его приближённое значение
+func calculateDecimalResultWithTime(task *pb.Task, operationTimeMs int, cancelled <-chan struct{}) (string, float64) {
+	log.Printf("НАЧАЛО выполнения точной операции %s: %s %s %v с задержкой %d мс",
+		task.Operation, task.Arg1Decimal, task.Arg2Decimal, task.ArgsDecimal, operationTimeMs)
+
+	emulateDelay(time.Duration(operationTimeMs)*time.Millisecond, cancelled)
+
+	result, err := getDecimalOperationResult(task)
+	if err != nil {
+		log.Printf("Ошибка точного вычисления операции %s: %v", task.Operation, err)
+		return "0", 0
+	}
+
+	approx, _ := result.Float64()
+	log.Printf("ЗАВЕРШЕНИЕ точной операции %s: результат = %s", task.Operation, calculator.FormatDecimal(result))
+	return calculator.FormatDecimal(result), approx
 }
 
-func getOperationResult(operation string, arg1, arg2 float64) float64 {
+// calculateIntervalResultWithTime вычисляет задачу в режиме interval с указанной задержкой.
+// Возвращает интервал-результат текстом и его середину
+func calculateIntervalResultWithTime(task *pb.Task, operationTimeMs int, cancelled <-chan struct{}) (string, float64) {
+	log.Printf("НАЧАЛО выполнения интервальной операции %s: %s %s %v с задержкой %d мс",
+		task.Operation, task.Arg1Decimal, task.Arg2Decimal, task.ArgsDecimal, operationTimeMs)
+
+	emulateDelay(time.Duration(operationTimeMs)*time.Millisecond, cancelled)
+
+	result, err := getIntervalOperationResult(task)
+	if err != nil {
+		log.Printf("Ошибка интервального вычисления операции %s: %v", task.Operation, err)
+		return "0", 0
+	}
+
+	log.Printf("ЗАВЕРШЕНИЕ интервальной операции %s: результат = %s", task.Operation, result)
+	return result.String(), result.Mid()
+}
+
+// calculateTensorResultWithTime вычисляет операцию над векторами и матрицами с указанной задержкой
+func calculateTensorResultWithTime(task *pb.Task, operationTimeMs int, cancelled <-chan struct{}) *calculator.Tensor {
+	var args []calculator.Tensor
+	for _, arg := range []*pb.Tensor{task.Arg1Tensor, task.Arg2Tensor} {
+		if arg != nil {
+			args = append(args, *grpc.TensorFromProto(arg))
+		}
+	}
+	log.Printf("НАЧАЛО выполнения операции %s над %d аргументами с задержкой %d мс",
+		task.Operation, len(args), operationTimeMs)
+
+	emulateDelay(time.Duration(operationTimeMs)*time.Millisecond, cancelled)
+
+	result, err := calculator.ApplyTensor(task.Operation, args)
+	if err != nil {
+		log.Printf("Ошибка вычисления операции %s: %v", task.Operation, err)
+		result = calculator.Scalar(0)
+	}
+	log.Printf("ЗАВЕРШЕНИЕ операции %s: результат = %s", task.Operation, result.String())
+	return &result
+}
+
+// textArgs возвращает аргументы задачи, переданные текстом (режимы decimal и interval)
+func textArgs(task *pb.Task) []string {
+	switch {
+	case calculator.IsFunction(task.Operation):
+		return task.ArgsDecimal
+	case calculator.IsUnaryOperator(task.Operation):
+		return []string{task.Arg1Decimal}
+	}
+	return []string{task.Arg1Decimal, task.Arg2Decimal}
+}
+
+func getDecimalOperationResult(task *pb.Task) (*big.Rat, error) {
+	texts := textArgs(task)
+	args := make([]*big.Rat, len(texts))
+	for i, text := range texts {
+		arg, err := calculator.ParseDecimal(text)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = arg
+	}
+
+	return calculator.ApplyDecimal(task.Operation, args)
+}
+
+func getIntervalOperationResult(task *pb.Task) (calculator.Interval, error) {
+	texts := textArgs(task)
+	args := make([]calculator.Interval, len(texts))
+	for i, text := range texts {
+		arg, err := calculator.ParseInterval(text)
+		if err != nil {
+			return calculator.Interval{}, err
+		}
+		args[i] = arg
+	}
+
+	return calculator.ApplyInterval(task.Operation, args)
+}
+
+func getOperationResult(operation string, arg1, arg2 float64, args []float64) float64 {
+	if calculator.IsFunction(operation) {
+		result, err := calculator.ApplyFunction(operation, args)
+		if err != nil {
+			log.Printf("Ошибка вычисления функции %s%v: %v", operation, args, err)
+			return 0
+		}
+		return result
+	}
+
 	switch operation {
+	case "neg":
+		return -arg1
+	case calculator.UnaryNot:
+		result, _ := calculator.ApplyUnaryOperator(operation, arg1)
+		return result
 	case "+":
 		return arg1 + arg2
 	case "-":
@@ -243,6 +434,18 @@ func getOperationResult(operation string, arg1, arg2 float64) float64 {
 			return 0
 		}
 		return arg1 / arg2
+	case "^":
+		return math.Pow(arg1, arg2)
+	case calculator.OpModulo, calculator.OpIntDivide, calculator.OpBitAnd, calculator.OpBitOr,
+		calculator.OpBitXor, calculator.OpShiftLeft, calculator.OpShiftRight,
+		calculator.OpLess, calculator.OpLessEqual, calculator.OpGreater, calculator.OpGreaterEqual,
+		calculator.OpEqual, calculator.OpNotEqual, calculator.OpAnd, calculator.OpOr:
+		result, err := calculator.ApplyOperator(operation, arg1, arg2)
+		if err != nil {
+			log.Printf("Ошибка вычисления операции %f %s %f: %v", arg1, operation, arg2, err)
+			return 0
+		}
+		return result
 	default:
 		return 0
 	}
@@ -26,16 +26,21 @@ type TokenInfoResponse struct {
 }
 
 type CalculateRequest struct {
-	Expression string `json:"expression"`
+	Expression string             `json:"expression"`
+	Variables  map[string]float64 `json:"variables,omitempty"`
+	Precision  string             `json:"precision,omitempty"` // "float" (по умолчанию), "decimal" или "interval"
 }
 
 type CalculateResponse struct {
-	Result string `json:"result"`
+	Result    string `json:"result"`
+	Unit      string `json:"unit,omitempty"`      // Единица измерения результата
+	Formatted string `json:"formatted,omitempty"` // Результат в записи локали пользователя
 }
 
 type AuthRequest struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
+	Locale   string `json:"locale,omitempty"` // Локаль для записи чисел, по умолчанию "en"
 }
 
 type LoginResponse struct {
@@ -54,9 +59,6 @@ func main() {
 	db := database.GetDB()
 	defer db.Close()
 
-	// Создаем экземпляр калькулятора
-	calc := calculator.NewCalculator()
-
 	// Настраиваем маршруты API с использованием mux
 	r := mux.NewRouter()
 
@@ -97,34 +99,59 @@ func main() {
 			return
 		}
 
+		if !calculator.IsValidPrecision(req.Precision) {
+			sendJSONError(w, http.StatusBadRequest, "Неподдерживаемый режим точности")
+			return
+		}
+
+		// Числа в записи локали пользователя ("3,14") переводятся в запись калькулятора
+		locale := calculator.LocaleFor(database.GetUserLocale(userID))
+		normalized, normalizeErr := locale.Normalize(req.Expression)
+		if synErr, ok := calculator.AsSyntaxError(normalizeErr); ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":        fmt.Sprintf("Expression is not valid: %v", synErr),
+				"syntax_error": synErr,
+			})
+			return
+		}
+		req.Expression = normalized
+
 		expressionID := uuid.New().String()
 
 		// Создаем объект выражения для сохранения в БД
+		// Некорректное выражение не имеет канонической записи
+		canonical, _ := calculator.Canonicalize(req.Expression)
 		expression := models.Expression{
-			ID:     expressionID,
-			Text:   req.Expression,
-			Status: "processing",
+			ID:        expressionID,
+			Text:      req.Expression,
+			Canonical: canonical,
+			Variables: req.Variables,
+			Precision: req.Precision,
+			Status:    "processing",
 		}
 
-		// Вычисляем результат
-		result, err := calc.Calculate(req.Expression)
+		// Вычисляем результат в режиме точности запроса
+		result, err := calculator.Evaluate(req.Expression, calculator.EvaluateOptions{
+			Precision: req.Precision,
+			Variables: req.Variables,
+		})
 		if err != nil {
 			expression.Status = "error"
 			_ = database.SaveExpression(&expression, userID)
 
-			if strings.Contains(err.Error(), "invalid") ||
-				strings.Contains(err.Error(), "tokenization error") ||
-				strings.Contains(err.Error(), "division by zero") ||
-				strings.Contains(err.Error(), "mismatched parentheses") {
-
-				errorMsg := err.Error()
-				errorMsg = strings.Replace(errorMsg, "tokenization error: ", "", 1)
+			if calculator.IsEvaluationError(err) {
+				response := map[string]interface{}{
+					"error": fmt.Sprintf("Expression is not valid: %v", err),
+				}
+				if synErr, ok := calculator.AsSyntaxError(err); ok {
+					response["syntax_error"] = synErr
+				}
 
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusUnprocessableEntity)
-				json.NewEncoder(w).Encode(map[string]string{
-					"error": fmt.Sprintf("Expression is not valid: %v", errorMsg),
-				})
+				json.NewEncoder(w).Encode(response)
 				return
 			}
 
@@ -140,7 +167,11 @@ func main() {
 
 		// Обновляем статус и результат выражения
 		expression.Status = "completed"
-		expression.Result = result
+		expression.Result = result.Value
+		expression.ResultText = result.Text
+		expression.ResultLow, expression.ResultHigh = result.Low, result.High
+		expression.ResultTensor = result.Tensor
+		expression.Unit = result.Unit
 
 		// Сохраняем выражение с результатом
 		err = database.SaveExpression(&expression, userID)
@@ -152,8 +183,16 @@ func main() {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		response := CalculateResponse{
-			Result: fmt.Sprintf("%g", result),
+			Result: fmt.Sprintf("%g", result.Value),
+			Unit:   result.Unit,
+		}
+		if result.Text != "" {
+			response.Result = result.Text
 		}
+		if result.Tensor != nil {
+			response.Result = result.Tensor.String()
+		}
+		response.Formatted = locale.FormatResult(result.Value, result.Text, result.Tensor)
 		json.NewEncoder(w).Encode(response)
 	}).Methods(http.MethodPost)
 
@@ -173,6 +212,13 @@ func main() {
 			return
 		}
 
+		locale := calculator.LocaleFor(database.GetUserLocale(userID))
+		for i := range expressions {
+			if expressions[i].Status == "completed" || expressions[i].Status == "COMPLETED" {
+				expressions[i].Formatted = locale.FormatResult(expressions[i].Result, expressions[i].ResultText, expressions[i].ResultTensor)
+			}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -215,8 +261,14 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	locale, ok := calculator.LookupLocale(req.Locale)
+	if !ok {
+		sendJSONError(w, http.StatusBadRequest, "Неподдерживаемая локаль: "+req.Locale)
+		return
+	}
+
 	// Создаем пользователя в базе данных
-	_, err := database.CreateUser(req.Login, req.Password)
+	userID, err := database.CreateUser(req.Login, req.Password)
 	if err != nil {
 		log.Printf("Ошибка при регистрации пользователя: %v", err)
 		if strings.Contains(err.Error(), "уже существует") {
@@ -227,6 +279,12 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if locale.Name != calculator.DefaultLocale {
+		if err := database.SetUserLocale(userID, locale.Name); err != nil {
+			log.Printf("Ошибка сохранения локали пользователя: %v", err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -44,6 +45,10 @@ func main() {
 	log.Printf("Сервер запущен с TaskManager: задачи=%d, выражения=%d",
 		len(taskManager.GetAllTasks()), len(taskManager.GetAllExpressions()))
 
+	// Сроки выражений и аренды задач проверяются и без запросов агентов
+	stopReaper := taskManager.StartReaper(time.Second)
+	defer stopReaper()
+
 	go func() {
 		grpcAddress := ":" + grpcPort
 		log.Printf("Starting gRPC server for agents on port %s", grpcPort)
@@ -59,8 +64,14 @@ func main() {
 
 	protected.HandleFunc("/expressions", orchestrator.HandleGetExpressions).Methods("GET")
 	protected.HandleFunc("/expressions/{id}", orchestrator.HandleGetExpression).Methods("GET")
+	protected.HandleFunc("/expressions/{id}", orchestrator.HandleCancelExpression).Methods("DELETE")
+	protected.HandleFunc("/expressions/{id}/cancel", orchestrator.HandleCancelExpression).Methods("POST")
+	protected.HandleFunc("/expressions/{id}/render", orchestrator.HandleRenderExpression).Methods("GET")
 	protected.HandleFunc("/calculate", orchestrator.HandleProtectedCalculate).Methods("POST")
+	protected.HandleFunc("/differentiate", orchestrator.HandleDifferentiate).Methods("POST")
 	protected.HandleFunc("/history", orchestrator.HandleProtectedHistory).Methods("GET")
+	protected.HandleFunc("/settings", orchestrator.HandleGetSettings).Methods("GET")
+	protected.HandleFunc("/settings", orchestrator.HandleUpdateSettings).Methods("PUT")
 
 	r.HandleFunc("/api/v1/register", orchestrator.HandleRegister).Methods("POST")
 	r.HandleFunc("/api/v1/login", orchestrator.HandleLogin).Methods("POST")
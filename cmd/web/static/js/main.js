@@ -97,6 +97,9 @@ document.addEventListener('DOMContentLoaded', () => {
             if (!response.ok) {
                 // Если удалось распарсить JSON и есть поле error/message — показываем его, иначе показываем текст ответа
                 showError((data && (data.error || data.message)) || responseText || `Ошибка: ${response.status}`);
+                if (data && data.syntax_error) {
+                    showSyntaxErrorCaret(expression, data.syntax_error);
+                }
                 return;
             }
             
@@ -132,6 +135,7 @@ document.addEventListener('DOMContentLoaded', () => {
                 if (data.status === 'COMPLETED') {
                     if (data.result !== undefined) {
                         resultDiv.innerHTML = `<div class="success">Результат: ${data.result}</div>`;
+                        await renderFormula(id);
                     } else {
                         resultDiv.innerHTML = '';
                     }
@@ -162,6 +166,28 @@ document.addEventListener('DOMContentLoaded', () => {
         showError('Превышено время ожидания результата');
     }
 
+    // Показывает вычисленное выражение в типографской записи (MathML отображается браузером)
+    async function renderFormula(id) {
+        try {
+            const response = await fetch(`/api/v1/expressions/${id}/render?format=mathml`, {
+                headers: {
+                    'Authorization': 'Bearer ' + localStorage.getItem('token')
+                }
+            });
+            if (!response.ok) {
+                return;
+            }
+
+            const data = await response.json();
+            const formula = document.createElement('div');
+            formula.className = 'formula';
+            formula.innerHTML = data.rendered;
+            resultDiv.prepend(formula);
+        } catch (error) {
+            console.error('Ошибка при получении формулы:', error);
+        }
+    }
+
     async function loadHistory() {
         if (!localStorage.getItem('token')) {
             return;
@@ -277,7 +303,7 @@ document.addEventListener('DOMContentLoaded', () => {
                     
                     const resultCell = document.createElement('td');
                 const isCompleted = status === 'completed';
-                resultCell.textContent = isCompleted && expr.result !== undefined ? expr.result : '-';
+                resultCell.textContent = isCompleted && expr.result !== undefined ? formatResult(expr) : '-';
                     
                     const statusCell = document.createElement('td');
                     let statusRu = 'В обработке';
@@ -321,6 +347,23 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     }
 
+    // Результат-вектор или матрица записывается как в выражениях: "[[1, 2], [3, 4]]"
+    function formatResult(expr) {
+        const tensor = expr.result_tensor;
+        if (!tensor) {
+            return expr.result;
+        }
+        if (tensor.shape.length < 2) {
+            return `[${tensor.values.join(', ')}]`;
+        }
+        const columns = tensor.shape[1];
+        const rows = [];
+        for (let i = 0; i < tensor.values.length; i += columns) {
+            rows.push(`[${tensor.values.slice(i, i + columns).join(', ')}]`);
+        }
+        return `[${rows.join(', ')}]`;
+    }
+
     function showError(message) {
         const notification = document.getElementById('notification');
         if (notification) {
@@ -331,6 +374,30 @@ document.addEventListener('DOMContentLoaded', () => {
         if (resultDiv) resultDiv.innerHTML = '';
     }
 
+    // Показывает выражение и указатель "^" под позицией синтаксической ошибки
+    function showSyntaxErrorCaret(expression, syntaxError) {
+        const notification = document.getElementById('notification');
+        if (!notification) return;
+
+        // Сервер передаёт смещение в байтах UTF-8, переводим его в номер символа
+        const encoder = new TextEncoder();
+        let bytes = 0;
+        let column = 0;
+        for (const char of expression) {
+            if (bytes >= syntaxError.offset) break;
+            bytes += encoder.encode(char).length;
+            column++;
+        }
+
+        const pre = document.createElement('pre');
+        pre.className = 'syntax-error';
+        pre.textContent = expression + '\n' + ' '.repeat(column) + '^';
+        if (syntaxError.expected && syntaxError.expected.length > 0) {
+            pre.textContent += '\nОжидалось: ' + syntaxError.expected.join(', ');
+        }
+        notification.appendChild(pre);
+    }
+
     // --- ДОБАВЛЯЕМ ФУНКЦИЮ ОТОБРАЖЕНИЯ PROCESSING ---
     function renderProcessing(expressions) {
         const processingBody = document.getElementById('processing-body');
@@ -347,7 +414,7 @@ document.addEventListener('DOMContentLoaded', () => {
             row.className = 'processing';
             row.innerHTML = `
                 <td>${expr.expression}</td>
-                <td>${expr.result ?? ''}</td>
+                <td>${expr.result_tensor ? formatResult(expr) : (expr.result ?? '')}</td>
                 <td>${expr.status}</td>
                 <td>${expr.created_at}</td>
             `;
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"gocalc/internal/auth"
+	"gocalc/internal/calculator"
 	"gocalc/internal/database"
 	"gocalc/internal/models"
 	"net/http"
@@ -29,12 +30,22 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := database.CreateUser(req.Login, req.Password)
+	locale, ok := calculator.LookupLocale(req.Locale)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "Unsupported locale"}`))
+		return
+	}
+
+	userID, err := database.CreateUser(req.Login, req.Password)
 	if err != nil {
 		w.WriteHeader(http.StatusConflict)
 		w.Write([]byte(`{"error": "User already exists"}`))
 		return
 	}
+	if locale.Name != calculator.DefaultLocale {
+		_ = database.SetUserLocale(userID, locale.Name)
+	}
 
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte(`{"message": "User registered successfully"}`))
@@ -12,7 +12,10 @@ import (
 	"github.com/google/uuid"
 )
 
-var SaveExpressionFunc = database.SaveExpression
+var (
+	SaveExpressionFunc = database.SaveExpression
+	UserLocaleFunc     = database.GetUserLocale
+)
 
 type CalculatorHandler struct{}
 
@@ -21,7 +24,9 @@ func NewCalculatorHandler() *CalculatorHandler {
 }
 
 type CalculateRequest struct {
-	Expression string `json:"expression"`
+	Expression string             `json:"expression"`
+	Variables  map[string]float64 `json:"variables,omitempty"`
+	Precision  string             `json:"precision,omitempty"`
 }
 
 func (h *CalculatorHandler) Calculate(w http.ResponseWriter, r *http.Request) {
@@ -53,46 +58,73 @@ func (h *CalculatorHandler) Calculate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	expression := &models.Expression{
-		ID:     uuid.New().String(),
-		Text:   req.Expression,
-		Status: "processing",
+	if !calculator.IsValidPrecision(req.Precision) {
+		SendErrorResponse(w, http.StatusBadRequest, "Unsupported precision")
+		return
 	}
 
-	result, err := calculator.Calc(req.Expression)
-	if err != nil {
-		// ошибка при вычислении выражения должна возвращать 422
-		if strings.Contains(err.Error(), "invalid") ||
-			strings.Contains(err.Error(), "division by zero") ||
-			strings.Contains(err.Error(), "mismatched parentheses") ||
-			strings.Contains(err.Error(), "tokenization error") {
-
-			errorMsg := err.Error()
-			errorMsg = strings.Replace(errorMsg, "tokenization error: ", "", 1)
+	locale := calculator.LocaleFor(UserLocaleFunc(userID))
+	normalized, normalizeErr := locale.Normalize(req.Expression)
+	if synErr, ok := calculator.AsSyntaxError(normalizeErr); ok {
+		SendSyntaxErrorResponse(w, "Expression is not valid", synErr)
+		return
+	}
+	req.Expression = normalized
 
-			expression.Status = "error"
+	canonical, _ := calculator.Canonicalize(req.Expression)
+	expression := &models.Expression{
+		ID:        uuid.New().String(),
+		Text:      req.Expression,
+		Canonical: canonical,
+		Variables: req.Variables,
+		Precision: req.Precision,
+		Status:    "processing",
+	}
 
-			// Сохраняем выражение с ошибкой
-			_ = SaveExpressionFunc(expression, userID)
+	result, err := calculator.Evaluate(req.Expression, calculator.EvaluateOptions{
+		Precision: req.Precision,
+		Variables: req.Variables,
+	})
+	if err != nil {
+		expression.Status = "error"
+		_ = SaveExpressionFunc(expression, userID)
 
+		// ошибка в самом выражении должна возвращать 422
+		if synErr, ok := calculator.AsSyntaxError(err); ok {
+			SendSyntaxErrorResponse(w, "Expression is not valid", synErr)
+			return
+		}
+		if calculator.IsEvaluationError(err) {
 			SendErrorResponse(w, http.StatusUnprocessableEntity, "Expression is not valid")
 			return
 		}
-
-		expression.Status = "error"
-		_ = SaveExpressionFunc(expression, userID)
 		SendErrorResponse(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	expression.Status = "completed"
-	expression.Result = result
+	expression.Result = result.Value
+	expression.ResultText = result.Text
+	expression.ResultLow, expression.ResultHigh = result.Low, result.High
+	expression.ResultTensor = result.Tensor
+	expression.Unit = result.Unit
 
 	err = SaveExpressionFunc(expression, userID)
 	if err != nil {
 	}
 
-	SendSuccessResponse(w, result)
+	response := SuccessResponse{
+		Result:     result.Value,
+		ResultText: result.Text,
+		ResultLow:  result.Low,
+		ResultHigh: result.High,
+		Unit:       result.Unit,
+	}
+	if result.Tensor != nil {
+		response = SuccessResponse{ResultTensor: result.Tensor, Unit: result.Unit}
+	}
+	response.Formatted = locale.FormatResult(result.Value, result.Text, result.Tensor)
+	SendResultResponse(w, response)
 }
 
 func (h *CalculatorHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
@@ -108,6 +140,13 @@ func (h *CalculatorHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	locale := calculator.LocaleFor(UserLocaleFunc(userID))
+	for i := range expressions {
+		if expressions[i].Status == "completed" {
+			expressions[i].Formatted = locale.FormatResult(expressions[i].Result, expressions[i].ResultText, expressions[i].ResultTensor)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(models.ExpressionList{Expressions: expressions})
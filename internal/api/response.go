@@ -2,15 +2,23 @@ package api
 
 import (
 	"encoding/json"
+	"gocalc/internal/calculator"
 	"net/http"
 )
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error       string                  `json:"error"`
+	SyntaxError *calculator.SyntaxError `json:"syntax_error,omitempty"` // Позиция синтаксической ошибки
 }
 
 type SuccessResponse struct {
-	Result float64 `json:"result"`
+	Result       float64            `json:"result"`
+	ResultText   string             `json:"result_text,omitempty"`   // Точный результат в режиме decimal или интервал в режиме interval
+	ResultLow    *float64           `json:"result_low,omitempty"`    // Нижняя граница результата в режиме interval
+	ResultHigh   *float64           `json:"result_high,omitempty"`   // Верхняя граница результата в режиме interval
+	ResultTensor *calculator.Tensor `json:"result_tensor,omitempty"` // Результат-вектор или матрица
+	Unit         string             `json:"unit,omitempty"`          // Единица измерения результата ("km/h")
+	Formatted    string             `json:"formatted,omitempty"`     // Результат в записи локали пользователя ("1 234,5")
 }
 
 func SendErrorResponse(w http.ResponseWriter, status int, message string) {
@@ -19,8 +27,20 @@ func SendErrorResponse(w http.ResponseWriter, status int, message string) {
 	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
 }
 
+// SendSyntaxErrorResponse отправляет ошибку 422 с позицией синтаксической ошибки
+func SendSyntaxErrorResponse(w http.ResponseWriter, message string, synErr *calculator.SyntaxError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message, SyntaxError: synErr})
+}
+
 func SendSuccessResponse(w http.ResponseWriter, result float64) {
+	SendResultResponse(w, SuccessResponse{Result: result})
+}
+
+// SendResultResponse отправляет результат вычисления со всеми заполненными полями
+func SendResultResponse(w http.ResponseWriter, response SuccessResponse) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(SuccessResponse{Result: result})
+	json.NewEncoder(w).Encode(response)
 }
@@ -0,0 +1,85 @@
+// Package ast содержит лексер, парсер и дерево арифметических выражений.
+// Дерево используется и для локального вычисления, и для разбиения выражения на задачи агентов
+package ast
+
+// Операторы, которые грамматика различает по имени
+const (
+	UnaryMinus = "neg" // Унарный минус
+	UnaryPlus  = "pos" // Унарный плюс
+	UnaryNot   = "not" // Логическое отрицание "!"
+
+	OpBitXor = "xor" // Ключевое слово побитового исключающего ИЛИ
+	OpMatMul = "@"   // Матричное произведение
+
+	OpPlusMinus = "±" // Число с погрешностью "5±0.2" (синоним "+/-")
+
+	OpTo = "to" // Ключевое слово перевода в единицы измерения "5 km / 2 h to km/h"
+
+	TernaryIf     = "?"
+	TernaryElse   = ":"
+	OpConditional = "?:" // Условный оператор в RPN
+)
+
+// Node - узел дерева выражения
+type Node interface {
+	// Pos возвращает смещение узла в исходном выражении (в байтах)
+	Pos() int
+}
+
+// Number - числовой литерал
+type Number struct {
+	Value  string // Десятичная запись, понятная strconv.ParseFloat и big.Rat
+	Text   string // Исходная запись ("0x1F", имя подставленной переменной)
+	Unit   string // Единица измерения после числа ("km" в "5 km", "m^2" в "3 m^2"), "" - без единицы
+	Offset int
+}
+
+// Ident - имя переменной или константы
+type Ident struct {
+	Name   string
+	Offset int
+}
+
+// UnaryOp - префиксный оператор: UnaryMinus, UnaryPlus или UnaryNot
+type UnaryOp struct {
+	Op      string
+	Operand Node
+	Text    string // Исходная запись оператора ("-", "+", "!")
+	Offset  int
+}
+
+// BinaryOp - бинарный оператор
+type BinaryOp struct {
+	Op          string
+	Left, Right Node
+	Text        string // Исходная запись оператора ("**" для "^")
+	Offset      int
+}
+
+// Call - вызов функции
+type Call struct {
+	Name   string // Имя в нижнем регистре
+	Args   []Node
+	Text   string // Имя в исходной записи
+	Offset int
+}
+
+// Conditional - условный оператор "Cond ? Then : Else"
+type Conditional struct {
+	Cond, Then, Else Node
+	Offset           int // Смещение "?"
+}
+
+// Vector - литерал вектора "[1, 2, 3]" или матрицы "[[1, 2], [3, 4]]" (вектор из строк)
+type Vector struct {
+	Elements []Node
+	Offset   int // Смещение "["
+}
+
+func (n *Number) Pos() int      { return n.Offset }
+func (n *Ident) Pos() int       { return n.Offset }
+func (n *UnaryOp) Pos() int     { return n.Offset }
+func (n *BinaryOp) Pos() int    { return n.Offset }
+func (n *Call) Pos() int        { return n.Offset }
+func (n *Conditional) Pos() int { return n.Offset }
+func (n *Vector) Pos() int      { return n.Offset }
@@ -0,0 +1,63 @@
+package ast
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Стабильные коды синтаксических ошибок (используются клиентами API)
+const (
+	ErrCodeInvalidCharacter      = "invalid_character"
+	ErrCodeInvalidNumber         = "invalid_number"
+	ErrCodeUnknownFunction       = "unknown_function"
+	ErrCodeUndefinedVariable     = "undefined_variable"
+	ErrCodeUnexpectedToken       = "unexpected_token"
+	ErrCodeUnexpectedEnd         = "unexpected_end"
+	ErrCodeMismatchedParentheses = "mismatched_parentheses"
+	ErrCodeMismatchedBrackets    = "mismatched_brackets"
+	ErrCodeMisplacedComma        = "misplaced_comma"
+	ErrCodeMismatchedConditional = "mismatched_conditional"
+	ErrCodeUnknownUnit           = "unknown_unit"
+	ErrCodeIncompatibleUnits     = "incompatible_units"
+)
+
+// Наборы ожидаемых токенов для сообщений об ошибках
+var (
+	expectedOperand  = []string{"number", "variable", "function", "(", "["}
+	expectedOperator = []string{"operator", ")"}
+)
+
+// SyntaxError описывает синтаксическую ошибку с позицией в исходном выражении
+type SyntaxError struct {
+	Code     string   `json:"code"`               // Стабильный код ошибки (ErrCode*)
+	Message  string   `json:"message"`            // Текст ошибки
+	Offset   int      `json:"offset"`             // Смещение в байтах от начала выражения
+	Token    string   `json:"token,omitempty"`    // Исходный текст токена, на котором возникла ошибка
+	Expected []string `json:"expected,omitempty"` // Токены, допустимые на этой позиции
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Message
+}
+
+// Caret возвращает выражение и строку с указателем "^" под позицией ошибки
+func (e *SyntaxError) Caret(expr string) string {
+	offset := e.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(expr) {
+		offset = len(expr)
+	}
+	return expr + "\n" + strings.Repeat(" ", utf8.RuneCountInString(expr[:offset])) + "^"
+}
+
+// AsSyntaxError извлекает SyntaxError из цепочки ошибок
+func AsSyntaxError(err error) (*SyntaxError, bool) {
+	var synErr *SyntaxError
+	if errors.As(err, &synErr) {
+		return synErr, true
+	}
+	return nil, false
+}
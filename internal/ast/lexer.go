@@ -0,0 +1,125 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type TokenKind string
+
+const (
+	TokenNumber       TokenKind = "number"
+	TokenIdent        TokenKind = "ident"
+	TokenOperator     TokenKind = "operator"
+	TokenLeftParen    TokenKind = "left_paren"
+	TokenRightParen   TokenKind = "right_paren"
+	TokenLeftBracket  TokenKind = "left_bracket"
+	TokenRightBracket TokenKind = "right_bracket"
+	TokenComma        TokenKind = "comma"
+)
+
+// Token - лексема выражения
+type Token struct {
+	Kind  TokenKind
+	Value string // Нормализованное значение: десятичная запись числа, "^" для "**", "xor" в любом регистре
+	Pos   int    // Смещение токена в исходном выражении (в байтах)
+	Text  string // Исходная запись токена
+}
+
+// Lex разбивает выражение на токены. Пробелы разделяют токены и не входят в них,
+// позиции токенов отсчитываются от начала исходного выражения.
+// Унарные и бинарные "+" и "-" различает парсер, а не лексер
+func Lex(src string) ([]Token, error) {
+	var tokens []Token
+	add := func(kind TokenKind, value string, pos int, text string) {
+		tokens = append(tokens, Token{Kind: kind, Value: value, Pos: pos, Text: text})
+	}
+
+	for i := 0; i < len(src); i++ {
+		char := src[i]
+
+		switch {
+		case char == ' ':
+			continue
+		case char == '(':
+			add(TokenLeftParen, "(", i, "(")
+		case char == ')':
+			add(TokenRightParen, ")", i, ")")
+		case char == '[':
+			add(TokenLeftBracket, "[", i, "[")
+		case char == ']':
+			add(TokenRightBracket, "]", i, "]")
+		case char == ',':
+			add(TokenComma, ",", i, ",")
+		case strings.HasPrefix(src[i:], OpPlusMinus):
+			add(TokenOperator, OpPlusMinus, i, OpPlusMinus)
+			i += len(OpPlusMinus) - 1
+		case strings.HasPrefix(src[i:], "+/-"):
+			// "+/-" - синоним "±": за "+" не может следовать "/", поэтому запись однозначна
+			add(TokenOperator, OpPlusMinus, i, "+/-")
+			i += 2
+		case char == '*' && i+1 < len(src) && src[i+1] == '*':
+			// "**" - синоним возведения в степень
+			add(TokenOperator, "^", i, "**")
+			i++
+		case i+1 < len(src) && isDoubleOperator(src[i:i+2]):
+			add(TokenOperator, src[i:i+2], i, src[i:i+2])
+			i++
+		case strings.IndexByte("+-*/^%&|<>?:!@", char) >= 0:
+			add(TokenOperator, string(char), i, string(char))
+		case isDecimalDigit(char):
+			j := ScanNumber(src, i)
+			text := src[i:j]
+			value, err := ParseNumberLiteral(text)
+			if err != nil {
+				return nil, &SyntaxError{
+					Code:    ErrCodeInvalidNumber,
+					Message: err.Error(),
+					Offset:  i,
+					Token:   text,
+				}
+			}
+			add(TokenNumber, value, i, text)
+			i = j - 1
+		case isIdentifierStart(char):
+			j := i
+			for j < len(src) && (isIdentifierStart(src[j]) || isDecimalDigit(src[j])) {
+				j++
+			}
+			name := src[i:j]
+			if strings.EqualFold(name, OpBitXor) {
+				// "xor" - ключевое слово оператора, а не переменная
+				add(TokenOperator, OpBitXor, i, name)
+			} else if strings.EqualFold(name, OpTo) {
+				add(TokenOperator, OpTo, i, name)
+			} else {
+				add(TokenIdent, name, i, name)
+			}
+			i = j - 1
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, &SyntaxError{
+				Code:    ErrCodeInvalidCharacter,
+				Message: fmt.Sprintf("invalid character: %c", r),
+				Offset:  i,
+				Token:   string(r),
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+// isDoubleOperator проверяет двухсимвольные операторы ("//", "<<", "<=", "&&" и т.д.)
+func isDoubleOperator(s string) bool {
+	switch s {
+	case "//", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||":
+		return true
+	}
+	return false
+}
+
+func isIdentifierStart(char byte) bool {
+	return char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+}
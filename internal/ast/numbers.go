@@ -0,0 +1,123 @@
+package ast
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ScanNumber возвращает позицию конца числового литерала, начинающегося с expr[start].
+// В литерал попадают цифры, "_" и "." подряд и порядок "e" со знаком, чтобы некорректная
+// запись ("1.2.3", "2e+") целиком попала в сообщение об ошибке. Другая буква после
+// десятичного числа начинает единицу измерения ("5km"); в шестнадцатеричное и двоичное
+// число входят все буквы ("0x1G")
+func ScanNumber(expr string, start int) int {
+	prefixed := start+1 < len(expr) && expr[start] == '0' && strings.ContainsRune("xXbB", rune(expr[start+1]))
+
+	j := start
+	for j < len(expr) {
+		char := expr[j]
+		switch {
+		case isDecimalDigit(char) || char == '.' || char == '_':
+			j++
+		case prefixed && isIdentifierStart(char):
+			j++
+		case (char == 'e' || char == 'E') && j+1 < len(expr) && strings.IndexByte("0123456789+-", expr[j+1]) >= 0:
+			j++
+		case (char == '+' || char == '-') && !prefixed && j > start && (expr[j-1] == 'e' || expr[j-1] == 'E'):
+			j++
+		default:
+			return j
+		}
+	}
+	return j
+}
+
+// ParseNumberLiteral проверяет числовой литерал и возвращает его десятичную запись,
+// понятную strconv.ParseFloat и ParseDecimal. Поддерживаются десятичные числа с порядком
+// ("1.5e-3"), шестнадцатеричные ("0x1F") и двоичные ("0b1010") целые, а также
+// разделители разрядов "_" между цифрами ("1_000_000")
+func ParseNumberLiteral(text string) (string, error) {
+	invalid := fmt.Errorf("invalid number: %s", text)
+
+	if len(text) > 2 && text[0] == '0' {
+		base := 0
+		switch text[1] {
+		case 'x', 'X':
+			base = 16
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 0 {
+			digits := text[2:]
+			isDigit := func(c byte) bool { return digitValue(c) < base }
+			if !validDigits(digits, isDigit) {
+				return "", invalid
+			}
+			n, ok := new(big.Int).SetString(strings.ReplaceAll(digits, "_", ""), base)
+			if !ok {
+				return "", invalid
+			}
+			return n.String(), nil
+		}
+	}
+
+	mantissa, exponent := text, ""
+	if k := strings.IndexAny(text, "eE"); k >= 0 {
+		mantissa, exponent = text[:k], text[k+1:]
+		if exponent != "" && (exponent[0] == '+' || exponent[0] == '-') {
+			exponent = exponent[1:]
+		}
+		if !validDigits(exponent, isDecimalDigit) {
+			return "", invalid
+		}
+	}
+
+	intPart, fracPart, hasDot := strings.Cut(mantissa, ".")
+	if !validDigits(intPart, isDecimalDigit) || (hasDot && fracPart != "" && !validDigits(fracPart, isDecimalDigit)) {
+		return "", invalid
+	}
+
+	value := strings.ReplaceAll(text, "_", "")
+	if _, err := strconv.ParseFloat(value, 64); err != nil {
+		return "", invalid
+	}
+	return value, nil
+}
+
+// validDigits проверяет непустую последовательность цифр, в которой "_" стоит только между цифрами
+func validDigits(s string, isDigit func(byte) bool) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '_' {
+			if i == 0 || i == len(s)-1 || !isDigit(s[i-1]) || !isDigit(s[i+1]) {
+				return false
+			}
+			continue
+		}
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDecimalDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// digitValue возвращает значение шестнадцатеричной цифры (16 - не цифра)
+func digitValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return 16
+}
@@ -0,0 +1,449 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Приоритеты бинарных операторов (больше - связывает сильнее). Порядок как в C:
+// ?: < || < && < | < xor < & < == != < < <= > >= < сдвиги < + - < * / // % @ < унарные < ^ < ±.
+// "±" связывает сильнее всех: 2*5±0.2 = 2*(5±0.2). Единица после числа ("5 km") - часть литерала.
+// Перевод единиц "to" не входит в таблицу: он допустим только в конце всего выражения
+var binaryPrecedence = map[string]int{
+	TernaryIf: 1,
+
+	"||": 2,
+	"&&": 3,
+
+	"|":      4,
+	OpBitXor: 5,
+	"&":      6,
+
+	"==": 7,
+	"!=": 7,
+
+	"<":  8,
+	"<=": 8,
+	">":  8,
+	">=": 8,
+
+	"<<": 9,
+	">>": 9,
+
+	"+": 10,
+	"-": 10,
+
+	"*":  11,
+	"/":  11,
+	"//": 11,
+	"%":  11,
+
+	OpMatMul: 11,
+
+	"^": 13,
+
+	OpPlusMinus: 14,
+}
+
+// UnaryPrecedence - приоритет префиксных операторов: -2^2 = -(2^2), но -2*3 = (-2)*3
+const UnaryPrecedence = 12
+
+// Правоассоциативные операторы: 2^3^2 = 2^(3^2), a ? b : c ? d : e = a ? b : (c ? d : e)
+var rightAssociative = map[string]bool{
+	"^":       true,
+	TernaryIf: true,
+}
+
+// Префиксные операторы и соответствующие им узлы UnaryOp
+var prefixOperators = map[string]string{
+	"-": UnaryMinus,
+	"+": UnaryPlus,
+	"!": UnaryNot,
+}
+
+// Precedence возвращает приоритет бинарного оператора, 0 - не бинарный оператор
+func Precedence(op string) int {
+	return binaryPrecedence[op]
+}
+
+// IsRightAssociative проверяет, что оператор правоассоциативный
+func IsRightAssociative(op string) bool {
+	return rightAssociative[op]
+}
+
+type parser struct {
+	src    string
+	tokens []Token
+	pos    int
+	calls  int // Глубина вложенности вызовов функций и литералов векторов: внутри них допустима ","
+}
+
+// Parse разбирает выражение в дерево
+func Parse(src string) (Node, error) {
+	tokens, err := Lex(src)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTokens(src, tokens)
+}
+
+// ParseTokens строит дерево из токенов, полученных Lex(src)
+func ParseTokens(src string, tokens []Token) (Node, error) {
+	p := &parser{src: src, tokens: tokens}
+
+	node, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok && tok.Kind == TokenOperator && tok.Value == OpTo {
+		p.pos++
+		if node, err = p.parseConversion(node, tok); err != nil {
+			return nil, err
+		}
+	}
+	if tok, ok := p.peek(); ok {
+		switch tok.Kind {
+		case TokenRightParen:
+			return nil, &SyntaxError{
+				Code:    ErrCodeMismatchedParentheses,
+				Message: "mismatched parentheses",
+				Offset:  tok.Pos,
+				Token:   tok.Text,
+			}
+		case TokenRightBracket:
+			return nil, &SyntaxError{
+				Code:    ErrCodeMismatchedBrackets,
+				Message: "mismatched brackets",
+				Offset:  tok.Pos,
+				Token:   tok.Text,
+			}
+		case TokenComma:
+			return nil, misplacedComma(tok)
+		}
+		return nil, p.unexpectedAfterOperand(tok)
+	}
+	return node, nil
+}
+
+func (p *parser) peek() (Token, bool) {
+	if p.pos >= len(p.tokens) {
+		return Token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// parseExpression разбирает выражение из операторов с приоритетом не ниже minPrecedence
+func (p *parser) parseExpression(minPrecedence int) (Node, error) {
+	left, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.Kind != TokenOperator {
+			return left, nil
+		}
+		precedence, infix := binaryPrecedence[tok.Value]
+		if !infix || precedence < minPrecedence {
+			return left, nil
+		}
+		p.pos++
+
+		if tok.Value == TernaryIf {
+			left, err = p.parseConditional(left, tok)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		next := precedence + 1
+		if rightAssociative[tok.Value] {
+			next = precedence
+		}
+		right, err := p.parseExpression(next)
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryOp{Op: tok.Value, Left: left, Right: right, Text: tok.Text, Offset: tok.Pos}
+	}
+}
+
+// parsePrefix разбирает операнд: число, переменную, вызов функции, скобки или префиксный оператор
+func (p *parser) parsePrefix() (Node, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, &SyntaxError{
+			Code:     ErrCodeUnexpectedEnd,
+			Message:  "invalid expression: unexpected end of expression",
+			Offset:   len(p.src),
+			Expected: expectedOperand,
+		}
+	}
+	p.pos++
+
+	switch tok.Kind {
+	case TokenNumber:
+		return &Number{Value: tok.Value, Text: tok.Text, Unit: p.parseUnitSuffix(), Offset: tok.Pos}, nil
+	case TokenIdent:
+		if next, ok := p.peek(); ok && next.Kind == TokenLeftParen {
+			p.pos++
+			return p.parseCall(tok, next)
+		}
+		return &Ident{Name: tok.Value, Offset: tok.Pos}, nil
+	case TokenLeftParen:
+		return p.parseGroup(tok)
+	case TokenLeftBracket:
+		return p.parseVector(tok)
+	case TokenOperator:
+		if op, ok := prefixOperators[tok.Value]; ok {
+			operand, err := p.parseExpression(UnaryPrecedence)
+			if err != nil {
+				return nil, err
+			}
+			return &UnaryOp{Op: op, Operand: operand, Text: tok.Text, Offset: tok.Pos}, nil
+		}
+	}
+
+	return nil, unexpected(tok, expectedOperand)
+}
+
+// IsUnit проверяет, что имя - единица измерения. Таблица единиц принадлежит пакету
+// calculator, который задаёт эту функцию; по умолчанию единиц нет
+var IsUnit = func(name string) bool { return false }
+
+// parseUnitSuffix разбирает единицу измерения сразу после числа: "km" в "5 km" и "5km",
+// "m^2" в "3 m^2" (целая положительная степень относится к единице, а не к числу)
+// и частное единиц "m/s^2" в "9.8 m/s^2". Имя, которое не является единицей, не входит
+// в число: "2 pi" отклоняется как лишний операнд
+func (p *parser) parseUnitSuffix() string {
+	unit := p.parseUnitFactor()
+	if unit == "" {
+		return ""
+	}
+	for p.pos+1 < len(p.tokens) {
+		slash := p.tokens[p.pos]
+		if slash.Kind != TokenOperator || slash.Value != "/" {
+			break
+		}
+		p.pos++
+		factor := p.parseUnitFactor()
+		if factor == "" {
+			// "5 km / 2 h" - деление величин, а не единица
+			p.pos--
+			break
+		}
+		unit += "/" + factor
+	}
+	return unit
+}
+
+// parseUnitFactor разбирает имя единицы с необязательной степенью. Имя перед "(" -
+// вызов функции, а не единица
+func (p *parser) parseUnitFactor() string {
+	tok, ok := p.peek()
+	if !ok || tok.Kind != TokenIdent || !IsUnit(tok.Value) {
+		return ""
+	}
+	if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].Kind == TokenLeftParen {
+		return ""
+	}
+	p.pos++
+
+	unit := tok.Value
+	if p.pos+1 < len(p.tokens) {
+		caret, exponent := p.tokens[p.pos], p.tokens[p.pos+1]
+		if caret.Kind == TokenOperator && caret.Value == "^" && exponent.Kind == TokenNumber && isDigits(exponent.Value) {
+			p.pos += 2
+			unit += "^" + exponent.Value
+		}
+	}
+	return unit
+}
+
+// parseConversion разбирает единицу, в которую переводится результат, после "to".
+// Единица - произведение и частное имён со степенями: "km/h", "kg*m^2"
+func (p *parser) parseConversion(value Node, to Token) (Node, error) {
+	target, err := p.parseExpression(binaryPrecedence["*"])
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryOp{Op: OpTo, Left: value, Right: target, Text: to.Text, Offset: to.Pos}, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDecimalDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// parseGroup разбирает выражение в скобках после "("
+func (p *parser) parseGroup(open Token) (Node, error) {
+	node, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+
+	tok, ok := p.peek()
+	switch {
+	case !ok:
+		return nil, unclosedParen(open)
+	case tok.Kind == TokenRightParen:
+		p.pos++
+		return node, nil
+	case tok.Kind == TokenComma:
+		return nil, misplacedComma(tok)
+	}
+	return nil, p.unexpectedAfterOperand(tok)
+}
+
+// parseCall разбирает аргументы вызова функции после "("
+func (p *parser) parseCall(name, open Token) (Node, error) {
+	call := &Call{Name: strings.ToLower(name.Value), Text: name.Text, Offset: name.Pos}
+
+	// Вызов без аргументов: "f()"
+	if tok, ok := p.peek(); ok && tok.Kind == TokenRightParen {
+		p.pos++
+		return call, nil
+	}
+
+	p.calls++
+	defer func() { p.calls-- }()
+
+	for {
+		arg, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		tok, ok := p.peek()
+		switch {
+		case !ok:
+			return nil, unclosedParen(open)
+		case tok.Kind == TokenComma:
+			p.pos++
+		case tok.Kind == TokenRightParen:
+			p.pos++
+			return call, nil
+		default:
+			return nil, p.unexpectedAfterOperand(tok)
+		}
+	}
+}
+
+// parseVector разбирает элементы литерала вектора после "[". Пустой вектор не допускается
+func (p *parser) parseVector(open Token) (Node, error) {
+	vector := &Vector{Offset: open.Pos}
+
+	p.calls++
+	defer func() { p.calls-- }()
+
+	for {
+		element, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		vector.Elements = append(vector.Elements, element)
+
+		tok, ok := p.peek()
+		switch {
+		case !ok:
+			return nil, &SyntaxError{
+				Code:     ErrCodeMismatchedBrackets,
+				Message:  "mismatched brackets",
+				Offset:   open.Pos,
+				Token:    open.Text,
+				Expected: []string{"]"},
+			}
+		case tok.Kind == TokenComma:
+			p.pos++
+		case tok.Kind == TokenRightBracket:
+			p.pos++
+			return vector, nil
+		default:
+			return nil, p.unexpectedAfterOperand(tok)
+		}
+	}
+}
+
+// parseConditional разбирает ветки условного оператора после "?"
+func (p *parser) parseConditional(cond Node, question Token) (Node, error) {
+	then, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+
+	tok, ok := p.peek()
+	if !ok || tok.Kind == TokenRightParen || tok.Kind == TokenRightBracket || tok.Kind == TokenComma {
+		return nil, &SyntaxError{
+			Code:     ErrCodeMismatchedConditional,
+			Message:  "mismatched conditional: missing ':'",
+			Offset:   question.Pos,
+			Token:    question.Text,
+			Expected: []string{TernaryElse},
+		}
+	}
+	if tok.Kind != TokenOperator || tok.Value != TernaryElse {
+		return nil, p.unexpectedAfterOperand(tok)
+	}
+	p.pos++
+
+	otherwise, err := p.parseExpression(binaryPrecedence[TernaryIf])
+	if err != nil {
+		return nil, err
+	}
+	return &Conditional{Cond: cond, Then: then, Else: otherwise, Offset: question.Pos}, nil
+}
+
+// unexpectedAfterOperand возвращает ошибку для токена, который не может следовать за операндом
+func (p *parser) unexpectedAfterOperand(tok Token) error {
+	if tok.Kind == TokenOperator && tok.Value == TernaryElse {
+		return &SyntaxError{
+			Code:    ErrCodeMismatchedConditional,
+			Message: "mismatched conditional: ':' without '?'",
+			Offset:  tok.Pos,
+			Token:   tok.Text,
+		}
+	}
+
+	expected := expectedOperator
+	if p.calls > 0 {
+		expected = append(append([]string{}, expected...), ",")
+	}
+	return unexpected(tok, expected)
+}
+
+// unexpected возвращает ошибку для токена, который не может стоять на этой позиции
+func unexpected(tok Token, expected []string) error {
+	return &SyntaxError{
+		Code:     ErrCodeUnexpectedToken,
+		Message:  fmt.Sprintf("invalid expression: unexpected token %q", tok.Text),
+		Offset:   tok.Pos,
+		Token:    tok.Text,
+		Expected: expected,
+	}
+}
+
+func unclosedParen(open Token) error {
+	return &SyntaxError{
+		Code:     ErrCodeMismatchedParentheses,
+		Message:  "mismatched parentheses",
+		Offset:   open.Pos,
+		Token:    open.Text,
+		Expected: []string{")"},
+	}
+}
+
+func misplacedComma(tok Token) error {
+	return &SyntaxError{
+		Code:    ErrCodeMisplacedComma,
+		Message: "misplaced comma",
+		Offset:  tok.Pos,
+		Token:   tok.Text,
+	}
+}
@@ -0,0 +1,39 @@
+package ast
+
+import "fmt"
+
+// Visitor обрабатывает узлы дерева, возвращая для каждого значение типа T.
+// Обход дочерних узлов выполняет сам Visitor через Walk: так вычислитель
+// может не посещать невыбранную ветку условного оператора
+type Visitor[T any] interface {
+	VisitNumber(n *Number) (T, error)
+	VisitIdent(n *Ident) (T, error)
+	VisitUnary(n *UnaryOp) (T, error)
+	VisitBinary(n *BinaryOp) (T, error)
+	VisitCall(n *Call) (T, error)
+	VisitConditional(n *Conditional) (T, error)
+	VisitVector(n *Vector) (T, error)
+}
+
+// Walk передаёт узел соответствующему методу Visitor
+func Walk[T any](node Node, v Visitor[T]) (T, error) {
+	switch n := node.(type) {
+	case *Number:
+		return v.VisitNumber(n)
+	case *Ident:
+		return v.VisitIdent(n)
+	case *UnaryOp:
+		return v.VisitUnary(n)
+	case *BinaryOp:
+		return v.VisitBinary(n)
+	case *Call:
+		return v.VisitCall(n)
+	case *Conditional:
+		return v.VisitConditional(n)
+	case *Vector:
+		return v.VisitVector(n)
+	}
+
+	var zero T
+	return zero, fmt.Errorf("unknown node type %T", node)
+}
@@ -0,0 +1,135 @@
+package calculator
+
+import (
+	"fmt"
+	"gocalc/internal/ast"
+	"strconv"
+)
+
+// binder проверяет имена функций и заменяет переменные, константы и единицы измерения
+// числами: величина с единицей переводится в основные единицы СИ ("5 km" -> 5000),
+// а перевод "x to km" - в деление на множитель единицы. Имя единицы вне записи после
+// числа и вне перевода - неизвестная переменная ("s + 1").
+// Исходное имя сохраняется в Text числа, чтобы ошибки указывали на него
+type binder struct {
+	calc *Calculator
+}
+
+func (b binder) VisitNumber(n *ast.Number) (ast.Node, error) {
+	if n.Unit != "" {
+		return scaleQuantity(n)
+	}
+	return n, nil
+}
+
+func (b binder) VisitIdent(n *ast.Ident) (ast.Node, error) {
+	value, err := b.calc.resolveIdentifier(n.Name)
+	if err != nil {
+		return nil, &SyntaxError{
+			Code:    ErrCodeUndefinedVariable,
+			Message: err.Error(),
+			Offset:  n.Offset,
+			Token:   n.Name,
+		}
+	}
+	return &ast.Number{Value: strconv.FormatFloat(value, 'g', -1, 64), Text: n.Name, Offset: n.Offset}, nil
+}
+
+func (b binder) VisitUnary(n *ast.UnaryOp) (ast.Node, error) {
+	operand, err := ast.Walk[ast.Node](n.Operand, b)
+	if err != nil {
+		return nil, err
+	}
+	bound := *n
+	bound.Operand = operand
+	return &bound, nil
+}
+
+func (b binder) VisitBinary(n *ast.BinaryOp) (ast.Node, error) {
+	left, err := ast.Walk[ast.Node](n.Left, b)
+	if err != nil {
+		return nil, err
+	}
+	if n.Op == OpTo {
+		// Имена единиц допустимы только в записи единицы перевода
+		if _, _, ok := unitOf(n.Right); !ok {
+			return nil, &SyntaxError{
+				Code:    ErrCodeUnknownUnit,
+				Message: "unknown unit: conversion target must be a unit",
+				Offset:  n.Right.Pos(),
+			}
+		}
+		return &ast.BinaryOp{Op: "/", Left: left, Right: bindUnit(n.Right), Text: n.Text, Offset: n.Offset}, nil
+	}
+	right, err := ast.Walk[ast.Node](n.Right, b)
+	if err != nil {
+		return nil, err
+	}
+	bound := *n
+	bound.Left, bound.Right = left, right
+	return &bound, nil
+}
+
+func (b binder) VisitCall(n *ast.Call) (ast.Node, error) {
+	if !IsFunction(n.Name) && !IsTensorFunction(n.Name) {
+		return nil, &SyntaxError{
+			Code:    ErrCodeUnknownFunction,
+			Message: fmt.Sprintf("unknown function: %s", n.Text),
+			Offset:  n.Offset,
+			Token:   n.Text,
+		}
+	}
+
+	bound := *n
+	bound.Args = make([]ast.Node, len(n.Args))
+	for i, arg := range n.Args {
+		node, err := ast.Walk[ast.Node](arg, b)
+		if err != nil {
+			return nil, err
+		}
+		bound.Args[i] = node
+	}
+	return &bound, nil
+}
+
+func (b binder) VisitConditional(n *ast.Conditional) (ast.Node, error) {
+	var branches [3]ast.Node
+	for i, node := range []ast.Node{n.Cond, n.Then, n.Else} {
+		bound, err := ast.Walk[ast.Node](node, b)
+		if err != nil {
+			return nil, err
+		}
+		branches[i] = bound
+	}
+	return &ast.Conditional{Cond: branches[0], Then: branches[1], Else: branches[2], Offset: n.Offset}, nil
+}
+
+func (b binder) VisitVector(n *ast.Vector) (ast.Node, error) {
+	bound := *n
+	bound.Elements = make([]ast.Node, len(n.Elements))
+	for i, element := range n.Elements {
+		node, err := ast.Walk[ast.Node](element, b)
+		if err != nil {
+			return nil, err
+		}
+		bound.Elements[i] = node
+	}
+	return &bound, nil
+}
+
+// bindUnit заменяет имена единиц в записи единицы перевода их множителями:
+// "km/h" -> 1000 / 3600. Узел уже проверен unitOf
+func bindUnit(node ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.Ident:
+		return &ast.Number{Value: units[n.Name].scale, Text: n.Name, Offset: n.Offset}
+	case *ast.BinaryOp:
+		bound := *n
+		bound.Left = bindUnit(n.Left)
+		if n.Op != "^" {
+			bound.Right = bindUnit(n.Right)
+		}
+		return &bound
+	}
+	return node
+}
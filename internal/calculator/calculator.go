@@ -3,27 +3,43 @@ package calculator
 import (
 	"errors"
 	"fmt"
+	"gocalc/internal/ast"
 	"strconv"
 	"strings"
-	"unicode"
 )
 
 type TokenType string
 
 const (
-	Number     TokenType = "number"
-	Operator   TokenType = "operator"
-	LeftParen  TokenType = "left_paren"
-	RightParen TokenType = "right_paren"
+	Number        TokenType = "number"
+	Operator      TokenType = "operator"
+	UnaryOperator TokenType = "unary_operator"
+	Function      TokenType = "function"
+	Conditional   TokenType = "conditional" // Условный оператор "?:" в RPN (три операнда)
+	VectorLiteral TokenType = "vector"      // Литерал вектора в RPN (Arity элементов)
 )
 
+// Значения токенов унарных операторов
+const (
+	UnaryMinus = ast.UnaryMinus
+	UnaryPlus  = ast.UnaryPlus
+	UnaryNot   = ast.UnaryNot // Логическое отрицание "!"
+)
+
+// Token - элемент выражения в обратной польской записи
 type Token struct {
 	Type  TokenType
 	Value string
+	Arity int    // Количество аргументов вызова функции (заполняется в ToRPN)
+	Pos   int    // Смещение токена в исходном выражении (в байтах)
+	Text  string // Исходная запись токена ("-" для "neg", имя для подставленной переменной)
 }
 
 type Calculator struct {
-	tokens []Token
+	lexed     []ast.Token        // Токены последнего вызова Tokenize
+	source    string             // Исходное выражение последнего вызова Tokenize
+	variables map[string]float64 // Значения переменных, подставляемые при разборе
+	unit      string             // Единица измерения результата последнего разбора
 }
 
 func NewCalculator() *Calculator {
@@ -35,107 +51,176 @@ func Calc(expr string) (float64, error) {
 	return calc.Calculate(expr)
 }
 
+// CalcWithVariables вычисляет выражение, подставляя значения переменных
+func CalcWithVariables(expr string, variables map[string]float64) (float64, error) {
+	calc := NewCalculator()
+	calc.SetVariables(variables)
+	return calc.Calculate(expr)
+}
+
+// SetVariables задаёт значения переменных для последующих вызовов Parse и ToRPN.
+// Переменные имеют приоритет над встроенными константами (pi, e)
+func (c *Calculator) SetVariables(variables map[string]float64) {
+	c.variables = variables
+}
+
 func (c *Calculator) Calculate(expr string) (float64, error) {
-	if err := c.Tokenize(expr); err != nil {
-		return 0, fmt.Errorf("tokenization error: %v", err)
+	result, err := c.CalculateTensor(expr)
+	if err != nil {
+		return 0, err
 	}
+	if !result.IsScalar() {
+		return 0, fmt.Errorf("invalid expression: result is %s, expected number", ShapeString(result.Shape))
+	}
+	return result.Value(), nil
+}
 
-	rpn, err := c.ToRPN()
+// CalculateTensor вычисляет выражение, результат которого может быть вектором или матрицей
+func (c *Calculator) CalculateTensor(expr string) (Tensor, error) {
+	node, err := c.Parse(expr)
 	if err != nil {
-		return 0, fmt.Errorf("RPN conversion error: %v", err)
+		return Tensor{}, err
+	}
+	return ast.Walk[Tensor](node, evaluator{})
+}
+
+// Parse разбирает выражение в дерево, проверяет имена функций и подставляет
+// значения переменных и констант. Ошибки разбора - *SyntaxError с позицией
+func (c *Calculator) Parse(expr string) (ast.Node, error) {
+	if err := c.Tokenize(expr); err != nil {
+		return nil, fmt.Errorf("tokenization error: %w", err)
 	}
 
-	return c.EvaluateRPN(rpn)
+	node, err := c.parseTokens()
+	if err != nil {
+		return nil, fmt.Errorf("parse error: %w", err)
+	}
+	return node, nil
 }
 
+// Tokenize разбивает выражение на токены для последующего вызова ToRPN
 func (c *Calculator) Tokenize(expr string) error {
 	if expr == "" {
 		return errors.New("empty expression")
 	}
 
-	c.tokens = []Token{}
-	expr = strings.ReplaceAll(expr, " ", "")
-
-	for i := 0; i < len(expr); i++ {
-		char := expr[i]
+	tokens, err := ast.Lex(expr)
+	if err != nil {
+		return err
+	}
+	c.lexed = tokens
+	c.source = expr
+	return nil
+}
 
-		switch {
-		case char == '(':
-			c.tokens = append(c.tokens, Token{Type: LeftParen, Value: "("})
-		case char == ')':
-			c.tokens = append(c.tokens, Token{Type: RightParen, Value: ")"})
-		case char == '+' || char == '-' || char == '*' || char == '/':
-			c.tokens = append(c.tokens, Token{Type: Operator, Value: string(char)})
-		case unicode.IsDigit(rune(char)):
-			j := i
-			for j < len(expr) && (unicode.IsDigit(rune(expr[j])) || expr[j] == '.') {
-				j++
-			}
-			c.tokens = append(c.tokens, Token{Type: Number, Value: expr[i:j]})
-			i = j - 1
-		default:
-			return fmt.Errorf("invalid character: %c", char)
-		}
+// parseTokens строит дерево из токенов последнего вызова Tokenize
+func (c *Calculator) parseTokens() (ast.Node, error) {
+	node, err := ast.ParseTokens(c.source, c.lexed)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkUnits(node); err != nil {
+		return nil, err
 	}
+	return ast.Walk[ast.Node](node, binder{calc: c})
+}
 
-	return nil
+// resolveIdentifier возвращает значение переменной или встроенной константы
+func (c *Calculator) resolveIdentifier(name string) (float64, error) {
+	if value, ok := c.variables[name]; ok {
+		return value, nil
+	}
+	if value, ok := constants[strings.ToLower(name)]; ok {
+		return value, nil
+	}
+	return 0, fmt.Errorf("undefined variable: %s", name)
 }
 
+// ToRPN возвращает выражение последнего вызова Tokenize в обратной польской записи
 func (c *Calculator) ToRPN() ([]Token, error) {
-	var output []Token
-	var stack []Token
+	node, err := c.parseTokens()
+	if err != nil {
+		return nil, err
+	}
 
-	precedence := map[string]int{
-		"+": 1,
-		"-": 1,
-		"*": 2,
-		"/": 2,
+	builder := &rpnBuilder{}
+	if _, err := ast.Walk[struct{}](node, builder); err != nil {
+		return nil, err
 	}
+	return builder.output, nil
+}
 
-	for _, token := range c.tokens {
-		switch token.Type {
-		case Number:
-			output = append(output, token)
-		case Operator:
-			for len(stack) > 0 && stack[len(stack)-1].Type == Operator &&
-				precedence[stack[len(stack)-1].Value] >= precedence[token.Value] {
-				output = append(output, stack[len(stack)-1])
-				stack = stack[:len(stack)-1]
-			}
-			stack = append(stack, token)
-		case LeftParen:
-			stack = append(stack, token)
-		case RightParen:
-			foundLeftParen := false
-			for len(stack) > 0 {
-				top := stack[len(stack)-1]
-				stack = stack[:len(stack)-1]
-				if top.Type == LeftParen {
-					foundLeftParen = true
-					break
-				}
-				output = append(output, top)
-			}
-			if !foundLeftParen {
-				return nil, errors.New("mismatched parentheses")
-			}
+// rpnBuilder записывает дерево в обратной польской записи
+type rpnBuilder struct {
+	output []Token
+}
+
+func (b *rpnBuilder) VisitNumber(n *ast.Number) (struct{}, error) {
+	b.output = append(b.output, Token{Type: Number, Value: n.Value, Pos: n.Offset, Text: n.Text})
+	return struct{}{}, nil
+}
+
+func (b *rpnBuilder) VisitIdent(n *ast.Ident) (struct{}, error) {
+	return struct{}{}, fmt.Errorf("undefined variable: %s", n.Name)
+}
+
+func (b *rpnBuilder) VisitUnary(n *ast.UnaryOp) (struct{}, error) {
+	if _, err := ast.Walk[struct{}](n.Operand, b); err != nil {
+		return struct{}{}, err
+	}
+	b.output = append(b.output, Token{Type: UnaryOperator, Value: n.Op, Pos: n.Offset, Text: n.Text})
+	return struct{}{}, nil
+}
+
+func (b *rpnBuilder) VisitBinary(n *ast.BinaryOp) (struct{}, error) {
+	for _, operand := range []ast.Node{n.Left, n.Right} {
+		if _, err := ast.Walk[struct{}](operand, b); err != nil {
+			return struct{}{}, err
 		}
 	}
+	b.output = append(b.output, Token{Type: Operator, Value: n.Op, Pos: n.Offset, Text: n.Text})
+	return struct{}{}, nil
+}
+
+func (b *rpnBuilder) VisitCall(n *ast.Call) (struct{}, error) {
+	for _, arg := range n.Args {
+		if _, err := ast.Walk[struct{}](arg, b); err != nil {
+			return struct{}{}, err
+		}
+	}
+	b.output = append(b.output, Token{Type: Function, Value: n.Name, Arity: len(n.Args), Pos: n.Offset, Text: n.Text})
+	return struct{}{}, nil
+}
 
-	for len(stack) > 0 {
-		top := stack[len(stack)-1]
-		stack = stack[:len(stack)-1]
-		if top.Type == LeftParen {
-			return nil, errors.New("mismatched parentheses")
+func (b *rpnBuilder) VisitConditional(n *ast.Conditional) (struct{}, error) {
+	for _, operand := range []ast.Node{n.Cond, n.Then, n.Else} {
+		if _, err := ast.Walk[struct{}](operand, b); err != nil {
+			return struct{}{}, err
 		}
-		output = append(output, top)
 	}
+	b.output = append(b.output, Token{Type: Conditional, Value: OpConditional, Pos: n.Offset, Text: TernaryIf})
+	return struct{}{}, nil
+}
 
-	return output, nil
+func (b *rpnBuilder) VisitVector(n *ast.Vector) (struct{}, error) {
+	for _, element := range n.Elements {
+		if _, err := ast.Walk[struct{}](element, b); err != nil {
+			return struct{}{}, err
+		}
+	}
+	b.output = append(b.output, Token{Type: VectorLiteral, Value: "[]", Arity: len(n.Elements), Pos: n.Offset, Text: "["})
+	return struct{}{}, nil
 }
 
+// EvaluateRPN вычисляет выражение в RPN. Ошибка операции откладывается до использования
+// её результата, поэтому ошибка в невыбранной ветке "?:" не прерывает вычисление:
+// "x == 0 ? 0 : 1/x" при x = 0 равно 0. Векторы и матрицы вычисляет только CalculateTensor
 func (c *Calculator) EvaluateRPN(rpn []Token) (float64, error) {
-	var stack []float64
+	type value struct {
+		num float64
+		err error
+	}
+	var stack []value
 
 	for _, token := range rpn {
 		switch token.Type {
@@ -144,7 +229,37 @@ func (c *Calculator) EvaluateRPN(rpn []Token) (float64, error) {
 			if err != nil {
 				return 0, fmt.Errorf("invalid number: %s", token.Value)
 			}
-			stack = append(stack, num)
+			stack = append(stack, value{num: num})
+		case Function:
+			if len(stack) < token.Arity {
+				return 0, errors.New("invalid expression")
+			}
+
+			operands := stack[len(stack)-token.Arity:]
+			stack = stack[:len(stack)-token.Arity]
+
+			var result value
+			args := make([]float64, token.Arity)
+			for i, operand := range operands {
+				if operand.err != nil {
+					result.err = operand.err
+					break
+				}
+				args[i] = operand.num
+			}
+			if result.err == nil {
+				result.num, result.err = ApplyFunction(token.Value, args)
+			}
+			stack = append(stack, result)
+		case UnaryOperator:
+			if len(stack) < 1 {
+				return 0, errors.New("invalid expression")
+			}
+
+			operand := &stack[len(stack)-1]
+			if operand.err == nil {
+				operand.num, operand.err = ApplyUnaryOperator(token.Value, operand.num)
+			}
 		case Operator:
 			if len(stack) < 2 {
 				return 0, errors.New("invalid expression")
@@ -154,22 +269,32 @@ func (c *Calculator) EvaluateRPN(rpn []Token) (float64, error) {
 			a := stack[len(stack)-2]
 			stack = stack[:len(stack)-2]
 
-			var result float64
-			switch token.Value {
-			case "+":
-				result = a + b
-			case "-":
-				result = a - b
-			case "*":
-				result = a * b
-			case "/":
-				if b == 0 {
-					return 0, errors.New("division by zero")
-				}
-				result = a / b
+			result := value{err: a.err}
+			if result.err == nil {
+				result.err = b.err
+			}
+			if result.err == nil {
+				result.num, result.err = ApplyOperator(token.Value, a.num, b.num)
 			}
-
 			stack = append(stack, result)
+		case VectorLiteral:
+			return 0, errors.New("vectors are not supported in RPN evaluation")
+		case Conditional:
+			if len(stack) < 3 {
+				return 0, errors.New("invalid expression")
+			}
+
+			cond, then, otherwise := stack[len(stack)-3], stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-3]
+
+			switch {
+			case cond.err != nil:
+				stack = append(stack, cond)
+			case cond.num != 0:
+				stack = append(stack, then)
+			default:
+				stack = append(stack, otherwise)
+			}
 		}
 	}
 
@@ -177,5 +302,5 @@ func (c *Calculator) EvaluateRPN(rpn []Token) (float64, error) {
 		return 0, errors.New("invalid expression")
 	}
 
-	return stack[0], nil
+	return stack[0].num, stack[0].err
 }
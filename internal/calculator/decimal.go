@@ -0,0 +1,316 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"gocalc/internal/ast"
+	"math/big"
+	"strings"
+)
+
+// Режимы точности вычислений
+const (
+	PrecisionFloat    = "float"    // float64 (по умолчанию)
+	PrecisionDecimal  = "decimal"  // точная рациональная арифметика на math/big
+	PrecisionInterval = "interval" // интервальная арифметика: числа с погрешностью
+)
+
+// Максимальный модуль целого показателя степени в точном режиме
+const maxDecimalExponent = 10000
+
+// IsValidPrecision проверяет, поддерживается ли режим точности ("" - режим по умолчанию)
+func IsValidPrecision(precision string) bool {
+	return precision == "" || precision == PrecisionFloat || precision == PrecisionDecimal ||
+		precision == PrecisionInterval
+}
+
+// ParseDecimal разбирает число в точном режиме: десятичную запись ("0.1", "1e-3") или дробь ("1/3")
+func ParseDecimal(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid number: %s", s)
+	}
+	return r, nil
+}
+
+// FormatDecimal возвращает точное текстовое представление числа:
+// конечную десятичную дробь ("0.3"), если она существует, иначе обыкновенную дробь ("1/3")
+func FormatDecimal(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+
+	// Десятичная запись конечна, только если знаменатель имеет вид 2^a * 5^b
+	denom := new(big.Int).Set(r.Denom())
+	two, five := big.NewInt(2), big.NewInt(5)
+	var twos, fives int
+	mod := new(big.Int)
+	for {
+		quo, m := new(big.Int).QuoRem(denom, two, mod)
+		if m.Sign() != 0 {
+			break
+		}
+		denom = quo
+		twos++
+	}
+	for {
+		quo, m := new(big.Int).QuoRem(denom, five, mod)
+		if m.Sign() != 0 {
+			break
+		}
+		denom = quo
+		fives++
+	}
+
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		return r.RatString()
+	}
+
+	digits := twos
+	if fives > digits {
+		digits = fives
+	}
+	return r.FloatString(digits)
+}
+
+// CalculateDecimal вычисляет выражение в точном режиме
+func (c *Calculator) CalculateDecimal(expr string) (*big.Rat, error) {
+	node, err := c.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return ast.Walk[*big.Rat](node, decimalEvaluator{})
+}
+
+// decimalEvaluator вычисляет дерево без потери точности
+type decimalEvaluator struct{}
+
+func (e decimalEvaluator) VisitNumber(n *ast.Number) (*big.Rat, error) {
+	return ParseDecimal(n.Value)
+}
+
+func (e decimalEvaluator) VisitIdent(n *ast.Ident) (*big.Rat, error) {
+	return nil, fmt.Errorf("undefined variable: %s", n.Name)
+}
+
+func (e decimalEvaluator) VisitUnary(n *ast.UnaryOp) (*big.Rat, error) {
+	operand, err := ast.Walk[*big.Rat](n.Operand, e)
+	if err != nil {
+		return nil, err
+	}
+	return ApplyDecimal(n.Op, []*big.Rat{operand})
+}
+
+func (e decimalEvaluator) VisitBinary(n *ast.BinaryOp) (*big.Rat, error) {
+	a, err := ast.Walk[*big.Rat](n.Left, e)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ast.Walk[*big.Rat](n.Right, e)
+	if err != nil {
+		return nil, err
+	}
+	return ApplyDecimal(n.Op, []*big.Rat{a, b})
+}
+
+func (e decimalEvaluator) VisitCall(n *ast.Call) (*big.Rat, error) {
+	args := make([]*big.Rat, len(n.Args))
+	for i, arg := range n.Args {
+		value, err := ast.Walk[*big.Rat](arg, e)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return ApplyDecimal(n.Name, args)
+}
+
+func (e decimalEvaluator) VisitConditional(n *ast.Conditional) (*big.Rat, error) {
+	cond, err := ast.Walk[*big.Rat](n.Cond, e)
+	if err != nil {
+		return nil, err
+	}
+	if cond.Sign() != 0 {
+		return ast.Walk[*big.Rat](n.Then, e)
+	}
+	return ast.Walk[*big.Rat](n.Else, e)
+}
+
+func (e decimalEvaluator) VisitVector(n *ast.Vector) (*big.Rat, error) {
+	return nil, errors.New("vectors are not supported in decimal mode")
+}
+
+// ApplyDecimal выполняет операцию или встроенную функцию в точном режиме.
+// Используется и калькулятором, и агентами
+func ApplyDecimal(operation string, args []*big.Rat) (*big.Rat, error) {
+	switch operation {
+	case UnaryPlus:
+		if len(args) != 1 {
+			return nil, errors.New("invalid expression")
+		}
+		return new(big.Rat).Set(args[0]), nil
+	case UnaryMinus:
+		if len(args) != 1 {
+			return nil, errors.New("invalid expression")
+		}
+		return new(big.Rat).Neg(args[0]), nil
+	case UnaryNot:
+		if len(args) != 1 {
+			return nil, errors.New("invalid expression")
+		}
+		return new(big.Rat).SetFloat64(boolValue(args[0].Sign() == 0)), nil
+	case "+", "-", "*", "/", "^":
+		if len(args) != 2 {
+			return nil, errors.New("invalid expression")
+		}
+		a, b := args[0], args[1]
+		switch operation {
+		case "+":
+			return new(big.Rat).Add(a, b), nil
+		case "-":
+			return new(big.Rat).Sub(a, b), nil
+		case "*":
+			return new(big.Rat).Mul(a, b), nil
+		case "/":
+			if b.Sign() == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return new(big.Rat).Quo(a, b), nil
+		default:
+			return powDecimal(a, b)
+		}
+	case OpModulo, OpIntDivide, OpBitAnd, OpBitOr, OpBitXor, OpShiftLeft, OpShiftRight:
+		if len(args) != 2 {
+			return nil, errors.New("invalid expression")
+		}
+		return applyIntegerDecimal(operation, args[0], args[1])
+	case OpLess, OpLessEqual, OpGreater, OpGreaterEqual, OpEqual, OpNotEqual, OpAnd, OpOr:
+		if len(args) != 2 {
+			return nil, errors.New("invalid expression")
+		}
+		return applyComparisonDecimal(operation, args[0], args[1])
+	case OpMatMul:
+		return nil, errors.New("matrix product is not supported in decimal mode")
+	case OpPlusMinus:
+		return nil, errIntervalPrecision
+	}
+
+	name := strings.ToLower(operation)
+	if IsTensorFunction(name) {
+		return nil, fmt.Errorf("function %s is not supported in decimal mode", name)
+	}
+	fn, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s", operation)
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("invalid number of arguments for %s: %d", operation, len(args))
+	}
+
+	switch name {
+	case "abs":
+		return new(big.Rat).Abs(args[0]), nil
+	case "min", "max":
+		result := args[0]
+		for _, arg := range args[1:] {
+			if (name == "min" && arg.Cmp(result) < 0) || (name == "max" && arg.Cmp(result) > 0) {
+				result = arg
+			}
+		}
+		return new(big.Rat).Set(result), nil
+	case "round":
+		digits := int64(0)
+		if len(args) == 2 {
+			if !args[1].IsInt() || !args[1].Num().IsInt64() {
+				return nil, errors.New("invalid function argument: round precision must be integer")
+			}
+			digits = args[1].Num().Int64()
+		}
+		return roundDecimal(args[0], digits), nil
+	case "sqrt":
+		return sqrtDecimal(args[0])
+	case "sum":
+		return sumDecimal(args), nil
+	case "avg":
+		return avgDecimal(args), nil
+	case "median":
+		return percentileDecimal(big.NewRat(50, 1), args)
+	case "variance":
+		return varianceDecimal(args), nil
+	case "stddev":
+		return sqrtDecimal(varianceDecimal(args))
+	case "percentile":
+		return percentileDecimal(args[0], args[1:])
+	}
+
+	return nil, fmt.Errorf("function %s is not supported in decimal mode", name)
+}
+
+// powDecimal возводит число в целую степень
+func powDecimal(a, b *big.Rat) (*big.Rat, error) {
+	if !b.IsInt() {
+		return nil, errors.New("non-integer exponent is not supported in decimal mode")
+	}
+	if !b.Num().IsInt64() || b.Num().Int64() > maxDecimalExponent || b.Num().Int64() < -maxDecimalExponent {
+		return nil, errors.New("invalid exponentiation")
+	}
+
+	exp := b.Num().Int64()
+	if a.Sign() == 0 && exp < 0 {
+		return nil, errors.New("invalid exponentiation")
+	}
+
+	abs := exp
+	if abs < 0 {
+		abs = -abs
+	}
+	e := big.NewInt(abs)
+	num := new(big.Int).Exp(a.Num(), e, nil)
+	denom := new(big.Int).Exp(a.Denom(), e, nil)
+
+	if exp < 0 {
+		num, denom = denom, num
+	}
+	return new(big.Rat).SetFrac(num, denom), nil
+}
+
+// roundDecimal округляет число до digits знаков после запятой (половина - от нуля)
+func roundDecimal(r *big.Rat, digits int64) *big.Rat {
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(absInt64(digits)), nil))
+	if digits < 0 {
+		scale.Inv(scale)
+	}
+
+	scaled := new(big.Rat).Mul(r, scale)
+	half := big.NewRat(1, 2)
+	if scaled.Sign() < 0 {
+		scaled.Sub(scaled, half)
+	} else {
+		scaled.Add(scaled, half)
+	}
+
+	// Quo округляет к нулю, что вместе с добавленной половиной даёт округление от нуля
+	truncated := new(big.Int).Quo(scaled.Num(), scaled.Denom())
+	return new(big.Rat).Quo(new(big.Rat).SetInt(truncated), scale)
+}
+
+// sqrtDecimal извлекает корень, если он представим точно
+func sqrtDecimal(r *big.Rat) (*big.Rat, error) {
+	if r.Sign() < 0 {
+		return nil, errors.New("invalid function argument: sqrt of negative number")
+	}
+
+	num := new(big.Int).Sqrt(r.Num())
+	denom := new(big.Int).Sqrt(r.Denom())
+	if new(big.Int).Mul(num, num).Cmp(r.Num()) != 0 || new(big.Int).Mul(denom, denom).Cmp(r.Denom()) != 0 {
+		return nil, errors.New("inexact sqrt is not supported in decimal mode")
+	}
+	return new(big.Rat).SetFrac(num, denom), nil
+}
+
+func absInt64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
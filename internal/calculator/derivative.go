@@ -0,0 +1,344 @@
+package calculator
+
+import (
+	"fmt"
+	"gocalc/internal/ast"
+	"math"
+	"strconv"
+)
+
+// Differentiate разбирает выражение и возвращает каноническую запись его упрощённой
+// производной по переменной variable. Остальные имена считаются константами
+func Differentiate(expr, variable string) (string, error) {
+	tokens, err := ast.Lex(variable)
+	if err != nil || len(tokens) != 1 || tokens[0].Kind != ast.TokenIdent {
+		return "", fmt.Errorf("invalid variable name: %q", variable)
+	}
+
+	node, err := ast.Parse(expr)
+	if err != nil {
+		return "", err
+	}
+	derivative, err := ast.Walk[ast.Node](node, differentiator{variable: variable})
+	if err != nil {
+		return "", err
+	}
+	return Format(derivative), nil
+}
+
+// differentiator строит дерево производной по правилам дифференцирования.
+// Производные собираются через конструкторы sum, product и т.д., которые сразу
+// упрощают результат: 0 * u = 0, 1 * u = u, u ^ 1 = u, операции над числами вычисляются
+type differentiator struct {
+	variable string
+}
+
+func (d differentiator) VisitNumber(n *ast.Number) (ast.Node, error) {
+	return number(0), nil
+}
+
+func (d differentiator) VisitIdent(n *ast.Ident) (ast.Node, error) {
+	if n.Name == d.variable {
+		return number(1), nil
+	}
+	return number(0), nil
+}
+
+func (d differentiator) VisitUnary(n *ast.UnaryOp) (ast.Node, error) {
+	du, err := ast.Walk[ast.Node](n.Operand, d)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Op {
+	case UnaryPlus:
+		return du, nil
+	case UnaryMinus:
+		return negate(du), nil
+	}
+	return nil, fmt.Errorf("operator %s is not differentiable", n.Text)
+}
+
+func (d differentiator) VisitBinary(n *ast.BinaryOp) (ast.Node, error) {
+	u, v := n.Left, n.Right
+	du, err := ast.Walk[ast.Node](u, d)
+	if err != nil {
+		return nil, err
+	}
+	dv, err := ast.Walk[ast.Node](v, d)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Op {
+	case "+":
+		return sum(du, dv), nil
+	case "-":
+		return difference(du, dv), nil
+	case "*":
+		// (u * v)' = u' * v + u * v'
+		return sum(product(du, v), product(u, dv)), nil
+	case "/":
+		if isZero(dv) {
+			// (u / c)' = u' / c
+			return quotient(du, v), nil
+		}
+		// (u / v)' = (u' * v - u * v') / v ^ 2
+		return quotient(difference(product(du, v), product(u, dv)), power(v, number(2))), nil
+	case "^":
+		switch {
+		case isZero(dv):
+			// (u ^ c)' = c * u ^ (c - 1) * u'
+			return product(product(v, power(u, difference(v, number(1)))), du), nil
+		case isZero(du):
+			// (c ^ v)' = c ^ v * log(c) * v'
+			return product(product(n, call("log", u)), dv), nil
+		}
+		// (u ^ v)' = u ^ v * (v' * log(u) + v * u' / u)
+		return product(n, sum(product(dv, call("log", u)), quotient(product(v, du), u))), nil
+	}
+	return nil, fmt.Errorf("operator %s is not differentiable", n.Text)
+}
+
+func (d differentiator) VisitCall(n *ast.Call) (ast.Node, error) {
+	derivatives := make([]ast.Node, len(n.Args))
+	for i, arg := range n.Args {
+		du, err := ast.Walk[ast.Node](arg, d)
+		if err != nil {
+			return nil, err
+		}
+		derivatives[i] = du
+	}
+
+	switch {
+	case n.Name == "sqrt" && len(n.Args) == 1:
+		// sqrt(u)' = u' / (2 * sqrt(u))
+		return quotient(derivatives[0], product(number(2), n)), nil
+	case n.Name == "sin" && len(n.Args) == 1:
+		return product(call("cos", n.Args[0]), derivatives[0]), nil
+	case n.Name == "cos" && len(n.Args) == 1:
+		return negate(product(call("sin", n.Args[0]), derivatives[0])), nil
+	case n.Name == "abs" && len(n.Args) == 1:
+		// abs(u)' = u / abs(u) * u'
+		return product(quotient(n.Args[0], n), derivatives[0]), nil
+	case n.Name == "log" && len(n.Args) == 1:
+		return quotient(derivatives[0], n.Args[0]), nil
+	case n.Name == "sum" || n.Name == "avg":
+		// Сумма и среднее линейны: производная - сумма (среднее) производных аргументов
+		result := derivatives[0]
+		for _, du := range derivatives[1:] {
+			result = sum(result, du)
+		}
+		if n.Name == "avg" {
+			count := float64(len(derivatives))
+			if a, rest, ok := coefficient(result); ok {
+				return product(number(a/count), rest), nil
+			}
+			return quotient(result, number(count)), nil
+		}
+		return result, nil
+	case n.Name == "log" && len(n.Args) == 2:
+		// log(u, b) = log(u) / log(b)
+		return d.VisitBinary(&ast.BinaryOp{Op: "/", Left: call("log", n.Args[0]), Right: call("log", n.Args[1])})
+	}
+	return nil, fmt.Errorf("function %s is not differentiable", n.Name)
+}
+
+func (d differentiator) VisitConditional(n *ast.Conditional) (ast.Node, error) {
+	then, err := ast.Walk[ast.Node](n.Then, d)
+	if err != nil {
+		return nil, err
+	}
+	otherwise, err := ast.Walk[ast.Node](n.Else, d)
+	if err != nil {
+		return nil, err
+	}
+	// Производная кусочной функции кусочна с теми же условиями
+	if a, ok := numberValue(then); ok && isNumber(otherwise, a) {
+		return then, nil
+	}
+	return &ast.Conditional{Cond: n.Cond, Then: then, Else: otherwise}, nil
+}
+
+// Производная вектора берётся поэлементно
+func (d differentiator) VisitVector(n *ast.Vector) (ast.Node, error) {
+	derivative := &ast.Vector{Elements: make([]ast.Node, len(n.Elements))}
+	for i, element := range n.Elements {
+		du, err := ast.Walk[ast.Node](element, d)
+		if err != nil {
+			return nil, err
+		}
+		derivative.Elements[i] = du
+	}
+	return derivative, nil
+}
+
+// number создаёт числовой литерал
+func number(value float64) ast.Node {
+	if value == 0 {
+		value = 0 // -0 записывается как 0
+	}
+	text := strconv.FormatFloat(value, 'g', -1, 64)
+	return &ast.Number{Value: text, Text: text}
+}
+
+// numberValue возвращает значение литерала, в том числе со знаком ("-1" разбирается как унарный минус)
+func numberValue(node ast.Node) (float64, bool) {
+	switch n := node.(type) {
+	case *ast.Number:
+		// Число с единицей остаётся множителем: иначе при упрощении единица потеряется
+		if n.Unit != "" {
+			return 0, false
+		}
+		value, err := strconv.ParseFloat(n.Value, 64)
+		return value, err == nil
+	case *ast.UnaryOp:
+		value, ok := numberValue(n.Operand)
+		switch n.Op {
+		case UnaryMinus:
+			return -value, ok
+		case UnaryPlus:
+			return value, ok
+		}
+	}
+	return 0, false
+}
+
+func isNumber(node ast.Node, value float64) bool {
+	v, ok := numberValue(node)
+	return ok && v == value
+}
+
+func isZero(node ast.Node) bool {
+	return isNumber(node, 0)
+}
+
+// sameNode проверяет, что деревья записываются одинаково
+func sameNode(u, v ast.Node) bool {
+	return Format(u) == Format(v)
+}
+
+// coefficient разделяет произведение на числовой множитель и остальную часть: 3 * x -> 3, x
+func coefficient(node ast.Node) (float64, ast.Node, bool) {
+	if p, ok := node.(*ast.BinaryOp); ok && p.Op == "*" {
+		if value, ok := numberValue(p.Left); ok {
+			return value, p.Right, true
+		}
+	}
+	return 0, nil, false
+}
+
+// fold вычисляет операцию над двумя числами. Результат оставляется только
+// конечным и целым для "/" и "^", чтобы в производной не появлялись приближения вроде 0.3333333333333333
+func fold(op string, left, right ast.Node) (ast.Node, bool) {
+	a, ok := numberValue(left)
+	if !ok {
+		return nil, false
+	}
+	b, ok := numberValue(right)
+	if !ok {
+		return nil, false
+	}
+	result, err := ApplyOperator(op, a, b)
+	if err != nil || math.IsInf(result, 0) || math.IsNaN(result) {
+		return nil, false
+	}
+	if (op == "/" || op == "^") && result != math.Trunc(result) {
+		return nil, false
+	}
+	return number(result), true
+}
+
+func binary(op string, left, right ast.Node) ast.Node {
+	if folded, ok := fold(op, left, right); ok {
+		return folded
+	}
+	return &ast.BinaryOp{Op: op, Left: left, Right: right, Text: op}
+}
+
+func sum(u, v ast.Node) ast.Node {
+	switch {
+	case isZero(u):
+		return v
+	case isZero(v):
+		return u
+	}
+	return binary("+", u, v)
+}
+
+func difference(u, v ast.Node) ast.Node {
+	switch {
+	case isZero(v):
+		return u
+	case isZero(u):
+		return negate(v)
+	case sameNode(u, v):
+		return number(0)
+	}
+	return binary("-", u, v)
+}
+
+func product(u, v ast.Node) ast.Node {
+	switch {
+	case isZero(u) || isZero(v):
+		return number(0)
+	case isNumber(u, 1):
+		return v
+	case isNumber(v, 1):
+		return u
+	case isNumber(u, -1):
+		return negate(v)
+	case isNumber(v, -1):
+		return negate(u)
+	}
+
+	// Числовой множитель ставится первым и объединяется с множителем второго операнда: 3 * (2 * x) = 6 * x
+	if _, ok := numberValue(v); ok {
+		u, v = v, u
+	}
+	if a, ok := numberValue(u); ok {
+		if b, rest, ok := coefficient(v); ok {
+			return product(number(a*b), rest)
+		}
+	}
+	return binary("*", u, v)
+}
+
+func quotient(u, v ast.Node) ast.Node {
+	switch {
+	case isZero(u):
+		return number(0)
+	case isNumber(v, 1):
+		return u
+	case sameNode(u, v):
+		return number(1)
+	}
+	return binary("/", u, v)
+}
+
+func power(u, v ast.Node) ast.Node {
+	switch {
+	case isZero(v):
+		return number(1)
+	case isNumber(v, 1):
+		return u
+	}
+	return binary("^", u, v)
+}
+
+func negate(u ast.Node) ast.Node {
+	if value, ok := numberValue(u); ok {
+		return number(-value)
+	}
+	if unary, ok := u.(*ast.UnaryOp); ok && unary.Op == UnaryMinus {
+		return unary.Operand
+	}
+	if a, rest, ok := coefficient(u); ok {
+		return product(number(-a), rest)
+	}
+	return &ast.UnaryOp{Op: UnaryMinus, Operand: u, Text: "-"}
+}
+
+func call(name string, args ...ast.Node) ast.Node {
+	return &ast.Call{Name: name, Args: args, Text: name}
+}
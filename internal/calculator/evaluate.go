@@ -0,0 +1,171 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"gocalc/internal/ast"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedPrecision - режим точности не поддерживается (см. IsValidPrecision)
+var ErrUnsupportedPrecision = errors.New("unsupported precision")
+
+// EvaluationError - выражение не может быть вычислено: синтаксическая ошибка,
+// недопустимая операция или аргумент, конструкция, не поддерживаемая в режиме точности.
+// Это ошибка в самом выражении, а не в работе сервиса; позицию синтаксической
+// ошибки возвращает AsSyntaxError
+type EvaluationError struct {
+	Err error
+}
+
+func (e *EvaluationError) Error() string {
+	// Этапы разбора, на которых возникла ошибка, клиенту не нужны
+	message := strings.TrimPrefix(e.Err.Error(), "tokenization error: ")
+	return strings.TrimPrefix(message, "parse error: ")
+}
+
+func (e *EvaluationError) Unwrap() error {
+	return e.Err
+}
+
+// IsEvaluationError проверяет, что ошибка вызвана самим выражением
+func IsEvaluationError(err error) bool {
+	var evalErr *EvaluationError
+	return errors.As(err, &evalErr)
+}
+
+// EvaluateOptions - параметры вычисления выражения
+type EvaluateOptions struct {
+	Precision string             // PrecisionFloat ("" - по умолчанию), PrecisionDecimal или PrecisionInterval
+	Variables map[string]float64 // Значения переменных
+}
+
+// Result - результат вычисления выражения
+type Result struct {
+	Value     float64  // Значение; в режиме interval - середина интервала
+	Text      string   // Точная запись в режиме decimal или интервал "[4.8, 5.2]" в режиме interval
+	Low, High *float64 // Границы интервала в режиме interval
+	Tensor    *Tensor  // Результат-вектор или матрица
+	Unit      string   // Единица измерения результата ("km/h")
+}
+
+// Evaluate вычисляет выражение в режиме точности opts.Precision. Ошибка выражения
+// возвращается как *EvaluationError, неизвестный режим - ErrUnsupportedPrecision
+func Evaluate(expr string, opts EvaluateOptions) (Result, error) {
+	if !IsValidPrecision(opts.Precision) {
+		return Result{}, ErrUnsupportedPrecision
+	}
+	calc := NewCalculator()
+	calc.SetVariables(opts.Variables)
+
+	var result Result
+	var err error
+	switch opts.Precision {
+	case PrecisionDecimal:
+		var exact *big.Rat
+		if exact, err = calc.CalculateDecimal(expr); err == nil {
+			result.Value, _ = exact.Float64()
+			result.Text = FormatDecimal(exact)
+		}
+	case PrecisionInterval:
+		var value Interval
+		if value, err = calc.CalculateInterval(expr); err == nil {
+			result.Value = value.Mid()
+			result.Text = FormatInterval(value)
+			result.Low, result.High = &value.Low, &value.High
+		}
+	default:
+		var value Tensor
+		if value, err = calc.CalculateTensor(expr); err == nil {
+			result.Value = value.Value()
+			if !value.IsScalar() {
+				result.Tensor = &value
+			}
+		}
+	}
+	if err != nil {
+		return Result{}, &EvaluationError{Err: err}
+	}
+	result.Unit = calc.Unit()
+	return result, nil
+}
+
+// evaluator вычисляет дерево в числах float64, векторах и матрицах. Условный оператор
+// вычисляет только выбранную ветку: "x == 0 ? 0 : 1/x" при x = 0 равно 0
+type evaluator struct{}
+
+func (e evaluator) VisitNumber(n *ast.Number) (Tensor, error) {
+	num, err := strconv.ParseFloat(n.Value, 64)
+	if err != nil {
+		return Tensor{}, fmt.Errorf("invalid number: %s", n.Value)
+	}
+	return Scalar(num), nil
+}
+
+func (e evaluator) VisitIdent(n *ast.Ident) (Tensor, error) {
+	return Tensor{}, fmt.Errorf("undefined variable: %s", n.Name)
+}
+
+func (e evaluator) VisitUnary(n *ast.UnaryOp) (Tensor, error) {
+	operand, err := ast.Walk[Tensor](n.Operand, e)
+	if err != nil {
+		return Tensor{}, err
+	}
+	return ApplyTensor(n.Op, []Tensor{operand})
+}
+
+func (e evaluator) VisitBinary(n *ast.BinaryOp) (Tensor, error) {
+	a, err := ast.Walk[Tensor](n.Left, e)
+	if err != nil {
+		return Tensor{}, err
+	}
+	b, err := ast.Walk[Tensor](n.Right, e)
+	if err != nil {
+		return Tensor{}, err
+	}
+	return ApplyTensor(n.Op, []Tensor{a, b})
+}
+
+func (e evaluator) VisitCall(n *ast.Call) (Tensor, error) {
+	args, err := e.walkAll(n.Args)
+	if err != nil {
+		return Tensor{}, err
+	}
+	return ApplyTensor(n.Name, args)
+}
+
+func (e evaluator) VisitConditional(n *ast.Conditional) (Tensor, error) {
+	cond, err := ast.Walk[Tensor](n.Cond, e)
+	if err != nil {
+		return Tensor{}, err
+	}
+	if !cond.IsScalar() {
+		return Tensor{}, errors.New("invalid condition: condition must be a number")
+	}
+	if cond.Value() != 0 {
+		return ast.Walk[Tensor](n.Then, e)
+	}
+	return ast.Walk[Tensor](n.Else, e)
+}
+
+func (e evaluator) VisitVector(n *ast.Vector) (Tensor, error) {
+	elements, err := e.walkAll(n.Elements)
+	if err != nil {
+		return Tensor{}, err
+	}
+	return StackTensors(elements)
+}
+
+func (e evaluator) walkAll(nodes []ast.Node) ([]Tensor, error) {
+	values := make([]Tensor, len(nodes))
+	for i, node := range nodes {
+		value, err := ast.Walk[Tensor](node, e)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,173 @@
+package calculator
+
+import (
+	"gocalc/internal/ast"
+	"strings"
+)
+
+// Приоритет операнда, которому никогда не нужны скобки: число, переменная, вызов функции, вектор
+const atomPrecedence = 100
+
+// Записи унарных операторов в канонической форме
+var unarySpelling = map[string]string{
+	UnaryMinus: "-",
+	UnaryNot:   "!",
+}
+
+// formatted - запись подвыражения и приоритет её внешнего оператора
+type formatted struct {
+	text       string
+	precedence int
+}
+
+// formatter записывает дерево выражения в каноническом виде:
+// операторы в основном написании ("^" вместо "**"), пробелы вокруг бинарных операторов
+// и после запятых, скобки только там, где без них изменится порядок вычисления
+type formatter struct{}
+
+// Canonicalize разбирает выражение и возвращает его каноническую запись.
+// Переменные не подставляются, поэтому одинаковые выражения с разными
+// значениями переменных имеют одинаковую каноническую форму
+func Canonicalize(expr string) (string, error) {
+	node, err := ast.Parse(expr)
+	if err != nil {
+		return "", err
+	}
+	return Format(node), nil
+}
+
+// Format возвращает каноническую запись дерева выражения
+func Format(node ast.Node) string {
+	result, err := ast.Walk[formatted](node, formatter{})
+	if err != nil {
+		return ""
+	}
+	return result.text
+}
+
+// formatNumber приводит запись числа к десятичной без лишних нулей ("0x1F" -> "31", "1.50" -> "1.5").
+// Числа с порядком сохраняют его, чтобы "1e-30" не превратилось в длинную дробь
+func formatNumber(value string) string {
+	if strings.ContainsAny(value, "eE") {
+		return strings.ToLower(value)
+	}
+	exact, err := ParseDecimal(value)
+	if err != nil {
+		return value
+	}
+	return FormatDecimal(exact)
+}
+
+// binaryParens определяет, нужны ли скобки операндам бинарного оператора
+func binaryParens(op string, left, right formatted) (leftParens, rightParens bool) {
+	precedence := ast.Precedence(op)
+	rightAssoc := ast.IsRightAssociative(op)
+
+	leftParens = left.precedence < precedence || (left.precedence == precedence && rightAssoc)
+	// Префиксный оператор справа не требует скобок даже у "^": 2 ^ -1
+	rightParens = right.precedence != ast.UnaryPrecedence &&
+		(right.precedence < precedence || (right.precedence == precedence && !rightAssoc))
+	return leftParens, rightParens
+}
+
+func parenthesize(operand formatted, needed bool) string {
+	if needed {
+		return "(" + operand.text + ")"
+	}
+	return operand.text
+}
+
+func (f formatter) VisitNumber(n *ast.Number) (formatted, error) {
+	text := formatNumber(n.Value)
+	if n.Unit != "" {
+		// Число с единицей - один литерал ("5 km / 2 h"), но в основании степени
+		// нужны скобки: "2 m ^ 2" означает 2 квадратных метра, а не (2 m)^2
+		return formatted{text: text + " " + n.Unit, precedence: ast.UnaryPrecedence}, nil
+	}
+	if strings.HasPrefix(text, "-") {
+		// Отрицательное число после подстановки переменной записывается как унарный минус
+		return formatted{text: text, precedence: ast.UnaryPrecedence}, nil
+	}
+	return formatted{text: text, precedence: atomPrecedence}, nil
+}
+
+func (f formatter) VisitIdent(n *ast.Ident) (formatted, error) {
+	return formatted{text: n.Name, precedence: atomPrecedence}, nil
+}
+
+func (f formatter) VisitUnary(n *ast.UnaryOp) (formatted, error) {
+	operand, err := ast.Walk[formatted](n.Operand, f)
+	if err != nil {
+		return formatted{}, err
+	}
+	// Унарный плюс не меняет значения и в канонической форме опускается
+	if n.Op == UnaryPlus {
+		return operand, nil
+	}
+
+	text := unarySpelling[n.Op] + parenthesize(operand, operand.precedence < ast.UnaryPrecedence)
+	return formatted{text: text, precedence: ast.UnaryPrecedence}, nil
+}
+
+func (f formatter) VisitBinary(n *ast.BinaryOp) (formatted, error) {
+	left, err := ast.Walk[formatted](n.Left, f)
+	if err != nil {
+		return formatted{}, err
+	}
+	right, err := ast.Walk[formatted](n.Right, f)
+	if err != nil {
+		return formatted{}, err
+	}
+
+	if n.Op == OpTo {
+		return formatted{text: left.text + " " + OpTo + " " + strings.ReplaceAll(right.text, " ", "")}, nil
+	}
+
+	leftParens, rightParens := binaryParens(n.Op, left, right)
+	text := parenthesize(left, leftParens) + " " + n.Op + " " + parenthesize(right, rightParens)
+	return formatted{text: text, precedence: ast.Precedence(n.Op)}, nil
+}
+
+func (f formatter) VisitCall(n *ast.Call) (formatted, error) {
+	args := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		result, err := ast.Walk[formatted](arg, f)
+		if err != nil {
+			return formatted{}, err
+		}
+		args[i] = result.text
+	}
+	return formatted{text: n.Name + "(" + strings.Join(args, ", ") + ")", precedence: atomPrecedence}, nil
+}
+
+func (f formatter) VisitConditional(n *ast.Conditional) (formatted, error) {
+	cond, err := ast.Walk[formatted](n.Cond, f)
+	if err != nil {
+		return formatted{}, err
+	}
+	then, err := ast.Walk[formatted](n.Then, f)
+	if err != nil {
+		return formatted{}, err
+	}
+	otherwise, err := ast.Walk[formatted](n.Else, f)
+	if err != nil {
+		return formatted{}, err
+	}
+
+	// Условный оператор правоассоциативен: скобки нужны вложенному только в условии
+	precedence := ast.Precedence(TernaryIf)
+	text := parenthesize(cond, cond.precedence <= precedence) + " ? " + then.text + " : " + otherwise.text
+	return formatted{text: text, precedence: precedence}, nil
+}
+
+func (f formatter) VisitVector(n *ast.Vector) (formatted, error) {
+	elements := make([]string, len(n.Elements))
+	for i, element := range n.Elements {
+		result, err := ast.Walk[formatted](element, f)
+		if err != nil {
+			return formatted{}, err
+		}
+		elements[i] = result.text
+	}
+	return formatted{text: "[" + strings.Join(elements, ", ") + "]", precedence: atomPrecedence}, nil
+}
@@ -0,0 +1,122 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// function описывает встроенную функцию калькулятора
+type function struct {
+	minArgs int                                   // Минимальное количество аргументов
+	maxArgs int                                   // Максимальное количество аргументов (-1 - без ограничений)
+	apply   func(args []float64) (float64, error) // Вычисление значения
+}
+
+var functions = map[string]function{
+	"sqrt": {minArgs: 1, maxArgs: 1, apply: func(args []float64) (float64, error) {
+		if args[0] < 0 {
+			return 0, errors.New("invalid function argument: sqrt of negative number")
+		}
+		return math.Sqrt(args[0]), nil
+	}},
+	"sin": {minArgs: 1, maxArgs: 1, apply: func(args []float64) (float64, error) {
+		return math.Sin(args[0]), nil
+	}},
+	"cos": {minArgs: 1, maxArgs: 1, apply: func(args []float64) (float64, error) {
+		return math.Cos(args[0]), nil
+	}},
+	// log(x) - натуральный логарифм, log(x, b) - логарифм по основанию b
+	"log": {minArgs: 1, maxArgs: 2, apply: func(args []float64) (float64, error) {
+		if args[0] <= 0 {
+			return 0, errors.New("invalid function argument: log of non-positive number")
+		}
+		if len(args) == 1 {
+			return math.Log(args[0]), nil
+		}
+		if args[1] <= 0 || args[1] == 1 {
+			return 0, errors.New("invalid function argument: invalid log base")
+		}
+		return math.Log(args[0]) / math.Log(args[1]), nil
+	}},
+	"abs": {minArgs: 1, maxArgs: 1, apply: func(args []float64) (float64, error) {
+		return math.Abs(args[0]), nil
+	}},
+	"min": {minArgs: 1, maxArgs: -1, apply: func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result, nil
+	}},
+	"max": {minArgs: 1, maxArgs: -1, apply: func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result, nil
+	}},
+	"sum": {minArgs: 1, maxArgs: -1, apply: func(args []float64) (float64, error) {
+		return sumOf(args), nil
+	}},
+	"avg": {minArgs: 1, maxArgs: -1, apply: func(args []float64) (float64, error) {
+		return avgOf(args), nil
+	}},
+	"median": {minArgs: 1, maxArgs: -1, apply: func(args []float64) (float64, error) {
+		return medianOf(args), nil
+	}},
+	"variance": {minArgs: 1, maxArgs: -1, apply: func(args []float64) (float64, error) {
+		return varianceOf(args), nil
+	}},
+	"stddev": {minArgs: 1, maxArgs: -1, apply: func(args []float64) (float64, error) {
+		return math.Sqrt(varianceOf(args)), nil
+	}},
+	// percentile(p, x1, ..., xn) - p-й процентиль значений x1, ..., xn
+	"percentile": {minArgs: 2, maxArgs: -1, apply: func(args []float64) (float64, error) {
+		return percentileOf(args[0], args[1:])
+	}},
+	// round(x) - до целого, round(x, n) - до n знаков после запятой
+	"round": {minArgs: 1, maxArgs: 2, apply: func(args []float64) (float64, error) {
+		if len(args) == 1 {
+			return math.Round(args[0]), nil
+		}
+		if args[1] != math.Trunc(args[1]) {
+			return 0, errors.New("invalid function argument: round precision must be integer")
+		}
+		scale := math.Pow(10, args[1])
+		return math.Round(args[0]*scale) / scale, nil
+	}},
+}
+
+// constants содержит встроенные именованные константы
+var constants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// IsConstant проверяет, является ли имя встроенной константой
+func IsConstant(name string) bool {
+	_, ok := constants[strings.ToLower(name)]
+	return ok
+}
+
+// IsFunction проверяет, является ли имя встроенной функцией
+func IsFunction(name string) bool {
+	_, ok := functions[strings.ToLower(name)]
+	return ok
+}
+
+// ApplyFunction вычисляет значение встроенной функции от переданных аргументов
+func ApplyFunction(name string, args []float64) (float64, error) {
+	fn, ok := functions[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown function: %s", name)
+	}
+
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return 0, fmt.Errorf("invalid number of arguments for %s: %d", name, len(args))
+	}
+
+	return fn.apply(args)
+}
@@ -0,0 +1,456 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"gocalc/internal/ast"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Операторы режима interval
+const (
+	OpPlusMinus = ast.OpPlusMinus // Число с погрешностью: 5±0.2 = [4.8, 5.2]
+	OpInterval  = "interval"      // Интервал [low, high] из вычисленных границ (задачи агентов)
+)
+
+// Interval - замкнутый интервал [Low, High], в котором лежит значение с погрешностью.
+// Границы вычисляются в float64 без направленного округления
+type Interval struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// Point возвращает интервал из одного числа
+func Point(value float64) Interval {
+	return Interval{Low: value, High: value}
+}
+
+// NewInterval возвращает интервал [low, high], проверяя порядок границ
+func NewInterval(low, high float64) (Interval, error) {
+	if math.IsNaN(low) || math.IsNaN(high) {
+		return Interval{}, errors.New("invalid interval: bound is not a number")
+	}
+	if low > high {
+		return Interval{}, fmt.Errorf("invalid interval: lower bound %g is greater than upper bound %g", low, high)
+	}
+	return Interval{Low: low, High: high}, nil
+}
+
+// IsPoint проверяет, что интервал состоит из одного числа
+func (iv Interval) IsPoint() bool {
+	return iv.Low == iv.High
+}
+
+// Contains проверяет, что число лежит в интервале
+func (iv Interval) Contains(value float64) bool {
+	return iv.Low <= value && value <= iv.High
+}
+
+// Mid возвращает середину интервала - номинальное значение
+func (iv Interval) Mid() float64 {
+	if iv.IsPoint() {
+		return iv.Low
+	}
+	return iv.Low + (iv.High-iv.Low)/2
+}
+
+// Truth возвращает истинность интервала как условия. certain == false, если интервал
+// содержит и ноль, и ненулевые значения: истинность зависит от неизвестного значения
+func (iv Interval) Truth() (value, certain bool) {
+	if !iv.Contains(0) {
+		return true, true
+	}
+	if iv.Low == 0 && iv.High == 0 {
+		return false, true
+	}
+	return false, false
+}
+
+// String возвращает запись интервала "[4.8, 5.2]"
+func (iv Interval) String() string {
+	return FormatInterval(iv)
+}
+
+// FormatInterval возвращает текстовую запись интервала, в которой он передаётся агентам
+func FormatInterval(iv Interval) string {
+	return "[" + strconv.FormatFloat(iv.Low, 'g', -1, 64) + ", " + strconv.FormatFloat(iv.High, 'g', -1, 64) + "]"
+}
+
+// ParseInterval разбирает запись "[4.8, 5.2]" или число "5" (интервал из одного числа)
+func ParseInterval(s string) (Interval, error) {
+	text := strings.TrimSpace(s)
+	if !strings.HasPrefix(text, "[") {
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return Interval{}, fmt.Errorf("invalid interval: %s", s)
+		}
+		return Point(value), nil
+	}
+
+	low, high, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(text, "["), "]"), ",")
+	if !ok || !strings.HasSuffix(text, "]") {
+		return Interval{}, fmt.Errorf("invalid interval: %s", s)
+	}
+	lowValue, err := strconv.ParseFloat(strings.TrimSpace(low), 64)
+	if err != nil {
+		return Interval{}, fmt.Errorf("invalid interval: %s", s)
+	}
+	highValue, err := strconv.ParseFloat(strings.TrimSpace(high), 64)
+	if err != nil {
+		return Interval{}, fmt.Errorf("invalid interval: %s", s)
+	}
+	return NewInterval(lowValue, highValue)
+}
+
+// CalculateInterval вычисляет выражение в режиме interval: числа с погрешностью "5±0.2"
+// и интервалы "[4.8, 5.2]" дают интервал, в котором гарантированно лежит результат
+func (c *Calculator) CalculateInterval(expr string) (Interval, error) {
+	if err := c.Tokenize(expr); err != nil {
+		return Interval{}, fmt.Errorf("tokenization error: %w", err)
+	}
+	rpn, err := c.ToRPN()
+	if err != nil {
+		return Interval{}, fmt.Errorf("parse error: %w", err)
+	}
+	return c.EvaluateIntervalRPN(rpn)
+}
+
+// EvaluateIntervalRPN вычисляет выражение в RPN интервальной арифметикой. Литерал
+// из двух чисел "[low, high]" - интервал. Как и в EvaluateRPN, ошибка операции
+// откладывается до использования её результата
+func (c *Calculator) EvaluateIntervalRPN(rpn []Token) (Interval, error) {
+	type value struct {
+		iv  Interval
+		err error
+	}
+	var stack []value
+
+	// apply заменяет arity верхних значений стека результатом операции
+	apply := func(operation string, arity int) error {
+		if len(stack) < arity {
+			return errors.New("invalid expression")
+		}
+		operands := stack[len(stack)-arity:]
+		stack = stack[:len(stack)-arity]
+
+		var result value
+		args := make([]Interval, arity)
+		for i, operand := range operands {
+			if operand.err != nil {
+				result.err = operand.err
+				break
+			}
+			args[i] = operand.iv
+		}
+		if result.err == nil {
+			result.iv, result.err = ApplyInterval(operation, args)
+		}
+		stack = append(stack, result)
+		return nil
+	}
+
+	for _, token := range rpn {
+		var err error
+		switch token.Type {
+		case Number:
+			num, parseErr := strconv.ParseFloat(token.Value, 64)
+			if parseErr != nil {
+				return Interval{}, fmt.Errorf("invalid number: %s", token.Value)
+			}
+			stack = append(stack, value{iv: Point(num)})
+		case Function:
+			err = apply(token.Value, token.Arity)
+		case UnaryOperator:
+			err = apply(token.Value, 1)
+		case Operator:
+			err = apply(token.Value, 2)
+		case VectorLiteral:
+			if token.Arity != 2 {
+				return Interval{}, errors.New("invalid interval: expected [low, high]")
+			}
+			err = apply(OpInterval, 2)
+		case Conditional:
+			if len(stack) < 3 {
+				return Interval{}, errors.New("invalid expression")
+			}
+
+			cond, then, otherwise := stack[len(stack)-3], stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-3]
+
+			if cond.err != nil {
+				stack = append(stack, cond)
+				break
+			}
+			truth, certain := cond.iv.Truth()
+			switch {
+			case !certain:
+				stack = append(stack, value{err: fmt.Errorf("invalid condition: condition is uncertain over %s", cond.iv)})
+			case truth:
+				stack = append(stack, then)
+			default:
+				stack = append(stack, otherwise)
+			}
+		}
+		if err != nil {
+			return Interval{}, err
+		}
+	}
+
+	if len(stack) != 1 {
+		return Interval{}, errors.New("invalid expression")
+	}
+	return stack[0].iv, stack[0].err
+}
+
+// ApplyInterval выполняет операцию или встроенную функцию над интервалами.
+// Используется и калькулятором, и агентами
+func ApplyInterval(operation string, args []Interval) (Interval, error) {
+	switch operation {
+	case OpPlusMinus:
+		if len(args) != 2 {
+			return Interval{}, errors.New("invalid expression")
+		}
+		if args[1].Low < 0 {
+			return Interval{}, fmt.Errorf("invalid interval: negative uncertainty %g", args[1].Low)
+		}
+		return Interval{Low: args[0].Low - args[1].High, High: args[0].High + args[1].High}, nil
+	case OpInterval:
+		if len(args) != 2 {
+			return Interval{}, errors.New("invalid expression")
+		}
+		if !args[0].IsPoint() || !args[1].IsPoint() {
+			return Interval{}, errors.New("invalid interval: bounds must be numbers")
+		}
+		return NewInterval(args[0].Low, args[1].Low)
+	case OpMatMul:
+		return Interval{}, errors.New("matrix product is not supported in interval mode")
+	}
+	if IsTensorFunction(operation) {
+		return Interval{}, fmt.Errorf("function %s is not supported in interval mode", operation)
+	}
+
+	// Над числами операция выполняется как обычно
+	points := make([]float64, len(args))
+	exact := true
+	for i, arg := range args {
+		points[i] = arg.Low
+		exact = exact && arg.IsPoint()
+	}
+	if exact {
+		result, err := applyPoint(operation, points)
+		return Point(result), err
+	}
+
+	if len(args) == 1 {
+		switch operation {
+		case UnaryMinus:
+			return Interval{Low: -args[0].High, High: -args[0].Low}, nil
+		case UnaryPlus:
+			return args[0], nil
+		case UnaryNot:
+			truth, certain := args[0].Truth()
+			return truthInterval(certain && !truth, certain && truth), nil
+		}
+	}
+	if IsFunction(operation) {
+		return applyFunctionInterval(strings.ToLower(operation), args)
+	}
+	if len(args) != 2 {
+		return Interval{}, errors.New("invalid expression")
+	}
+
+	a, b := args[0], args[1]
+	switch operation {
+	case "+":
+		return Interval{Low: a.Low + b.Low, High: a.High + b.High}, nil
+	case "-":
+		return Interval{Low: a.Low - b.High, High: a.High - b.Low}, nil
+	case "*":
+		return hull(a.Low*b.Low, a.Low*b.High, a.High*b.Low, a.High*b.High), nil
+	case "/":
+		if b.Contains(0) {
+			return Interval{}, errors.New("division by zero")
+		}
+		return hull(a.Low/b.Low, a.Low/b.High, a.High/b.Low, a.High/b.High), nil
+	case "^":
+		return powInterval(a, b)
+	case OpLess:
+		return truthInterval(a.High < b.Low, a.Low >= b.High), nil
+	case OpLessEqual:
+		return truthInterval(a.High <= b.Low, a.Low > b.High), nil
+	case OpGreater:
+		return truthInterval(a.Low > b.High, a.High <= b.Low), nil
+	case OpGreaterEqual:
+		return truthInterval(a.Low >= b.High, a.High < b.Low), nil
+	case OpEqual, OpNotEqual:
+		disjoint := a.High < b.Low || b.High < a.Low
+		equal := a.IsPoint() && b.IsPoint() && a.Low == b.Low
+		if operation == OpEqual {
+			return truthInterval(equal, disjoint), nil
+		}
+		return truthInterval(disjoint, equal), nil
+	case OpAnd, OpOr:
+		aTruth, aCertain := a.Truth()
+		bTruth, bCertain := b.Truth()
+		aFalse, bFalse := aCertain && !aTruth, bCertain && !bTruth
+		aTrue, bTrue := aCertain && aTruth, bCertain && bTruth
+		if operation == OpAnd {
+			return truthInterval(aTrue && bTrue, aFalse || bFalse), nil
+		}
+		return truthInterval(aTrue || bTrue, aFalse && bFalse), nil
+	}
+	return Interval{}, fmt.Errorf("operator %s is not supported for intervals", operation)
+}
+
+// applyPoint выполняет операцию над числами
+func applyPoint(operation string, args []float64) (float64, error) {
+	switch {
+	case IsFunction(operation):
+		return ApplyFunction(operation, args)
+	case len(args) == 1:
+		return ApplyUnaryOperator(operation, args[0])
+	case len(args) == 2:
+		return ApplyOperator(operation, args[0], args[1])
+	}
+	return 0, errors.New("invalid expression")
+}
+
+// hull возвращает наименьший интервал, содержащий все значения
+func hull(values ...float64) Interval {
+	return Interval{Low: slices.Min(values), High: slices.Max(values)}
+}
+
+// truthInterval возвращает результат сравнения: 1, 0 или [0, 1], если он зависит
+// от того, где именно в интервалах лежат значения
+func truthInterval(certainTrue, certainFalse bool) Interval {
+	switch {
+	case certainTrue:
+		return Point(1)
+	case certainFalse:
+		return Point(0)
+	}
+	return Interval{Low: 0, High: 1}
+}
+
+// powInterval возводит интервал в степень. Целая степень допускает отрицательное основание,
+// дробная - только положительное: тогда x^y монотонна по каждому аргументу
+func powInterval(a, b Interval) (Interval, error) {
+	if b.IsPoint() && b.Low == math.Trunc(b.Low) {
+		n := b.Low
+		if n < 0 {
+			if a.Contains(0) {
+				return Interval{}, errors.New("invalid exponentiation")
+			}
+			positive, err := powInterval(a, Point(-n))
+			if err != nil {
+				return Interval{}, err
+			}
+			return ApplyInterval("/", []Interval{Point(1), positive})
+		}
+
+		low, high := math.Pow(a.Low, n), math.Pow(a.High, n)
+		switch {
+		case math.IsInf(low, 0) || math.IsInf(high, 0):
+			return Interval{}, errors.New("invalid exponentiation")
+		case math.Mod(n, 2) != 0 || a.Low >= 0:
+			return hull(low, high), nil
+		case a.High <= 0:
+			return Interval{Low: high, High: low}, nil
+		}
+		return Interval{Low: 0, High: max(low, high)}, nil
+	}
+
+	if a.Low < 0 || (a.Low == 0 && b.Low <= 0) {
+		return Interval{}, errors.New("invalid exponentiation")
+	}
+	values := []float64{
+		math.Pow(a.Low, b.Low), math.Pow(a.Low, b.High),
+		math.Pow(a.High, b.Low), math.Pow(a.High, b.High),
+	}
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return Interval{}, errors.New("invalid exponentiation")
+		}
+	}
+	return hull(values...), nil
+}
+
+// Аргументы-параметры функций, которые должны быть числами: основание логарифма,
+// число знаков округления, номер процентиля
+var intervalParameters = map[string]int{
+	"log":        1,
+	"round":      1,
+	"percentile": 0,
+}
+
+// applyFunctionInterval вычисляет функцию, хотя бы один аргумент которой - интервал
+func applyFunctionInterval(name string, args []Interval) (Interval, error) {
+	if index, ok := intervalParameters[name]; ok && index < len(args) && !args[index].IsPoint() {
+		return Interval{}, fmt.Errorf("invalid function argument: %s parameter must be a number", name)
+	}
+
+	switch name {
+	case "sqrt", "log", "min", "max", "round", "sum", "avg", "median", "percentile":
+		// Функции монотонны по каждому значению: границы результата - значения на границах
+		lows := make([]float64, len(args))
+		highs := make([]float64, len(args))
+		for i, arg := range args {
+			lows[i], highs[i] = arg.Low, arg.High
+		}
+		low, err := ApplyFunction(name, lows)
+		if err != nil {
+			return Interval{}, err
+		}
+		high, err := ApplyFunction(name, highs)
+		if err != nil {
+			return Interval{}, err
+		}
+		// hull, а не [low, high]: логарифм по основанию меньше 1 убывает
+		return hull(low, high), nil
+	case "abs":
+		if len(args) != 1 {
+			return Interval{}, fmt.Errorf("invalid number of arguments for %s: %d", name, len(args))
+		}
+		a := args[0]
+		if a.Contains(0) {
+			return Interval{Low: 0, High: max(-a.Low, a.High)}, nil
+		}
+		return hull(math.Abs(a.Low), math.Abs(a.High)), nil
+	case "sin", "cos":
+		if len(args) != 1 {
+			return Interval{}, fmt.Errorf("invalid number of arguments for %s: %d", name, len(args))
+		}
+		a := args[0]
+		if name == "cos" {
+			// cos(x) = sin(x + pi/2)
+			a = Interval{Low: a.Low + math.Pi/2, High: a.High + math.Pi/2}
+		}
+		return sinInterval(a), nil
+	}
+	return Interval{}, fmt.Errorf("function %s is not supported for intervals", name)
+}
+
+// sinInterval возвращает область значений синуса на интервале: к значениям на границах
+// добавляются максимум 1 и минимум -1, если интервал содержит их точки
+func sinInterval(a Interval) Interval {
+	if a.High-a.Low >= 2*math.Pi {
+		return Interval{Low: -1, High: 1}
+	}
+	result := hull(math.Sin(a.Low), math.Sin(a.High))
+	if containsPeriodic(a, math.Pi/2) {
+		result.High = 1
+	}
+	if containsPeriodic(a, -math.Pi/2) {
+		result.Low = -1
+	}
+	return result
+}
+
+// containsPeriodic проверяет, содержит ли интервал точку phase + 2*pi*k
+func containsPeriodic(a Interval, phase float64) bool {
+	k := math.Ceil((a.Low - phase) / (2 * math.Pi))
+	return phase+2*math.Pi*k <= a.High
+}
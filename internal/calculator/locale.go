@@ -0,0 +1,291 @@
+package calculator
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale - локаль пользователя по умолчанию
+const DefaultLocale = "en"
+
+// Locale задаёт разделители в записи чисел: на входе выражения
+// и в отформатированных результатах
+type Locale struct {
+	Name    string
+	Decimal byte // Десятичный разделитель
+	Group   byte // Разделитель групп разрядов
+}
+
+// Поддерживаемые локали
+var locales = map[string]Locale{
+	"en": {Name: "en", Decimal: '.', Group: ','},
+	"ru": {Name: "ru", Decimal: ',', Group: ' '},
+	"de": {Name: "de", Decimal: ',', Group: '.'},
+}
+
+// LookupLocale возвращает локаль по имени ("ru", "DE"); "" - локаль по умолчанию
+func LookupLocale(name string) (Locale, bool) {
+	if name == "" {
+		name = DefaultLocale
+	}
+	locale, ok := locales[strings.ToLower(name)]
+	return locale, ok
+}
+
+// LocaleFor возвращает локаль по результату чтения настроек пользователя
+// (name, err); при ошибке или неизвестном имени - локаль по умолчанию
+func LocaleFor(name string, err error) Locale {
+	if err != nil {
+		log.Printf("Ошибка получения локали пользователя: %v", err)
+	}
+	locale, ok := LookupLocale(name)
+	if !ok {
+		locale = locales[DefaultLocale]
+	}
+	return locale
+}
+
+// LocaleNames возвращает отсортированный список поддерживаемых локалей
+func LocaleNames() []string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Normalize переводит числа выражения из записи локали в запись калькулятора:
+// "3,14" -> "3.14", "1 000" -> "1_000". В локалях с десятичной запятой аргументы
+// функций и элементы векторов разделяются ";" ("max(1,5; 2)"). Запятая между цифрами
+// в списке без ";" неоднозначна ("max(1,2)") и возвращается как синтаксическая ошибка.
+// Длина выражения не меняется, поэтому позиции синтаксических ошибок совпадают с вводом
+func (l Locale) Normalize(expr string) (string, error) {
+	// Запись калькулятора совпадает с английской: разделитель групп на входе
+	// неотличим от разделителя аргументов ("max(1,234)")
+	if l.Decimal == '.' {
+		return expr, nil
+	}
+
+	separated := separatedLists(expr)
+	b := []byte(expr)
+	// Для каждой открытой скобки: список без ";", в котором десятичная запятая неоднозначна
+	var ambiguous []bool
+	afterIdent := false
+	for i := 0; i < len(b); {
+		c := b[i]
+		ident := false
+		switch {
+		case isLetter(c) || c == '_':
+			for i < len(b) && (isLetter(b[i]) || isDigit(b[i]) || b[i] == '_') {
+				i++
+			}
+			ident = true
+		case isDigit(c):
+			end, err := l.normalizeNumber(b, i)
+			if err != nil {
+				return expr, err
+			}
+			if comma := strings.IndexByte(expr[i:end], l.Decimal); comma >= 0 && len(ambiguous) > 0 && ambiguous[len(ambiguous)-1] {
+				return expr, ambiguousComma(i + comma)
+			}
+			i = end
+		case c == '(':
+			// Скобка после имени открывает аргументы функции, иначе - группировку
+			ambiguous = append(ambiguous, afterIdent && !separated[i])
+			i++
+		case c == '[':
+			ambiguous = append(ambiguous, !separated[i])
+			i++
+		case c == ')' || c == ']':
+			if len(ambiguous) > 0 {
+				ambiguous = ambiguous[:len(ambiguous)-1]
+			}
+			i++
+		case c == ';':
+			b[i] = ','
+			i++
+		case c == '.' && i+1 < len(b) && isDigit(b[i+1]):
+			// ".5" в записи калькулятора - дробь, в локали с десятичной запятой - опечатка
+			return expr, l.misplacedPoint(i)
+		case c == ' ':
+			ident = afterIdent
+			i++
+		default:
+			i++
+		}
+		afterIdent = ident
+	}
+	return string(b), nil
+}
+
+// separatedLists возвращает позиции открывающих скобок, внутри которых
+// (без учёта вложенных скобок) встречается разделитель ";"
+func separatedLists(expr string) map[int]bool {
+	separated := make(map[int]bool)
+	var open []int
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '(', '[':
+			open = append(open, i)
+		case ')', ']':
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		case ';':
+			if len(open) > 0 {
+				separated[open[len(open)-1]] = true
+			}
+		}
+	}
+	return separated
+}
+
+func ambiguousComma(offset int) error {
+	return &SyntaxError{
+		Code:    ErrCodeMisplacedComma,
+		Message: "ambiguous comma between digits in argument list: separate arguments with ';'",
+		Offset:  offset,
+		Token:   ",",
+	}
+}
+
+func (l Locale) misplacedPoint(offset int) error {
+	return &SyntaxError{
+		Code:    ErrCodeInvalidNumber,
+		Message: fmt.Sprintf("invalid number: '.' is not a decimal separator in locale %s, use '%c'", l.Name, l.Decimal),
+		Offset:  offset,
+		Token:   ".",
+	}
+}
+
+// normalizeNumber переводит число, начинающееся с b[start], и возвращает позицию его конца.
+// Точка, не являющаяся разделителем групп, отклоняется: парсер прочитал бы её как
+// десятичную, и "1.50" в локали de молча стало бы 1.5, а "1.500" - 1500
+func (l Locale) normalizeNumber(b []byte, start int) (int, error) {
+	i := start
+	// Шестнадцатеричные и двоичные целые не зависят от локали
+	if b[i] == '0' && i+1 < len(b) && strings.IndexByte("xXbB", b[i+1]) >= 0 {
+		for i < len(b) && (isLetter(b[i]) || isDigit(b[i]) || b[i] == '_') {
+			i++
+		}
+		return i, nil
+	}
+
+	i = skipDigits(b, i)
+	// Разделитель групп допускается только перед группой ровно из трёх цифр
+	for i+3 < len(b) && b[i] == l.Group && skipDigits(b, i+1) == i+4 {
+		b[i] = '_'
+		i += 4
+	}
+	if i+1 < len(b) && b[i] == l.Decimal && isDigit(b[i+1]) {
+		b[i] = '.'
+		i = skipDigits(b, i+1)
+	}
+	if i < len(b) && b[i] == '.' {
+		return i, l.misplacedPoint(i)
+	}
+	return i, nil
+}
+
+// Format переводит числа текста результата ("1234.5", "[1.5, 2]", "1/3")
+// в запись локали: "1 234,5", "[1,5; 2]"
+func (l Locale) Format(text string) string {
+	var sb strings.Builder
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case isLetter(c):
+			// Inf, NaN и подобные слова переносятся без изменений
+			j := i
+			for j < len(text) && isLetter(text[j]) {
+				j++
+			}
+			sb.WriteString(text[i:j])
+			i = j
+		case isDigit(c):
+			j := skipDigits([]byte(text), i)
+			sb.WriteString(l.groupDigits(text[i:j]))
+			i = j
+			if i+1 < len(text) && text[i] == '.' && isDigit(text[i+1]) {
+				j = skipDigits([]byte(text), i+1)
+				sb.WriteByte(l.Decimal)
+				sb.WriteString(text[i+1 : j])
+				i = j
+			}
+			// Порядок числа ("e+21") переносится без изменений
+			if i < len(text) && (text[i] == 'e' || text[i] == 'E') {
+				j = i + 1
+				if j < len(text) && (text[j] == '+' || text[j] == '-') {
+					j++
+				}
+				j = skipDigits([]byte(text), j)
+				sb.WriteString(text[i:j])
+				i = j
+			}
+		case c == ',' && l.Decimal == ',':
+			sb.WriteByte(';')
+			i++
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// FormatResult возвращает отформатированный в локали результат выражения:
+// вектор или матрицу, точную запись или интервал, иначе приближённое значение
+func (l Locale) FormatResult(result float64, resultText string, tensor *Tensor) string {
+	switch {
+	case tensor != nil:
+		return l.Format(tensor.String())
+	case resultText != "":
+		return l.Format(resultText)
+	}
+	return l.Format(formatPlain(result))
+}
+
+// formatPlain записывает число без порядка ("1234567.891"), чтобы к нему применялась
+// группировка разрядов; порядок ("1e+21") остаётся только для очень больших и малых значений
+func formatPlain(value float64) string {
+	if abs := math.Abs(value); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// groupDigits разбивает целую часть числа на группы по три цифры
+func (l Locale) groupDigits(digits string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var sb strings.Builder
+	for i := 0; i < len(digits); i++ {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			sb.WriteByte(l.Group)
+		}
+		sb.WriteByte(digits[i])
+	}
+	return sb.String()
+}
+
+// skipDigits возвращает позицию первого символа после цифр, начиная с b[start]
+func skipDigits(b []byte, start int) int {
+	for start < len(b) && (isDigit(b[start]) || (b[start] == '_' && start > 0 && isDigit(b[start-1]))) {
+		start++
+	}
+	return start
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
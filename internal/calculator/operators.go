@@ -0,0 +1,246 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"gocalc/internal/ast"
+	"math"
+	"math/big"
+)
+
+// Целочисленные и побитовые операторы
+const (
+	OpModulo     = "%"          // Остаток от деления (знак совпадает со знаком делителя)
+	OpIntDivide  = "//"         // Целочисленное деление с округлением вниз
+	OpBitAnd     = "&"          // Побитовое И
+	OpBitOr      = "|"          // Побитовое ИЛИ
+	OpBitXor     = ast.OpBitXor // Побитовое исключающее ИЛИ
+	OpShiftLeft  = "<<"         // Сдвиг влево
+	OpShiftRight = ">>"         // Арифметический сдвиг вправо
+)
+
+// Операторы сравнения и логические операторы. Результат - 1 (истина) или 0 (ложь),
+// любое ненулевое значение операнда считается истиной
+const (
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+	OpAnd          = "&&"
+	OpOr           = "||"
+)
+
+// Условный оператор "cond ? a : b": в RPN записывается одним токеном с тремя операндами
+const (
+	TernaryIf     = ast.TernaryIf
+	TernaryElse   = ast.TernaryElse
+	OpConditional = ast.OpConditional
+)
+
+// errIntervalPrecision - ошибка числа с погрешностью вне режима interval
+var errIntervalPrecision = errors.New(`numbers with uncertainty require precision "interval"`)
+
+// Максимальное целое, точно представимое в float64
+const maxExactInteger = 1 << 53
+
+// Максимальный сдвиг (в битах) для чисел float64
+const maxShift = 63
+
+// ApplyOperator выполняет бинарный оператор над числами float64.
+// Используется и калькулятором, и агентами
+func ApplyOperator(operator string, a, b float64) (float64, error) {
+	switch operator {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	case "^":
+		result := math.Pow(a, b)
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return 0, errors.New("invalid exponentiation")
+		}
+		return result, nil
+	case OpModulo:
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		result := math.Mod(a, b)
+		if result != 0 && (result < 0) != (b < 0) {
+			result += b
+		}
+		return result, nil
+	case OpIntDivide:
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return math.Floor(a / b), nil
+	case OpBitAnd, OpBitOr, OpBitXor:
+		x, err := integerOperand(a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := integerOperand(b)
+		if err != nil {
+			return 0, err
+		}
+		switch operator {
+		case OpBitAnd:
+			return float64(x & y), nil
+		case OpBitOr:
+			return float64(x | y), nil
+		default:
+			return float64(x ^ y), nil
+		}
+	case OpShiftLeft, OpShiftRight:
+		x, err := integerOperand(a)
+		if err != nil {
+			return 0, err
+		}
+		if b != math.Trunc(b) || b < 0 || b > maxShift {
+			return 0, fmt.Errorf("invalid shift count: %g", b)
+		}
+		if operator == OpShiftLeft {
+			return float64(x << uint(b)), nil
+		}
+		return float64(x >> uint(b)), nil
+	case OpLess:
+		return boolValue(a < b), nil
+	case OpLessEqual:
+		return boolValue(a <= b), nil
+	case OpGreater:
+		return boolValue(a > b), nil
+	case OpGreaterEqual:
+		return boolValue(a >= b), nil
+	case OpEqual:
+		return boolValue(a == b), nil
+	case OpNotEqual:
+		return boolValue(a != b), nil
+	case OpAnd:
+		return boolValue(a != 0 && b != 0), nil
+	case OpOr:
+		return boolValue(a != 0 || b != 0), nil
+	case OpPlusMinus:
+		return 0, errIntervalPrecision
+	}
+
+	return 0, fmt.Errorf("unknown operator: %s", operator)
+}
+
+// IsUnaryOperator сообщает, что операция принимает один операнд: UnaryMinus, UnaryPlus или UnaryNot
+func IsUnaryOperator(operator string) bool {
+	return operator == UnaryMinus || operator == UnaryPlus || operator == UnaryNot
+}
+
+// ApplyUnaryOperator выполняет унарный оператор над числом float64
+func ApplyUnaryOperator(operator string, a float64) (float64, error) {
+	switch operator {
+	case UnaryMinus:
+		return -a, nil
+	case UnaryPlus:
+		return a, nil
+	case UnaryNot:
+		return boolValue(a == 0), nil
+	}
+	return 0, fmt.Errorf("unknown operator: %s", operator)
+}
+
+func boolValue(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// integerOperand проверяет, что операнд побитовой операции - целое число
+func integerOperand(v float64) (int64, error) {
+	if v != math.Trunc(v) || math.Abs(v) > maxExactInteger {
+		return 0, fmt.Errorf("invalid bitwise operand: %g is not an integer", v)
+	}
+	return int64(v), nil
+}
+
+// applyIntegerDecimal выполняет целочисленные и побитовые операторы в точном режиме
+func applyIntegerDecimal(operator string, a, b *big.Rat) (*big.Rat, error) {
+	switch operator {
+	case OpModulo, OpIntDivide:
+		if b.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		// Знаменатель big.Rat всегда положителен, поэтому евклидово деление Div
+		// числителя на знаменатель совпадает с округлением вниз
+		quo := new(big.Rat).Quo(a, b)
+		floor := new(big.Int).Div(quo.Num(), quo.Denom())
+		if operator == OpIntDivide {
+			return new(big.Rat).SetInt(floor), nil
+		}
+		return new(big.Rat).Sub(a, new(big.Rat).Mul(b, new(big.Rat).SetInt(floor))), nil
+	}
+
+	if !a.IsInt() {
+		return nil, fmt.Errorf("invalid bitwise operand: %s is not an integer", FormatDecimal(a))
+	}
+	x := a.Num()
+
+	switch operator {
+	case OpBitAnd, OpBitOr, OpBitXor:
+		if !b.IsInt() {
+			return nil, fmt.Errorf("invalid bitwise operand: %s is not an integer", FormatDecimal(b))
+		}
+		y := b.Num()
+		switch operator {
+		case OpBitAnd:
+			return new(big.Rat).SetInt(new(big.Int).And(x, y)), nil
+		case OpBitOr:
+			return new(big.Rat).SetInt(new(big.Int).Or(x, y)), nil
+		default:
+			return new(big.Rat).SetInt(new(big.Int).Xor(x, y)), nil
+		}
+	case OpShiftLeft, OpShiftRight:
+		if !b.IsInt() || b.Sign() < 0 || !b.Num().IsInt64() || b.Num().Int64() > maxDecimalExponent {
+			return nil, fmt.Errorf("invalid shift count: %s", FormatDecimal(b))
+		}
+		n := uint(b.Num().Int64())
+		if operator == OpShiftLeft {
+			return new(big.Rat).SetInt(new(big.Int).Lsh(x, n)), nil
+		}
+		return new(big.Rat).SetInt(new(big.Int).Rsh(x, n)), nil
+	}
+
+	return nil, fmt.Errorf("unknown operator: %s", operator)
+}
+
+// applyComparisonDecimal выполняет сравнения и логические операторы в точном режиме
+func applyComparisonDecimal(operator string, a, b *big.Rat) (*big.Rat, error) {
+	cmp := a.Cmp(b)
+	var result bool
+	switch operator {
+	case OpLess:
+		result = cmp < 0
+	case OpLessEqual:
+		result = cmp <= 0
+	case OpGreater:
+		result = cmp > 0
+	case OpGreaterEqual:
+		result = cmp >= 0
+	case OpEqual:
+		result = cmp == 0
+	case OpNotEqual:
+		result = cmp != 0
+	case OpAnd:
+		result = a.Sign() != 0 && b.Sign() != 0
+	case OpOr:
+		result = a.Sign() != 0 || b.Sign() != 0
+	default:
+		return nil, fmt.Errorf("unknown operator: %s", operator)
+	}
+	return new(big.Rat).SetFloat64(boolValue(result)), nil
+}
@@ -0,0 +1,123 @@
+package calculator
+
+import "gocalc/internal/ast"
+
+// minRebalancedChain - наименьшая длина цепочки, сбалансированное дерево которой
+// мельче левостороннего: у трёх операндов обе глубины равны двум
+const minRebalancedChain = 4
+
+// Ассоциативные операторы, цепочки которых можно перестраивать
+var associativeOperators = map[string]bool{
+	"+":      true,
+	"*":      true,
+	OpBitAnd: true,
+	OpBitOr:  true,
+	OpBitXor: true,
+	OpAnd:    true,
+	OpOr:     true,
+}
+
+// Rebalance перестраивает цепочки ассоциативных операторов (a+b+c+d, a*b*c*d)
+// из левостороннего дерева глубины n-1 в сбалансированное дерево глубины log2(n).
+// Порядок операндов сохраняется, меняется только расстановка скобок: в режиме float
+// результат может отличаться округлением и переполнением (1*1e308*10*1e-308 = +Inf
+// слева направо, но 10 после перестройки). Цепочки короче minRebalancedChain
+// не перестраиваются: глубина от этого не уменьшается
+func Rebalance(node ast.Node) ast.Node {
+	result, _ := ast.Walk[ast.Node](node, rebalancer{})
+	return result
+}
+
+// rebalancer перестраивает дерево выражения снизу вверх
+type rebalancer struct{}
+
+func (r rebalancer) VisitNumber(n *ast.Number) (ast.Node, error) {
+	return n, nil
+}
+
+func (r rebalancer) VisitIdent(n *ast.Ident) (ast.Node, error) {
+	return n, nil
+}
+
+func (r rebalancer) VisitUnary(n *ast.UnaryOp) (ast.Node, error) {
+	rebalanced := *n
+	rebalanced.Operand = Rebalance(n.Operand)
+	return &rebalanced, nil
+}
+
+func (r rebalancer) VisitBinary(n *ast.BinaryOp) (ast.Node, error) {
+	if !associativeOperators[n.Op] {
+		rebalanced := *n
+		rebalanced.Left, rebalanced.Right = Rebalance(n.Left), Rebalance(n.Right)
+		return &rebalanced, nil
+	}
+
+	var operands []ast.Node
+	collectChain(n, n.Op, &operands)
+	if len(operands) < minRebalancedChain {
+		rebalanced := *n
+		rebalanced.Left, rebalanced.Right = Rebalance(n.Left), Rebalance(n.Right)
+		return &rebalanced, nil
+	}
+	for i, operand := range operands {
+		operands[i] = Rebalance(operand)
+	}
+	return balancedChain(n, operands), nil
+}
+
+func (r rebalancer) VisitCall(n *ast.Call) (ast.Node, error) {
+	rebalanced := *n
+	rebalanced.Args = make([]ast.Node, len(n.Args))
+	for i, arg := range n.Args {
+		rebalanced.Args[i] = Rebalance(arg)
+	}
+	return &rebalanced, nil
+}
+
+func (r rebalancer) VisitConditional(n *ast.Conditional) (ast.Node, error) {
+	return &ast.Conditional{
+		Cond:   Rebalance(n.Cond),
+		Then:   Rebalance(n.Then),
+		Else:   Rebalance(n.Else),
+		Offset: n.Offset,
+	}, nil
+}
+
+func (r rebalancer) VisitVector(n *ast.Vector) (ast.Node, error) {
+	rebalanced := *n
+	rebalanced.Elements = make([]ast.Node, len(n.Elements))
+	for i, element := range n.Elements {
+		rebalanced.Elements[i] = Rebalance(element)
+	}
+	return &rebalanced, nil
+}
+
+// collectChain собирает слева направо операнды цепочки оператора op, включая цепочки в скобках
+func collectChain(node ast.Node, op string, operands *[]ast.Node) {
+	if binary, ok := node.(*ast.BinaryOp); ok && binary.Op == op {
+		collectChain(binary.Left, op, operands)
+		collectChain(binary.Right, op, operands)
+		return
+	}
+	*operands = append(*operands, node)
+}
+
+// balancedChain соединяет операнды оператором op попарно: левая и правая половины
+// строятся независимо, поэтому их задачи агенты выполняют параллельно. Короткие
+// части соединяются слева направо, как в записи: глубина от перестройки не уменьшилась бы
+func balancedChain(op *ast.BinaryOp, operands []ast.Node) ast.Node {
+	if len(operands) < minRebalancedChain {
+		node := operands[0]
+		for _, operand := range operands[1:] {
+			next := *op
+			next.Left, next.Right = node, operand
+			node = &next
+		}
+		return node
+	}
+	mid := len(operands) / 2
+	node := *op
+	node.Left = balancedChain(op, operands[:mid])
+	node.Right = balancedChain(op, operands[mid:])
+	return &node
+}
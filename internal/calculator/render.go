@@ -0,0 +1,480 @@
+package calculator
+
+import (
+	"fmt"
+	"gocalc/internal/ast"
+	"html"
+	"strings"
+)
+
+// Форматы типографской записи выражения
+const (
+	RenderLaTeX  = "latex"
+	RenderMathML = "mathml"
+)
+
+// Render разбирает выражение и возвращает его типографскую запись в формате RenderLaTeX или RenderMathML.
+// Деление записывается дробью, степень - верхним индексом, функции - в математической нотации
+func Render(expr, format string) (string, error) {
+	var visitor ast.Visitor[formatted]
+	switch format {
+	case RenderLaTeX:
+		visitor = latexRenderer{}
+	case RenderMathML:
+		visitor = mathmlRenderer{}
+	default:
+		return "", fmt.Errorf("unsupported render format: %s", format)
+	}
+
+	node, err := ast.Parse(expr)
+	if err != nil {
+		return "", err
+	}
+	result, err := ast.Walk[formatted](node, visitor)
+	if err != nil {
+		return "", err
+	}
+
+	if format == RenderMathML {
+		return `<math xmlns="http://www.w3.org/1998/Math/MathML">` + result.text + `</math>`, nil
+	}
+	return result.text, nil
+}
+
+// isFraction проверяет, записывается ли узел дробью: основание степени из дроби берётся в скобки
+func isFraction(node ast.Node) bool {
+	binary, ok := node.(*ast.BinaryOp)
+	return ok && (binary.Op == "/" || binary.Op == OpIntDivide)
+}
+
+// isNegative проверяет, начинается ли запись узла со знака минус. Такой правый операнд
+// бинарного оператора берётся в скобки: в типографской записи "2 \cdot -3" читается плохо
+func isNegative(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.UnaryOp:
+		if n.Op == UnaryPlus {
+			return isNegative(n.Operand)
+		}
+		return n.Op == UnaryMinus
+	case *ast.Number:
+		return strings.HasPrefix(n.Value, "-")
+	}
+	return false
+}
+
+// vectorRows возвращает строки литерала: матрица записывается по строкам, вектор - одной строкой
+func vectorRows(n *ast.Vector) [][]ast.Node {
+	rows := make([][]ast.Node, len(n.Elements))
+	for i, element := range n.Elements {
+		row, ok := element.(*ast.Vector)
+		if !ok {
+			return [][]ast.Node{n.Elements}
+		}
+		rows[i] = row.Elements
+	}
+	return rows
+}
+
+// walkAll обходит узлы одним visitor
+func walkAll(nodes []ast.Node, v ast.Visitor[formatted]) ([]formatted, error) {
+	results := make([]formatted, len(nodes))
+	for i, node := range nodes {
+		result, err := ast.Walk[formatted](node, v)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// Записи бинарных операторов в LaTeX
+var latexOperators = map[string]string{
+	"+":            "+",
+	"-":            "-",
+	"*":            `\cdot`,
+	OpModulo:       `\bmod`,
+	OpBitAnd:       `\mathbin{\&}`,
+	OpBitOr:        `\mathbin{|}`,
+	OpBitXor:       `\oplus`,
+	OpShiftLeft:    `\ll`,
+	OpShiftRight:   `\gg`,
+	OpLess:         "<",
+	OpLessEqual:    `\le`,
+	OpGreater:      ">",
+	OpGreaterEqual: `\ge`,
+	OpEqual:        "=",
+	OpNotEqual:     `\ne`,
+	OpAnd:          `\land`,
+	OpOr:           `\lor`,
+	OpMatMul:       `\mathbin{@}`,
+	OpPlusMinus:    `\pm`,
+}
+
+// Функции, для которых в LaTeX есть собственная команда
+var latexFunctions = map[string]string{
+	"sin": `\sin`,
+	"cos": `\cos`,
+	"log": `\log`,
+	"min": `\min`,
+	"max": `\max`,
+	"det": `\det`,
+}
+
+// latexRenderer записывает дерево выражения в LaTeX
+type latexRenderer struct{}
+
+func latexParens(operand formatted, needed bool) string {
+	if needed {
+		return `\left(` + operand.text + `\right)`
+	}
+	return operand.text
+}
+
+func latexArgs(args []formatted) string {
+	texts := make([]string, len(args))
+	for i, arg := range args {
+		texts[i] = arg.text
+	}
+	return `\left(` + strings.Join(texts, ", ") + `\right)`
+}
+
+func (r latexRenderer) VisitNumber(n *ast.Number) (formatted, error) {
+	text := formatNumber(n.Value)
+	if n.Unit != "" {
+		return formatted{text: text + `\,` + latexUnit(n.Unit), precedence: ast.UnaryPrecedence}, nil
+	}
+	if mantissa, exponent, ok := strings.Cut(text, "e"); ok {
+		// Произведение с показателем не требует скобок справа от операторов, но не в основании степени
+		text = mantissa + ` \cdot 10^{` + strings.TrimPrefix(exponent, "+") + "}"
+		return formatted{text: text, precedence: ast.UnaryPrecedence}, nil
+	}
+	if strings.HasPrefix(text, "-") {
+		return formatted{text: text, precedence: ast.UnaryPrecedence}, nil
+	}
+	return formatted{text: text, precedence: atomPrecedence}, nil
+}
+
+func (r latexRenderer) VisitIdent(n *ast.Ident) (formatted, error) {
+	text := strings.ReplaceAll(n.Name, "_", `\_`)
+	switch {
+	case strings.ToLower(n.Name) == "pi":
+		text = `\pi`
+	case len(n.Name) > 1:
+		text = `\mathrm{` + text + "}"
+	}
+	return formatted{text: text, precedence: atomPrecedence}, nil
+}
+
+func (r latexRenderer) VisitUnary(n *ast.UnaryOp) (formatted, error) {
+	operand, err := ast.Walk[formatted](n.Operand, r)
+	if err != nil {
+		return formatted{}, err
+	}
+
+	switch n.Op {
+	case UnaryPlus:
+		return operand, nil
+	case UnaryNot:
+		text := `\lnot ` + latexParens(operand, operand.precedence < ast.UnaryPrecedence)
+		return formatted{text: text, precedence: ast.UnaryPrecedence}, nil
+	}
+	text := "-" + latexParens(operand, operand.precedence < ast.UnaryPrecedence)
+	return formatted{text: text, precedence: ast.UnaryPrecedence}, nil
+}
+
+func (r latexRenderer) VisitBinary(n *ast.BinaryOp) (formatted, error) {
+	left, err := ast.Walk[formatted](n.Left, r)
+	if err != nil {
+		return formatted{}, err
+	}
+	right, err := ast.Walk[formatted](n.Right, r)
+	if err != nil {
+		return formatted{}, err
+	}
+
+	// Дробь сама отделяет числитель и знаменатель, скобки внутри не нужны
+	switch n.Op {
+	case OpTo:
+		return formatted{text: left.text + ` \to ` + right.text}, nil
+	case "/":
+		return formatted{text: `\frac{` + left.text + "}{" + right.text + "}", precedence: atomPrecedence}, nil
+	case OpIntDivide:
+		text := `\left\lfloor \frac{` + left.text + "}{" + right.text + `} \right\rfloor`
+		return formatted{text: text, precedence: atomPrecedence}, nil
+	case "^":
+		leftParens, _ := binaryParens(n.Op, left, right)
+		base := latexParens(left, leftParens || isFraction(n.Left))
+		return formatted{text: base + "^{" + right.text + "}", precedence: ast.Precedence(n.Op)}, nil
+	}
+
+	leftParens, rightParens := binaryParens(n.Op, left, right)
+	text := latexParens(left, leftParens) + " " + latexOperators[n.Op] + " " + latexParens(right, rightParens || isNegative(n.Right))
+	return formatted{text: text, precedence: ast.Precedence(n.Op)}, nil
+}
+
+func (r latexRenderer) VisitCall(n *ast.Call) (formatted, error) {
+	args, err := walkAll(n.Args, r)
+	if err != nil {
+		return formatted{}, err
+	}
+
+	var text string
+	switch {
+	case n.Name == "sqrt" && len(args) == 1:
+		text = `\sqrt{` + args[0].text + "}"
+	case n.Name == "abs" && len(args) == 1:
+		text = `\left|` + args[0].text + `\right|`
+	case n.Name == "log" && len(args) == 2:
+		text = `\log_{` + args[1].text + "}" + latexArgs(args[:1])
+	case n.Name == "transpose" && len(args) == 1:
+		text = latexParens(args[0], args[0].precedence < atomPrecedence) + `^{\mathsf{T}}`
+	case latexFunctions[n.Name] != "":
+		text = latexFunctions[n.Name] + latexArgs(args)
+	default:
+		text = `\operatorname{` + strings.ReplaceAll(n.Name, "_", `\_`) + "}" + latexArgs(args)
+	}
+	return formatted{text: text, precedence: atomPrecedence}, nil
+}
+
+func (r latexRenderer) VisitConditional(n *ast.Conditional) (formatted, error) {
+	parts, err := walkAll([]ast.Node{n.Cond, n.Then, n.Else}, r)
+	if err != nil {
+		return formatted{}, err
+	}
+	cond, then, otherwise := parts[0], parts[1], parts[2]
+
+	text := `\begin{cases} ` + then.text + ` & \text{if } ` + cond.text + ` \\ ` +
+		otherwise.text + ` & \text{otherwise} \end{cases}`
+	return formatted{text: text, precedence: atomPrecedence}, nil
+}
+
+func (r latexRenderer) VisitVector(n *ast.Vector) (formatted, error) {
+	var rows []string
+	for _, row := range vectorRows(n) {
+		cells, err := walkAll(row, r)
+		if err != nil {
+			return formatted{}, err
+		}
+		texts := make([]string, len(cells))
+		for i, cell := range cells {
+			texts[i] = cell.text
+		}
+		rows = append(rows, strings.Join(texts, " & "))
+	}
+	text := `\begin{pmatrix} ` + strings.Join(rows, ` \\ `) + ` \end{pmatrix}`
+	return formatted{text: text, precedence: atomPrecedence}, nil
+}
+
+// Записи бинарных операторов в MathML (уже экранированные)
+var mathmlOperators = map[string]string{
+	"+":            "+",
+	"-":            "&#x2212;",
+	"*":            "&#x22C5;",
+	OpModulo:       "mod",
+	OpBitAnd:       "&amp;",
+	OpBitOr:        "|",
+	OpBitXor:       "&#x2295;",
+	OpShiftLeft:    "&#x226A;",
+	OpShiftRight:   "&#x226B;",
+	OpLess:         "&lt;",
+	OpLessEqual:    "&#x2264;",
+	OpGreater:      "&gt;",
+	OpGreaterEqual: "&#x2265;",
+	OpEqual:        "=",
+	OpNotEqual:     "&#x2260;",
+	OpAnd:          "&#x2227;",
+	OpOr:           "&#x2228;",
+	OpMatMul:       "@",
+	OpPlusMinus:    "&#xB1;",
+}
+
+// mathmlRenderer записывает дерево выражения в MathML (Presentation Markup)
+type mathmlRenderer struct{}
+
+func mo(op string) string {
+	return "<mo>" + op + "</mo>"
+}
+
+func mrow(parts ...string) string {
+	return "<mrow>" + strings.Join(parts, "") + "</mrow>"
+}
+
+func mathmlParens(operand formatted, needed bool) string {
+	if needed {
+		return mrow(mo("("), operand.text, mo(")"))
+	}
+	return operand.text
+}
+
+func mathmlArgs(args []formatted) string {
+	parts := []string{mo("(")}
+	for i, arg := range args {
+		if i > 0 {
+			parts = append(parts, mo(","))
+		}
+		parts = append(parts, arg.text)
+	}
+	return mrow(append(parts, mo(")"))...)
+}
+
+func (r mathmlRenderer) VisitNumber(n *ast.Number) (formatted, error) {
+	text := formatNumber(n.Value)
+	if n.Unit != "" {
+		// Невидимое умножение между числом и единицей, единица - прямым шрифтом
+		return formatted{text: mrow("<mn>"+text+"</mn>", mo("&#x2062;"), mathmlUnit(n.Unit)), precedence: ast.UnaryPrecedence}, nil
+	}
+	if mantissa, exponent, ok := strings.Cut(text, "e"); ok {
+		power := "<msup><mn>10</mn><mn>" + strings.TrimPrefix(exponent, "+") + "</mn></msup>"
+		return formatted{text: mrow("<mn>"+mantissa+"</mn>", mo("&#x22C5;"), power), precedence: ast.UnaryPrecedence}, nil
+	}
+	if negative, ok := strings.CutPrefix(text, "-"); ok {
+		return formatted{text: mrow(mo("&#x2212;"), "<mn>"+negative+"</mn>"), precedence: ast.UnaryPrecedence}, nil
+	}
+	return formatted{text: "<mn>" + text + "</mn>", precedence: atomPrecedence}, nil
+}
+
+func (r mathmlRenderer) VisitIdent(n *ast.Ident) (formatted, error) {
+	name := html.EscapeString(n.Name)
+	if strings.ToLower(n.Name) == "pi" {
+		name = "&#x3C0;"
+	}
+	return formatted{text: "<mi>" + name + "</mi>", precedence: atomPrecedence}, nil
+}
+
+func (r mathmlRenderer) VisitUnary(n *ast.UnaryOp) (formatted, error) {
+	operand, err := ast.Walk[formatted](n.Operand, r)
+	if err != nil {
+		return formatted{}, err
+	}
+
+	op := "&#x2212;"
+	switch n.Op {
+	case UnaryPlus:
+		return operand, nil
+	case UnaryNot:
+		op = "&#xAC;"
+	}
+	text := mrow(mo(op), mathmlParens(operand, operand.precedence < ast.UnaryPrecedence))
+	return formatted{text: text, precedence: ast.UnaryPrecedence}, nil
+}
+
+func (r mathmlRenderer) VisitBinary(n *ast.BinaryOp) (formatted, error) {
+	left, err := ast.Walk[formatted](n.Left, r)
+	if err != nil {
+		return formatted{}, err
+	}
+	right, err := ast.Walk[formatted](n.Right, r)
+	if err != nil {
+		return formatted{}, err
+	}
+
+	switch n.Op {
+	case OpTo:
+		return formatted{text: mrow(left.text, mo("&#x2192;"), right.text)}, nil
+	case "/":
+		return formatted{text: "<mfrac>" + left.text + right.text + "</mfrac>", precedence: atomPrecedence}, nil
+	case OpIntDivide:
+		text := mrow(mo("&#x230A;"), "<mfrac>"+left.text+right.text+"</mfrac>", mo("&#x230B;"))
+		return formatted{text: text, precedence: atomPrecedence}, nil
+	case "^":
+		leftParens, _ := binaryParens(n.Op, left, right)
+		base := mathmlParens(left, leftParens || isFraction(n.Left))
+		return formatted{text: "<msup>" + base + right.text + "</msup>", precedence: ast.Precedence(n.Op)}, nil
+	}
+
+	leftParens, rightParens := binaryParens(n.Op, left, right)
+	text := mrow(mathmlParens(left, leftParens), mo(mathmlOperators[n.Op]), mathmlParens(right, rightParens || isNegative(n.Right)))
+	return formatted{text: text, precedence: ast.Precedence(n.Op)}, nil
+}
+
+func (r mathmlRenderer) VisitCall(n *ast.Call) (formatted, error) {
+	args, err := walkAll(n.Args, r)
+	if err != nil {
+		return formatted{}, err
+	}
+
+	// Невидимый оператор применения функции связывает имя с аргументами
+	const apply = "<mo>&#x2061;</mo>"
+	name := "<mi>" + html.EscapeString(n.Name) + "</mi>"
+
+	var text string
+	switch {
+	case n.Name == "sqrt" && len(args) == 1:
+		text = "<msqrt>" + args[0].text + "</msqrt>"
+	case n.Name == "abs" && len(args) == 1:
+		text = mrow(mo("|"), args[0].text, mo("|"))
+	case n.Name == "log" && len(args) == 2:
+		text = mrow("<msub>"+name+args[1].text+"</msub>", apply, mathmlArgs(args[:1]))
+	case n.Name == "transpose" && len(args) == 1:
+		text = "<msup>" + mathmlParens(args[0], args[0].precedence < atomPrecedence) + "<mi>T</mi></msup>"
+	default:
+		text = mrow(name, apply, mathmlArgs(args))
+	}
+	return formatted{text: text, precedence: atomPrecedence}, nil
+}
+
+func (r mathmlRenderer) VisitConditional(n *ast.Conditional) (formatted, error) {
+	parts, err := walkAll([]ast.Node{n.Cond, n.Then, n.Else}, r)
+	if err != nil {
+		return formatted{}, err
+	}
+	cond, then, otherwise := parts[0], parts[1], parts[2]
+
+	table := "<mtable>" +
+		"<mtr><mtd>" + then.text + "</mtd><mtd><mtext>if&#xA0;</mtext>" + cond.text + "</mtd></mtr>" +
+		"<mtr><mtd>" + otherwise.text + "</mtd><mtd><mtext>otherwise</mtext></mtd></mtr>" +
+		"</mtable>"
+	return formatted{text: mrow(mo("{"), table), precedence: atomPrecedence}, nil
+}
+
+func (r mathmlRenderer) VisitVector(n *ast.Vector) (formatted, error) {
+	table := "<mtable>"
+	for _, row := range vectorRows(n) {
+		cells, err := walkAll(row, r)
+		if err != nil {
+			return formatted{}, err
+		}
+		table += "<mtr>"
+		for _, cell := range cells {
+			table += "<mtd>" + cell.text + "</mtd>"
+		}
+		table += "</mtr>"
+	}
+	table += "</mtable>"
+	return formatted{text: mrow(mo("("), table, mo(")")), precedence: atomPrecedence}, nil
+}
+
+// latexUnit записывает единицу после числа прямым шрифтом: "m/s^2" -> \mathrm{m}/\mathrm{s}^{2}
+func latexUnit(unit string) string {
+	factors := strings.Split(unit, "/")
+	for i, factor := range factors {
+		name, exponent, ok := strings.Cut(factor, "^")
+		factors[i] = `\mathrm{` + name + "}"
+		if ok {
+			factors[i] += "^{" + exponent + "}"
+		}
+	}
+	return strings.Join(factors, "/")
+}
+
+// mathmlUnit записывает единицу после числа прямым шрифтом
+func mathmlUnit(unit string) string {
+	factors := strings.Split(unit, "/")
+	parts := make([]string, 0, 2*len(factors)-1)
+	for i, factor := range factors {
+		name, exponent, ok := strings.Cut(factor, "^")
+		text := `<mi mathvariant="normal">` + html.EscapeString(name) + "</mi>"
+		if ok {
+			text = "<msup>" + text + "<mn>" + exponent + "</mn></msup>"
+		}
+		if i > 0 {
+			parts = append(parts, mo("/"))
+		}
+		parts = append(parts, text)
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return mrow(parts...)
+}
@@ -0,0 +1,96 @@
+package calculator
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"slices"
+)
+
+// Статистические функции над списком аргументов. Дисперсия и стандартное отклонение
+// считаются по генеральной совокупности (делитель n), процентиль - линейной
+// интерполяцией между соседними по рангу значениями
+
+func sumOf(args []float64) float64 {
+	result := 0.0
+	for _, arg := range args {
+		result += arg
+	}
+	return result
+}
+
+func avgOf(args []float64) float64 {
+	return sumOf(args) / float64(len(args))
+}
+
+func varianceOf(args []float64) float64 {
+	mean := avgOf(args)
+	result := 0.0
+	for _, arg := range args {
+		result += (arg - mean) * (arg - mean)
+	}
+	return result / float64(len(args))
+}
+
+func medianOf(args []float64) float64 {
+	result, _ := percentileOf(50, args)
+	return result
+}
+
+// percentileOf возвращает p-й процентиль (0 <= p <= 100) значений
+func percentileOf(p float64, args []float64) (float64, error) {
+	if p < 0 || p > 100 || math.IsNaN(p) {
+		return 0, errors.New("invalid function argument: percentile must be between 0 and 100")
+	}
+	sorted := slices.Clone(args)
+	slices.Sort(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	if lower == len(sorted)-1 {
+		return sorted[lower], nil
+	}
+	fraction := rank - float64(lower)
+	return sorted[lower] + fraction*(sorted[lower+1]-sorted[lower]), nil
+}
+
+func sumDecimal(args []*big.Rat) *big.Rat {
+	result := new(big.Rat)
+	for _, arg := range args {
+		result.Add(result, arg)
+	}
+	return result
+}
+
+func avgDecimal(args []*big.Rat) *big.Rat {
+	result := sumDecimal(args)
+	return result.Quo(result, new(big.Rat).SetInt64(int64(len(args))))
+}
+
+func varianceDecimal(args []*big.Rat) *big.Rat {
+	mean := avgDecimal(args)
+	result := new(big.Rat)
+	for _, arg := range args {
+		diff := new(big.Rat).Sub(arg, mean)
+		result.Add(result, diff.Mul(diff, diff))
+	}
+	return result.Quo(result, new(big.Rat).SetInt64(int64(len(args))))
+}
+
+// percentileDecimal вычисляет процентиль точно: доля интерполяции - рациональное число
+func percentileDecimal(p *big.Rat, args []*big.Rat) (*big.Rat, error) {
+	if p.Sign() < 0 || p.Cmp(big.NewRat(100, 1)) > 0 {
+		return nil, errors.New("invalid function argument: percentile must be between 0 and 100")
+	}
+	sorted := slices.Clone(args)
+	slices.SortFunc(sorted, func(a, b *big.Rat) int { return a.Cmp(b) })
+
+	rank := new(big.Rat).Mul(p, big.NewRat(int64(len(sorted)-1), 100))
+	lower := new(big.Int).Quo(rank.Num(), rank.Denom()).Int64()
+	if int(lower) == len(sorted)-1 {
+		return new(big.Rat).Set(sorted[lower]), nil
+	}
+	fraction := new(big.Rat).Sub(rank, new(big.Rat).SetInt64(lower))
+	step := new(big.Rat).Sub(sorted[lower+1], sorted[lower])
+	return step.Mul(step, fraction).Add(step, sorted[lower]), nil
+}
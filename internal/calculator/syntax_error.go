@@ -0,0 +1,27 @@
+package calculator
+
+import "gocalc/internal/ast"
+
+// SyntaxError описывает синтаксическую ошибку с позицией в исходном выражении
+type SyntaxError = ast.SyntaxError
+
+// Стабильные коды синтаксических ошибок (используются клиентами API)
+const (
+	ErrCodeInvalidCharacter      = ast.ErrCodeInvalidCharacter
+	ErrCodeInvalidNumber         = ast.ErrCodeInvalidNumber
+	ErrCodeUnknownFunction       = ast.ErrCodeUnknownFunction
+	ErrCodeUndefinedVariable     = ast.ErrCodeUndefinedVariable
+	ErrCodeUnexpectedToken       = ast.ErrCodeUnexpectedToken
+	ErrCodeUnexpectedEnd         = ast.ErrCodeUnexpectedEnd
+	ErrCodeMismatchedParentheses = ast.ErrCodeMismatchedParentheses
+	ErrCodeMisplacedComma        = ast.ErrCodeMisplacedComma
+	ErrCodeMismatchedConditional = ast.ErrCodeMismatchedConditional
+	ErrCodeMismatchedBrackets    = ast.ErrCodeMismatchedBrackets
+	ErrCodeUnknownUnit           = ast.ErrCodeUnknownUnit
+	ErrCodeIncompatibleUnits     = ast.ErrCodeIncompatibleUnits
+)
+
+// AsSyntaxError извлекает SyntaxError из цепочки ошибок
+func AsSyntaxError(err error) (*SyntaxError, bool) {
+	return ast.AsSyntaxError(err)
+}
@@ -0,0 +1,390 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"gocalc/internal/ast"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Матричное произведение "A @ B"
+const OpMatMul = ast.OpMatMul
+
+// Tensor - значение выражения: число (пустой Shape), вектор (Shape [n]) или матрица (Shape [m, n]).
+// Элементы матрицы хранятся по строкам
+type Tensor struct {
+	Shape  []int     `json:"shape"`
+	Values []float64 `json:"values"`
+}
+
+// tensorFunction описывает встроенную функцию над векторами и матрицами
+type tensorFunction struct {
+	args  int // Количество аргументов
+	apply func(args []Tensor) (Tensor, error)
+}
+
+var tensorFunctions = map[string]tensorFunction{
+	"dot":       {args: 2, apply: dotProduct},
+	"transpose": {args: 1, apply: transpose},
+	"det":       {args: 1, apply: determinant},
+}
+
+// Scalar возвращает тензор из одного числа
+func Scalar(value float64) Tensor {
+	return Tensor{Values: []float64{value}}
+}
+
+// IsScalar проверяет, что тензор - число
+func (t Tensor) IsScalar() bool {
+	return len(t.Shape) == 0
+}
+
+// Value возвращает значение числа (первый элемент для вектора и матрицы)
+func (t Tensor) Value() float64 {
+	if len(t.Values) == 0 {
+		return 0
+	}
+	return t.Values[0]
+}
+
+// Row возвращает строку матрицы как вектор
+func (t Tensor) Row(i int) Tensor {
+	n := t.Shape[1]
+	return Tensor{Shape: []int{n}, Values: append([]float64(nil), t.Values[i*n:(i+1)*n]...)}
+}
+
+// Column возвращает столбец матрицы как вектор
+func (t Tensor) Column(j int) Tensor {
+	m, n := t.Shape[0], t.Shape[1]
+	values := make([]float64, m)
+	for i := range values {
+		values[i] = t.Values[i*n+j]
+	}
+	return Tensor{Shape: []int{m}, Values: values}
+}
+
+// String возвращает запись тензора в синтаксисе выражений: "2", "[1, 2]", "[[1, 2], [3, 4]]"
+func (t Tensor) String() string {
+	format := func(values []float64) string {
+		texts := make([]string, len(values))
+		for i, value := range values {
+			texts[i] = strconv.FormatFloat(value, 'g', -1, 64)
+		}
+		return "[" + strings.Join(texts, ", ") + "]"
+	}
+
+	switch len(t.Shape) {
+	case 0:
+		return strconv.FormatFloat(t.Value(), 'g', -1, 64)
+	case 1:
+		return format(t.Values)
+	}
+	rows := make([]string, t.Shape[0])
+	for i := range rows {
+		rows[i] = format(t.Row(i).Values)
+	}
+	return "[" + strings.Join(rows, ", ") + "]"
+}
+
+// ShapeString возвращает описание размерности для сообщений об ошибках
+func ShapeString(shape []int) string {
+	switch len(shape) {
+	case 0:
+		return "number"
+	case 1:
+		return fmt.Sprintf("vector of %d", shape[0])
+	}
+	return fmt.Sprintf("%dx%d matrix", shape[0], shape[1])
+}
+
+func sameShape(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsTensorFunction проверяет, является ли имя функцией над векторами и матрицами
+func IsTensorFunction(name string) bool {
+	_, ok := tensorFunctions[strings.ToLower(name)]
+	return ok
+}
+
+// StackShape возвращает размерность литерала вектора из элементов заданных размерностей:
+// числа образуют вектор, векторы одинаковой длины - матрицу по строкам
+func StackShape(shapes [][]int) ([]int, error) {
+	first := shapes[0]
+	for _, shape := range shapes[1:] {
+		if !sameShape(shape, first) {
+			return nil, fmt.Errorf("invalid matrix: rows must have equal length, got %s and %s",
+				ShapeString(first), ShapeString(shape))
+		}
+	}
+	if len(first) >= 2 {
+		return nil, errors.New("invalid matrix: only vectors and matrices are supported")
+	}
+	return append([]int{len(shapes)}, first...), nil
+}
+
+// StackTensors собирает вектор из чисел или матрицу из векторов-строк
+func StackTensors(elements []Tensor) (Tensor, error) {
+	shapes := make([][]int, len(elements))
+	for i, element := range elements {
+		shapes[i] = element.Shape
+	}
+	shape, err := StackShape(shapes)
+	if err != nil {
+		return Tensor{}, err
+	}
+
+	var values []float64
+	for _, element := range elements {
+		values = append(values, element.Values...)
+	}
+	return Tensor{Shape: shape, Values: values}, nil
+}
+
+// MatMulShape возвращает размерность произведения "a @ b": матрица на матрицу, матрица
+// на вектор и вектор на матрицу. Произведение векторов равной длины - число (скалярное произведение)
+func MatMulShape(a, b []int) ([]int, error) {
+	if len(a) == 0 || len(b) == 0 {
+		return nil, fmt.Errorf("invalid matrix product: %s @ %s, operands must be vectors or matrices",
+			ShapeString(a), ShapeString(b))
+	}
+	if inner(a, true) != inner(b, false) {
+		return nil, fmt.Errorf("invalid matrix product: %s @ %s", ShapeString(a), ShapeString(b))
+	}
+
+	var shape []int
+	if len(a) == 2 {
+		shape = append(shape, a[0])
+	}
+	if len(b) == 2 {
+		shape = append(shape, b[1])
+	}
+	return shape, nil
+}
+
+// inner возвращает размер, по которому суммирует произведение: столбцы левого операнда или строки правого
+func inner(shape []int, left bool) int {
+	if len(shape) == 1 || !left {
+		return shape[0]
+	}
+	return shape[1]
+}
+
+// ResultShape возвращает размерность результата операции над аргументами заданных размерностей.
+// Поэлементные операции допускают операнды одной размерности или число и тензор
+func ResultShape(operation string, shapes [][]int) ([]int, error) {
+	if fn, ok := tensorFunctions[strings.ToLower(operation)]; ok {
+		if len(shapes) != fn.args {
+			return nil, fmt.Errorf("invalid number of arguments for %s: %d", operation, len(shapes))
+		}
+		switch strings.ToLower(operation) {
+		case "dot":
+			if len(shapes[0]) != 1 || !sameShape(shapes[0], shapes[1]) {
+				return nil, fmt.Errorf("invalid function argument: dot of %s and %s, expected vectors of equal length",
+					ShapeString(shapes[0]), ShapeString(shapes[1]))
+			}
+			return nil, nil
+		case "transpose":
+			if len(shapes[0]) == 0 {
+				return nil, errors.New("invalid function argument: transpose of number")
+			}
+			if len(shapes[0]) == 1 {
+				return shapes[0], nil
+			}
+			return []int{shapes[0][1], shapes[0][0]}, nil
+		default:
+			if len(shapes[0]) != 2 || shapes[0][0] != shapes[0][1] {
+				return nil, fmt.Errorf("invalid function argument: det of %s, expected square matrix", ShapeString(shapes[0]))
+			}
+			return nil, nil
+		}
+	}
+
+	if operation == OpMatMul {
+		if len(shapes) != 2 {
+			return nil, errors.New("invalid expression")
+		}
+		return MatMulShape(shapes[0], shapes[1])
+	}
+
+	var shape []int
+	for _, argShape := range shapes {
+		switch {
+		case len(argShape) == 0:
+		case shape == nil:
+			shape = argShape
+		case !sameShape(shape, argShape):
+			return nil, fmt.Errorf("incompatible shapes: %s and %s", ShapeString(shape), ShapeString(argShape))
+		}
+	}
+	if shape != nil && IsFunction(operation) {
+		return nil, fmt.Errorf("invalid function argument: %s of %s, expected numbers", operation, ShapeString(shape))
+	}
+	return shape, nil
+}
+
+// ApplyTensor выполняет операцию, функцию или функцию над матрицами. Операторы и функции
+// над числами применяются к тензорам поэлементно. Используется и калькулятором, и агентами
+func ApplyTensor(operation string, args []Tensor) (Tensor, error) {
+	shapes := make([][]int, len(args))
+	scalars := true
+	for i, arg := range args {
+		shapes[i] = arg.Shape
+		scalars = scalars && arg.IsScalar()
+	}
+	if scalars && !IsTensorFunction(operation) && operation != OpMatMul {
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			values[i] = arg.Value()
+		}
+		result, err := applyScalar(operation, values)
+		if err != nil {
+			return Tensor{}, err
+		}
+		return Scalar(result), nil
+	}
+
+	shape, err := ResultShape(operation, shapes)
+	if err != nil {
+		return Tensor{}, err
+	}
+	if fn, ok := tensorFunctions[strings.ToLower(operation)]; ok {
+		return fn.apply(args)
+	}
+	if operation == OpMatMul {
+		return matMul(args[0], args[1], shape), nil
+	}
+
+	// Поэлементная операция: число повторяется для каждого элемента тензора
+	size := 1
+	for _, n := range shape {
+		size *= n
+	}
+	result := Tensor{Shape: shape, Values: make([]float64, size)}
+	values := make([]float64, len(args))
+	for k := range result.Values {
+		for i, arg := range args {
+			if arg.IsScalar() {
+				values[i] = arg.Value()
+			} else {
+				values[i] = arg.Values[k]
+			}
+		}
+		result.Values[k], err = applyScalar(operation, values)
+		if err != nil {
+			return Tensor{}, err
+		}
+	}
+	return result, nil
+}
+
+// applyScalar выполняет унарный или бинарный оператор либо функцию над числами
+func applyScalar(operation string, values []float64) (float64, error) {
+	switch {
+	case IsFunction(operation):
+		return ApplyFunction(operation, values)
+	case len(values) == 1:
+		return ApplyUnaryOperator(operation, values[0])
+	case len(values) == 2:
+		return ApplyOperator(operation, values[0], values[1])
+	}
+	return 0, errors.New("invalid expression")
+}
+
+// matMul вычисляет произведение "a @ b" известной размерности shape
+func matMul(a, b Tensor, shape []int) Tensor {
+	rows, columns := 1, 1
+	if len(a.Shape) == 2 {
+		rows = a.Shape[0]
+	}
+	if len(b.Shape) == 2 {
+		columns = b.Shape[1]
+	}
+
+	result := Tensor{Shape: shape, Values: make([]float64, 0, rows*columns)}
+	for i := 0; i < rows; i++ {
+		row := a
+		if len(a.Shape) == 2 {
+			row = a.Row(i)
+		}
+		for j := 0; j < columns; j++ {
+			column := b
+			if len(b.Shape) == 2 {
+				column = b.Column(j)
+			}
+			result.Values = append(result.Values, dot(row.Values, column.Values))
+		}
+	}
+	return result
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func dotProduct(args []Tensor) (Tensor, error) {
+	return Scalar(dot(args[0].Values, args[1].Values)), nil
+}
+
+func transpose(args []Tensor) (Tensor, error) {
+	m := args[0]
+	if len(m.Shape) == 1 {
+		return m, nil
+	}
+	rows, columns := m.Shape[0], m.Shape[1]
+	result := Tensor{Shape: []int{columns, rows}, Values: make([]float64, len(m.Values))}
+	for i := 0; i < rows; i++ {
+		for j := 0; j < columns; j++ {
+			result.Values[j*rows+i] = m.Values[i*columns+j]
+		}
+	}
+	return result, nil
+}
+
+// determinant вычисляет определитель методом Гаусса с выбором главного элемента
+func determinant(args []Tensor) (Tensor, error) {
+	n := args[0].Shape[0]
+	a := append([]float64(nil), args[0].Values...)
+
+	det := 1.0
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row*n+col]) > math.Abs(a[pivot*n+col]) {
+				pivot = row
+			}
+		}
+		if a[pivot*n+col] == 0 {
+			return Scalar(0), nil
+		}
+		if pivot != col {
+			for k := 0; k < n; k++ {
+				a[col*n+k], a[pivot*n+k] = a[pivot*n+k], a[col*n+k]
+			}
+			det = -det
+		}
+
+		det *= a[col*n+col]
+		for row := col + 1; row < n; row++ {
+			factor := a[row*n+col] / a[col*n+col]
+			for k := col; k < n; k++ {
+				a[row*n+k] -= factor * a[col*n+k]
+			}
+		}
+	}
+	return Scalar(det), nil
+}
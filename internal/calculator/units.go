@@ -0,0 +1,591 @@
+package calculator
+
+import (
+	"fmt"
+	"gocalc/internal/ast"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// OpTo - перевод результата в единицы измерения: "5 km / 2 h to km/h"
+const OpTo = ast.OpTo
+
+// Dimension - размерность величины: степени основных единиц СИ в порядке dimensionUnits
+type Dimension [7]int
+
+// Основные единицы СИ, из которых составляется запись размерности
+var dimensionUnits = [7]string{"kg", "m", "s", "A", "K", "mol", "cd"}
+
+// Размерности производных величин
+var (
+	dimensionless = Dimension{}
+	massDim       = Dimension{1}
+	lengthDim     = Dimension{0, 1}
+	timeDim       = Dimension{0, 0, 1}
+	currentDim    = Dimension{0, 0, 0, 1}
+	speedDim      = Dimension{0, 1, -1}
+	areaDim       = Dimension{0, 2}
+	volumeDim     = Dimension{0, 3}
+	forceDim      = Dimension{1, 1, -2}
+	energyDim     = Dimension{1, 2, -2}
+	powerDim      = Dimension{1, 2, -3}
+	pressureDim   = Dimension{1, -1, -2}
+	voltageDim    = Dimension{1, 2, -3, -1}
+	frequencyDim  = Dimension{0, 0, -1}
+)
+
+// unitDef - единица измерения: множитель перевода в основные единицы СИ и размерность.
+// Множитель записан конечной десятичной дробью, чтобы точный режим переводил без потерь
+type unitDef struct {
+	scale     string
+	dimension Dimension
+}
+
+// units содержит поддерживаемые единицы. Имена чувствительны к регистру ("mL", "kWh").
+// Единицы со сдвигом нуля (градусы Цельсия и Фаренгейта) не поддерживаются
+var units = map[string]unitDef{
+	// Длина
+	"m":   {"1", lengthDim},
+	"km":  {"1000", lengthDim},
+	"cm":  {"0.01", lengthDim},
+	"mm":  {"0.001", lengthDim},
+	"um":  {"0.000001", lengthDim},
+	"nm":  {"0.000000001", lengthDim},
+	"in":  {"0.0254", lengthDim},
+	"ft":  {"0.3048", lengthDim},
+	"yd":  {"0.9144", lengthDim},
+	"mi":  {"1609.344", lengthDim},
+	"nmi": {"1852", lengthDim},
+
+	// Масса
+	"kg": {"1", massDim},
+	"g":  {"0.001", massDim},
+	"mg": {"0.000001", massDim},
+	"t":  {"1000", massDim},
+	"lb": {"0.45359237", massDim},
+	"oz": {"0.028349523125", massDim},
+
+	// Время
+	"s":   {"1", timeDim},
+	"ms":  {"0.001", timeDim},
+	"us":  {"0.000001", timeDim},
+	"min": {"60", timeDim},
+	"h":   {"3600", timeDim},
+	"d":   {"86400", timeDim},
+
+	// Скорость, площадь, объём
+	"mph":  {"0.44704", speedDim},
+	"ha":   {"10000", areaDim},
+	"acre": {"4046.8564224", areaDim},
+	"L":    {"0.001", volumeDim},
+	"mL":   {"0.000001", volumeDim},
+	"gal":  {"0.003785411784", volumeDim},
+
+	// Механика и энергия
+	"N":    {"1", forceDim},
+	"kN":   {"1000", forceDim},
+	"J":    {"1", energyDim},
+	"kJ":   {"1000", energyDim},
+	"cal":  {"4.184", energyDim},
+	"kcal": {"4184", energyDim},
+	"Wh":   {"3600", energyDim},
+	"kWh":  {"3600000", energyDim},
+	"W":    {"1", powerDim},
+	"kW":   {"1000", powerDim},
+	"Pa":   {"1", pressureDim},
+	"kPa":  {"1000", pressureDim},
+	"bar":  {"100000", pressureDim},
+	"atm":  {"101325", pressureDim},
+	"Hz":   {"1", frequencyDim},
+	"kHz":  {"1000", frequencyDim},
+
+	// Остальные основные единицы и электричество
+	"A":   {"1", currentDim},
+	"mA":  {"0.001", currentDim},
+	"V":   {"1", voltageDim},
+	"K":   {"1", Dimension{0, 0, 0, 0, 1}},
+	"mol": {"1", Dimension{0, 0, 0, 0, 0, 1}},
+	"cd":  {"1", Dimension{0, 0, 0, 0, 0, 0, 1}},
+}
+
+// IsUnit проверяет, что имя - поддерживаемая единица измерения
+func IsUnit(name string) bool {
+	_, ok := units[name]
+	return ok
+}
+
+func init() {
+	// Парсер принимает имя после числа как единицу, только если оно есть в таблице
+	ast.IsUnit = IsUnit
+}
+
+func (d Dimension) mul(other Dimension) Dimension {
+	for i := range d {
+		d[i] += other[i]
+	}
+	return d
+}
+
+func (d Dimension) div(other Dimension) Dimension {
+	for i := range d {
+		d[i] -= other[i]
+	}
+	return d
+}
+
+func (d Dimension) pow(exponent int) Dimension {
+	for i := range d {
+		d[i] *= exponent
+	}
+	return d
+}
+
+// String возвращает запись размерности в основных единицах СИ: "m/s", "kg*m^2/s^2", "1/s".
+// Безразмерная величина записывается пустой строкой
+func (d Dimension) String() string {
+	var numerator, denominator []string
+	for i, exponent := range d {
+		factor := dimensionUnits[i]
+		if abs := max(exponent, -exponent); abs > 1 {
+			factor += "^" + strconv.Itoa(abs)
+		}
+		switch {
+		case exponent > 0:
+			numerator = append(numerator, factor)
+		case exponent < 0:
+			denominator = append(denominator, factor)
+		}
+	}
+
+	text := strings.Join(numerator, "*")
+	if len(denominator) == 0 {
+		return text
+	}
+	if text == "" {
+		text = "1"
+	}
+	if len(denominator) > 1 {
+		return text + "/(" + strings.Join(denominator, "*") + ")"
+	}
+	return text + "/" + denominator[0]
+}
+
+// lookupUnit разбирает единицу после числа: имена с необязательной степенью,
+// разделённые "/" ("km", "m^2", "m/s^2")
+func lookupUnit(text string) (scale *big.Rat, dimension Dimension, ok bool) {
+	factors := strings.Split(text, "/")
+	scale, dimension, ok = lookupUnitFactor(factors[0])
+	for _, factor := range factors[1:] {
+		if !ok {
+			break
+		}
+		var divisorScale *big.Rat
+		var divisorDimension Dimension
+		divisorScale, divisorDimension, ok = lookupUnitFactor(factor)
+		if ok {
+			scale.Quo(scale, divisorScale)
+			dimension = dimension.div(divisorDimension)
+		}
+	}
+	if !ok {
+		return nil, Dimension{}, false
+	}
+	return scale, dimension, true
+}
+
+// lookupUnitFactor разбирает имя единицы и необязательную степень ("m^2")
+func lookupUnitFactor(text string) (scale *big.Rat, dimension Dimension, ok bool) {
+	name, exponentText, hasExponent := strings.Cut(text, "^")
+	unit, ok := units[name]
+	if !ok {
+		return nil, Dimension{}, false
+	}
+	exponent := 1
+	if hasExponent {
+		var err error
+		if exponent, err = strconv.Atoi(exponentText); err != nil {
+			return nil, Dimension{}, false
+		}
+	}
+
+	base, _ := ParseDecimal(unit.scale)
+	scale = big.NewRat(1, 1)
+	for i := 0; i < exponent; i++ {
+		scale.Mul(scale, base)
+	}
+	return scale, unit.dimension.pow(exponent), true
+}
+
+// unitText возвращает компактную запись единицы перевода: "km/h" вместо "km / h"
+func unitText(node ast.Node) string {
+	return strings.ReplaceAll(Format(node), " ", "")
+}
+
+// Unit возвращает единицу измерения результата выражения последнего вызова Parse или ToRPN:
+// единицу после "to" или запись размерности в основных единицах СИ ("m/s").
+// Пустая строка - результат безразмерный
+func (c *Calculator) Unit() string {
+	return c.unit
+}
+
+// Функции, результат которых имеет размерность аргументов (все аргументы одной размерности).
+// Значение - число первых аргументов-параметров, которые должны быть безразмерными
+var unitPreservingFunctions = map[string]int{
+	"abs":        0,
+	"min":        0,
+	"max":        0,
+	"sum":        0,
+	"avg":        0,
+	"median":     0,
+	"stddev":     0,
+	"transpose":  0,
+	"percentile": 1,
+}
+
+// dimensionChecker вычисляет размерность выражения до подстановки единиц и отклоняет
+// несовместимые операции: сложение и сравнение величин разной размерности, функции
+// вроде sin от размерной величины, дробную степень размерной величины
+type dimensionChecker struct {
+	calc *Calculator
+}
+
+func incompatibleUnits(offset int, token, format string, args ...any) error {
+	return &SyntaxError{
+		Code:    ErrCodeIncompatibleUnits,
+		Message: "incompatible units: " + fmt.Sprintf(format, args...),
+		Offset:  offset,
+		Token:   token,
+	}
+}
+
+// dimensionName возвращает запись размерности для сообщений об ошибках
+func dimensionName(d Dimension) string {
+	if d == dimensionless {
+		return "dimensionless"
+	}
+	return d.String()
+}
+
+func (v dimensionChecker) VisitNumber(n *ast.Number) (Dimension, error) {
+	if n.Unit == "" {
+		return dimensionless, nil
+	}
+	_, dimension, ok := lookupUnit(n.Unit)
+	if !ok {
+		return Dimension{}, &SyntaxError{
+			Code:    ErrCodeUnknownUnit,
+			Message: fmt.Sprintf("unknown unit: %s", n.Unit),
+			Offset:  n.Offset,
+			Token:   n.Unit,
+		}
+	}
+	return dimension, nil
+}
+
+// VisitIdent: переменные и константы безразмерны. Имя единицы вне записи после числа
+// и вне перевода "to" не является величиной: его отклоняет binder с ошибкой undefined variable
+func (v dimensionChecker) VisitIdent(n *ast.Ident) (Dimension, error) {
+	return dimensionless, nil
+}
+
+func (v dimensionChecker) VisitUnary(n *ast.UnaryOp) (Dimension, error) {
+	operand, err := ast.Walk[Dimension](n.Operand, v)
+	if err != nil {
+		return Dimension{}, err
+	}
+	if n.Op == UnaryNot && operand != dimensionless {
+		return Dimension{}, incompatibleUnits(n.Offset, n.Text, "operator %s requires a dimensionless operand, got %s", n.Text, operand)
+	}
+	return operand, nil
+}
+
+func (v dimensionChecker) VisitBinary(n *ast.BinaryOp) (Dimension, error) {
+	left, err := ast.Walk[Dimension](n.Left, v)
+	if err != nil {
+		return Dimension{}, err
+	}
+
+	if n.Op == OpTo {
+		_, target, ok := unitOf(n.Right)
+		if !ok {
+			return Dimension{}, &SyntaxError{
+				Code:    ErrCodeUnknownUnit,
+				Message: "unknown unit: conversion target must be a unit",
+				Offset:  n.Right.Pos(),
+			}
+		}
+		if left != target {
+			return Dimension{}, incompatibleUnits(n.Offset, n.Text, "%s and %s", dimensionName(left), dimensionName(target))
+		}
+		return left, nil
+	}
+
+	if n.Op == "^" {
+		// Размерную величину можно возвести только в целую степень, записанную числом
+		if left == dimensionless {
+			right, err := ast.Walk[Dimension](n.Right, v)
+			if err != nil {
+				return Dimension{}, err
+			}
+			if right != dimensionless {
+				return Dimension{}, incompatibleUnits(n.Offset, n.Text, "exponent must be dimensionless, got %s", right)
+			}
+			return dimensionless, nil
+		}
+		exponent, ok := integerLiteral(n.Right)
+		if !ok {
+			return Dimension{}, incompatibleUnits(n.Offset, n.Text, "exponent of %s must be an integer number", left)
+		}
+		return left.pow(exponent), nil
+	}
+
+	right, err := ast.Walk[Dimension](n.Right, v)
+	if err != nil {
+		return Dimension{}, err
+	}
+
+	switch n.Op {
+	case "*", OpMatMul:
+		return left.mul(right), nil
+	case "/", OpIntDivide:
+		return left.div(right), nil
+	case "+", "-", OpModulo, OpPlusMinus:
+		if left != right {
+			return Dimension{}, incompatibleUnits(n.Offset, n.Text, "%s and %s", dimensionName(left), dimensionName(right))
+		}
+		return left, nil
+	case OpLess, OpLessEqual, OpGreater, OpGreaterEqual, OpEqual, OpNotEqual:
+		if left != right {
+			return Dimension{}, incompatibleUnits(n.Offset, n.Text, "%s and %s", dimensionName(left), dimensionName(right))
+		}
+		return dimensionless, nil
+	}
+
+	// Логические и побитовые операторы определены только для безразмерных чисел
+	if left != dimensionless || right != dimensionless {
+		return Dimension{}, incompatibleUnits(n.Offset, n.Text, "operator %s requires dimensionless operands", n.Text)
+	}
+	return dimensionless, nil
+}
+
+func (v dimensionChecker) VisitCall(n *ast.Call) (Dimension, error) {
+	args := make([]Dimension, len(n.Args))
+	for i, arg := range n.Args {
+		dimension, err := ast.Walk[Dimension](arg, v)
+		if err != nil {
+			return Dimension{}, err
+		}
+		args[i] = dimension
+	}
+
+	requireDimensionless := func(args []Dimension) error {
+		for _, arg := range args {
+			if arg != dimensionless {
+				return incompatibleUnits(n.Offset, n.Text, "function %s requires a dimensionless argument, got %s", n.Name, arg)
+			}
+		}
+		return nil
+	}
+	sameDimension := func(args []Dimension) (Dimension, error) {
+		if len(args) == 0 {
+			return dimensionless, nil
+		}
+		for _, arg := range args[1:] {
+			if arg != args[0] {
+				return Dimension{}, incompatibleUnits(n.Offset, n.Text, "%s and %s", dimensionName(args[0]), dimensionName(arg))
+			}
+		}
+		return args[0], nil
+	}
+
+	if parameters, ok := unitPreservingFunctions[n.Name]; ok && parameters <= len(args) {
+		if err := requireDimensionless(args[:parameters]); err != nil {
+			return Dimension{}, err
+		}
+		return sameDimension(args[parameters:])
+	}
+
+	switch n.Name {
+	case "round":
+		// Второй аргумент - число знаков
+		if len(args) > 1 {
+			if err := requireDimensionless(args[1:]); err != nil {
+				return Dimension{}, err
+			}
+		}
+		if len(args) > 0 {
+			return args[0], nil
+		}
+	case "sqrt":
+		if len(args) == 1 {
+			for _, exponent := range args[0] {
+				if exponent%2 != 0 {
+					return Dimension{}, incompatibleUnits(n.Offset, n.Text, "sqrt of %s", args[0])
+				}
+			}
+			return halfOf(args[0]), nil
+		}
+	case "variance":
+		dimension, err := sameDimension(args)
+		if err != nil {
+			return Dimension{}, err
+		}
+		return dimension.pow(2), nil
+	case "dot":
+		if len(args) == 2 {
+			return args[0].mul(args[1]), nil
+		}
+	}
+
+	return dimensionless, requireDimensionless(args)
+}
+
+func (v dimensionChecker) VisitConditional(n *ast.Conditional) (Dimension, error) {
+	if _, err := ast.Walk[Dimension](n.Cond, v); err != nil {
+		return Dimension{}, err
+	}
+	then, err := ast.Walk[Dimension](n.Then, v)
+	if err != nil {
+		return Dimension{}, err
+	}
+	otherwise, err := ast.Walk[Dimension](n.Else, v)
+	if err != nil {
+		return Dimension{}, err
+	}
+	if then != otherwise {
+		return Dimension{}, incompatibleUnits(n.Offset, TernaryIf, "%s and %s", dimensionName(then), dimensionName(otherwise))
+	}
+	return then, nil
+}
+
+func (v dimensionChecker) VisitVector(n *ast.Vector) (Dimension, error) {
+	var result Dimension
+	for i, element := range n.Elements {
+		dimension, err := ast.Walk[Dimension](element, v)
+		if err != nil {
+			return Dimension{}, err
+		}
+		if i > 0 && dimension != result {
+			return Dimension{}, incompatibleUnits(element.Pos(), "", "%s and %s", dimensionName(result), dimensionName(dimension))
+		}
+		result = dimension
+	}
+	return result, nil
+}
+
+// halfOf возвращает половину размерности с чётными степенями
+func halfOf(d Dimension) Dimension {
+	for i := range d {
+		d[i] /= 2
+	}
+	return d
+}
+
+// integerLiteral возвращает значение целого литерала, в том числе со знаком
+func integerLiteral(node ast.Node) (int, bool) {
+	switch n := node.(type) {
+	case *ast.Number:
+		if n.Unit != "" {
+			return 0, false
+		}
+		value, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil || value != math.Trunc(value) || math.Abs(value) > 64 {
+			return 0, false
+		}
+		return int(value), true
+	case *ast.UnaryOp:
+		value, ok := integerLiteral(n.Operand)
+		if !ok {
+			return 0, false
+		}
+		switch n.Op {
+		case UnaryMinus:
+			return -value, true
+		case UnaryPlus:
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// unitOf возвращает множитель и размерность записи единицы после "to": имена единиц,
+// соединённые "*" и "/", и целые степени ("kg*m/s^2"). ok = false - узел не единица
+func unitOf(node ast.Node) (scale *big.Rat, dimension Dimension, ok bool) {
+	switch n := node.(type) {
+	case *ast.Ident:
+		unit, ok := units[n.Name]
+		if !ok {
+			return nil, Dimension{}, false
+		}
+		scale, _ := ParseDecimal(unit.scale)
+		return scale, unit.dimension, true
+	case *ast.BinaryOp:
+		switch n.Op {
+		case "*", "/":
+			leftScale, leftDimension, ok := unitOf(n.Left)
+			if !ok {
+				return nil, Dimension{}, false
+			}
+			rightScale, rightDimension, ok := unitOf(n.Right)
+			if !ok {
+				return nil, Dimension{}, false
+			}
+			if n.Op == "*" {
+				return leftScale.Mul(leftScale, rightScale), leftDimension.mul(rightDimension), true
+			}
+			return leftScale.Quo(leftScale, rightScale), leftDimension.div(rightDimension), true
+		case "^":
+			exponent, ok := integerLiteral(n.Right)
+			if !ok {
+				return nil, Dimension{}, false
+			}
+			base, baseDimension, ok := unitOf(n.Left)
+			if !ok {
+				return nil, Dimension{}, false
+			}
+			scale := big.NewRat(1, 1)
+			for i := 0; i < exponent || i < -exponent; i++ {
+				scale.Mul(scale, base)
+			}
+			if exponent < 0 {
+				scale.Inv(scale)
+			}
+			return scale, baseDimension.pow(exponent), true
+		}
+	}
+	return nil, Dimension{}, false
+}
+
+// checkUnits проверяет размерности дерева до подстановки и запоминает единицу результата
+func (c *Calculator) checkUnits(node ast.Node) error {
+	dimension, err := ast.Walk[Dimension](node, dimensionChecker{calc: c})
+	if err != nil {
+		return err
+	}
+	c.unit = dimension.String()
+	if conversion, ok := node.(*ast.BinaryOp); ok && conversion.Op == OpTo {
+		c.unit = unitText(conversion.Right)
+	}
+	return nil
+}
+
+// scaleQuantity переводит число с единицей в основные единицы СИ без потери точности
+func scaleQuantity(n *ast.Number) (*ast.Number, error) {
+	scale, _, ok := lookupUnit(n.Unit)
+	if !ok {
+		return nil, &SyntaxError{
+			Code:    ErrCodeUnknownUnit,
+			Message: fmt.Sprintf("unknown unit: %s", n.Unit),
+			Offset:  n.Offset,
+			Token:   n.Unit,
+		}
+	}
+	value, err := ParseDecimal(n.Value)
+	if err != nil {
+		return nil, err
+	}
+	scaled := FormatDecimal(value.Mul(value, scale))
+	return &ast.Number{Value: scaled, Text: n.Text + " " + n.Unit, Offset: n.Offset}, nil
+}
@@ -2,7 +2,9 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"gocalc/internal/calculator"
 	"gocalc/internal/models"
 	"log"
 	"sync"
@@ -52,6 +54,15 @@ func createTables() {
 			status TEXT NOT NULL,
 			result REAL,
 			created_at TEXT NOT NULL DEFAULT (strftime('%d.%m.%Y %H:%M:%S', 'now')),
+			variables TEXT,
+			precision TEXT,
+			result_text TEXT,
+			canonical TEXT,
+			result_tensor TEXT,
+			critical_path INTEGER NOT NULL DEFAULT 0,
+			result_low REAL,
+			result_high REAL,
+			unit TEXT,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)
 	`)
@@ -81,6 +92,41 @@ func applyMigrations() {
 			panic(fmt.Sprintf("Ошибка добавления столбца created_at: %v", err))
 		}
 	}
+
+	// Столбец variables хранит привязки переменных выражения в формате JSON
+	addColumnIfNotExists("expressions", "variables", "TEXT")
+	// Режим точности и точный текстовый результат (режим decimal)
+	addColumnIfNotExists("expressions", "precision", "TEXT")
+	addColumnIfNotExists("expressions", "result_text", "TEXT")
+	// Каноническая запись выражения для дедупликации истории и отчётов
+	addColumnIfNotExists("expressions", "canonical", "TEXT")
+	// Результат-вектор или матрица в формате JSON
+	addColumnIfNotExists("expressions", "result_tensor", "TEXT")
+	// Длина критического пути задач выражения
+	addColumnIfNotExists("expressions", "critical_path", "INTEGER NOT NULL DEFAULT 0")
+	// Границы результата в режиме interval
+	addColumnIfNotExists("expressions", "result_low", "REAL")
+	addColumnIfNotExists("expressions", "result_high", "REAL")
+	// Единица измерения результата
+	addColumnIfNotExists("expressions", "unit", "TEXT")
+	// Локаль пользователя: разделители в записи чисел
+	addColumnIfNotExists("users", "locale", "TEXT NOT NULL DEFAULT 'en'")
+}
+
+// addColumnIfNotExists добавляет столбец в таблицу, если его ещё нет
+func addColumnIfNotExists(table, column, definition string) {
+	var count int
+	err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name='%s'", table, column)).Scan(&count)
+	if err != nil {
+		panic(fmt.Sprintf("Ошибка проверки существования столбца %s: %v", column, err))
+	}
+
+	if count == 0 {
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+		if err != nil {
+			panic(fmt.Sprintf("Ошибка добавления столбца %s: %v", column, err))
+		}
+	}
 }
 
 // CreateUser создает нового пользователя в базе данных
@@ -118,7 +164,7 @@ func CreateUser(login, password string) (int, error) {
 
 func GetUser(login string) (*models.User, error) {
 	var user models.User
-	err := db.QueryRow("SELECT id, login, password FROM users WHERE login = ?", login).Scan(&user.ID, &user.Login, &user.Password)
+	err := db.QueryRow("SELECT id, login, password, locale FROM users WHERE login = ?", login).Scan(&user.ID, &user.Login, &user.Password, &user.Locale)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // Пользователь не найден
@@ -129,6 +175,32 @@ func GetUser(login string) (*models.User, error) {
 	return &user, nil
 }
 
+// GetUserLocale возвращает локаль пользователя. Для неизвестного пользователя
+// возвращается локаль по умолчанию
+func GetUserLocale(userID int) (string, error) {
+	var locale string
+	err := db.QueryRow("SELECT locale FROM users WHERE id = ?", userID).Scan(&locale)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return calculator.DefaultLocale, nil
+		}
+		return "", fmt.Errorf("ошибка получения локали пользователя: %w", err)
+	}
+	return locale, nil
+}
+
+// SetUserLocale сохраняет локаль пользователя
+func SetUserLocale(userID int, locale string) error {
+	result, err := db.Exec("UPDATE users SET locale = ? WHERE id = ?", locale, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения локали пользователя: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("пользователь %d не найден", userID)
+	}
+	return nil
+}
+
 // SaveExpression сохраняет выражение в базе данных
 func SaveExpression(expression *models.Expression, userID int) error {
 	// Если дата не установлена, устанавливаем текущую
@@ -136,9 +208,29 @@ func SaveExpression(expression *models.Expression, userID int) error {
 		expression.CreatedAt = time.Now().Format("02.01.2006 15:04:05")
 	}
 
+	var variables sql.NullString
+	if len(expression.Variables) > 0 {
+		data, err := json.Marshal(expression.Variables)
+		if err != nil {
+			return fmt.Errorf("ошибка сериализации переменных выражения: %w", err)
+		}
+		variables = sql.NullString{String: string(data), Valid: true}
+	}
+
+	var tensor sql.NullString
+	if expression.ResultTensor != nil {
+		data, err := json.Marshal(expression.ResultTensor)
+		if err != nil {
+			return fmt.Errorf("ошибка сериализации результата выражения: %w", err)
+		}
+		tensor = sql.NullString{String: string(data), Valid: true}
+	}
+
 	_, err := db.Exec(
-		"INSERT INTO expressions (id, user_id, text, status, result, created_at) VALUES (?, ?, ?, ?, ?, ?)",
-		expression.ID, userID, expression.Text, expression.Status, expression.Result, expression.CreatedAt,
+		"INSERT INTO expressions (id, user_id, text, status, result, created_at, variables, precision, result_text, canonical, result_tensor, critical_path, result_low, result_high, unit) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		expression.ID, userID, expression.Text, expression.Status, expression.Result, expression.CreatedAt, variables,
+		expression.Precision, expression.ResultText, expression.Canonical, tensor, expression.CriticalPath,
+		expression.ResultLow, expression.ResultHigh, expression.Unit,
 	)
 	if err != nil {
 		return fmt.Errorf("ошибка сохранения выражения: %w", err)
@@ -150,9 +242,46 @@ func SaveExpression(expression *models.Expression, userID int) error {
 	return nil
 }
 
+// Столбцы выражения в порядке, в котором их читает scanExpression
+const expressionColumns = "id, text, status, result, created_at, variables, precision, result_text, canonical, result_tensor, critical_path, result_low, result_high, unit"
+
+// rowScanner - общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanExpression читает выражение из строки результата запроса по столбцам expressionColumns
+func scanExpression(row rowScanner) (models.Expression, error) {
+	var expr models.Expression
+	var variables, precision, resultText, canonical, tensor, unit sql.NullString
+	var resultLow, resultHigh sql.NullFloat64
+	err := row.Scan(&expr.ID, &expr.Text, &expr.Status, &expr.Result, &expr.CreatedAt, &variables, &precision, &resultText, &canonical, &tensor, &expr.CriticalPath, &resultLow, &resultHigh, &unit)
+	if err != nil {
+		return expr, err
+	}
+	if variables.Valid {
+		if err := json.Unmarshal([]byte(variables.String), &expr.Variables); err != nil {
+			return expr, fmt.Errorf("ошибка чтения переменных выражения: %w", err)
+		}
+	}
+	if tensor.Valid {
+		if err := json.Unmarshal([]byte(tensor.String), &expr.ResultTensor); err != nil {
+			return expr, fmt.Errorf("ошибка чтения результата выражения: %w", err)
+		}
+	}
+	expr.Precision = precision.String
+	expr.ResultText = resultText.String
+	expr.Canonical = canonical.String
+	expr.Unit = unit.String
+	if resultLow.Valid && resultHigh.Valid {
+		expr.ResultLow, expr.ResultHigh = &resultLow.Float64, &resultHigh.Float64
+	}
+	return expr, nil
+}
+
 // GetExpressions возвращает все выражения пользователя
 func GetExpressions(userID int) ([]models.Expression, error) {
-	rows, err := db.Query("SELECT id, text, status, result, created_at FROM expressions WHERE user_id = ?", userID)
+	rows, err := db.Query("SELECT "+expressionColumns+" FROM expressions WHERE user_id = ?", userID)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения выражений: %w", err)
 	}
@@ -160,8 +289,7 @@ func GetExpressions(userID int) ([]models.Expression, error) {
 
 	var expressions []models.Expression
 	for rows.Next() {
-		var expr models.Expression
-		err := rows.Scan(&expr.ID, &expr.Text, &expr.Status, &expr.Result, &expr.CreatedAt)
+		expr, err := scanExpression(rows)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка чтения данных выражения: %w", err)
 		}
@@ -171,6 +299,20 @@ func GetExpressions(userID int) ([]models.Expression, error) {
 	return expressions, nil
 }
 
+// GetExpression возвращает сохранённое выражение пользователя по ID
+func GetExpression(id string, userID int) (*models.Expression, error) {
+	row := db.QueryRow("SELECT "+expressionColumns+" FROM expressions WHERE id = ? AND user_id = ?", id, userID)
+	expr, err := scanExpression(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Выражение не найдено
+		}
+		return nil, fmt.Errorf("ошибка получения выражения: %w", err)
+	}
+
+	return &expr, nil
+}
+
 // CheckPasswordHash сравнивает пароль и хеш пароля
 func CheckPasswordHash(password, hash string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
@@ -2,6 +2,7 @@ package grpc
 
 import (
 	"context"
+	"gocalc/internal/calculator"
 	pb "gocalc/proto"
 	"log"
 	"time"
@@ -70,16 +71,50 @@ func (c *CalculatorClient) GetTask(agentID string) (*pb.Task, error) {
 	return task, nil
 }
 
+// TaskCancelled проверяет, отменено ли выражение выданной задачи
+func (c *CalculatorClient) TaskCancelled(taskID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	res, err := c.client.GetTaskStatus(ctx, &pb.TaskStatusRequest{Id: taskID})
+	if err != nil {
+		return false, err
+	}
+	return res.Cancelled, nil
+}
+
 // SubmitTaskResult отправляет результат вычисления оркестратору
 func (c *CalculatorClient) SubmitTaskResult(taskID string, result float64) error {
+	return c.SubmitDecimalTaskResult(taskID, result, "")
+}
+
+// SubmitDecimalTaskResult отправляет результат вместе с точным значением (режим decimal)
+func (c *CalculatorClient) SubmitDecimalTaskResult(taskID string, result float64, decimal string) error {
+	log.Printf("Отправка результата для задачи %s: %f %s", taskID, result, decimal)
+	return c.submit(&pb.TaskResult{
+		Id:            taskID,
+		Result:        result,
+		ResultDecimal: decimal,
+	})
+}
+
+// SubmitTensorTaskResult отправляет результат операции над векторами и матрицами
+func (c *CalculatorClient) SubmitTensorTaskResult(taskID string, result calculator.Tensor) error {
+	log.Printf("Отправка результата для задачи %s: %s", taskID, result.String())
+	return c.submit(&pb.TaskResult{
+		Id:           taskID,
+		Result:       result.Value(),
+		ResultTensor: TensorToProto(&result),
+	})
+}
+
+// submit отправляет результат задачи оркестратору
+func (c *CalculatorClient) submit(result *pb.TaskResult) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10) // Увеличиваем таймаут
 	defer cancel()
 
-	log.Printf("Отправка результата для задачи %s: %f", taskID, result)
-	res, err := c.client.SubmitTaskResult(ctx, &pb.TaskResult{
-		Id:     taskID,
-		Result: result,
-	})
+	taskID := result.Id
+	res, err := c.client.SubmitTaskResult(ctx, result)
 
 	if err != nil {
 		log.Printf("Ошибка отправки результата для задачи %s: %v", taskID, err)
@@ -40,8 +40,8 @@ func (s *CalculatorServer) GetTask(ctx context.Context, req *pb.TaskRequest) (*p
 		return nil, status.Error(codes.NotFound, "Нет доступных задач")
 	}
 
-	log.Printf("GetTask gRPC: Отправка задачи агенту %s: ID=%s, операция=%s, время=%d мс, arg1=%f, arg2=%f",
-		req.AgentId, task.ID, task.Operation, task.OperationTime, task.Arg1, task.Arg2)
+	log.Printf("GetTask gRPC: Отправка задачи агенту %s: ID=%s, операция=%s, время=%d мс, arg1=%f, arg2=%f, args=%v",
+		req.AgentId, task.ID, task.Operation, task.OperationTime, task.Arg1, task.Arg2, task.Args)
 
 	return &pb.Task{
 		Id:            task.ID,
@@ -50,6 +50,13 @@ func (s *CalculatorServer) GetTask(ctx context.Context, req *pb.TaskRequest) (*p
 		Operation:     task.Operation,
 		OperationTime: int32(task.OperationTime),
 		Priority:      int32(task.Priority),
+		Args:          task.Args,
+		Precision:     task.Precision,
+		Arg1Decimal:   task.Arg1Decimal,
+		Arg2Decimal:   task.Arg2Decimal,
+		ArgsDecimal:   task.ArgsDecimal,
+		Arg1Tensor:    TensorToProto(task.Arg1Tensor),
+		Arg2Tensor:    TensorToProto(task.Arg2Tensor),
 	}, nil
 }
 
@@ -58,8 +65,10 @@ func (s *CalculatorServer) SubmitTaskResult(ctx context.Context, result *pb.Task
 	defer s.mu.Unlock()
 
 	err := s.taskManager.SubmitTaskResult(orchestrator.TaskResult{
-		ID:     result.Id,
-		Result: result.Result,
+		ID:      result.Id,
+		Result:  result.Result,
+		Decimal: result.ResultDecimal,
+		Tensor:  TensorFromProto(result.ResultTensor),
 	})
 
 	if err != nil {
@@ -76,6 +85,11 @@ func (s *CalculatorServer) SubmitTaskResult(ctx context.Context, result *pb.Task
 	}, nil
 }
 
+// GetTaskStatus сообщает агенту, нужен ли ещё результат выданной задачи
+func (s *CalculatorServer) GetTaskStatus(ctx context.Context, req *pb.TaskStatusRequest) (*pb.TaskStatus, error) {
+	return &pb.TaskStatus{Cancelled: s.taskManager.TaskCancelled(req.Id)}, nil
+}
+
 // запускает gRPC сервер
 func StartServer(address string, taskManager *orchestrator.TaskManager) error {
 	lis, err := net.Listen("tcp", address)
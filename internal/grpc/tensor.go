@@ -0,0 +1,30 @@
+package grpc
+
+import (
+	"gocalc/internal/calculator"
+	pb "gocalc/proto"
+)
+
+// TensorToProto преобразует вектор или матрицу в сообщение gRPC; nil остаётся nil
+func TensorToProto(t *calculator.Tensor) *pb.Tensor {
+	if t == nil {
+		return nil
+	}
+	shape := make([]int32, len(t.Shape))
+	for i, n := range t.Shape {
+		shape[i] = int32(n)
+	}
+	return &pb.Tensor{Shape: shape, Values: t.Values}
+}
+
+// TensorFromProto преобразует сообщение gRPC в вектор или матрицу; nil остаётся nil
+func TensorFromProto(t *pb.Tensor) *calculator.Tensor {
+	if t == nil {
+		return nil
+	}
+	shape := make([]int, len(t.Shape))
+	for i, n := range t.Shape {
+		shape[i] = int(n)
+	}
+	return &calculator.Tensor{Shape: shape, Values: t.Values}
+}
@@ -1,11 +1,23 @@
 package models
 
+import "gocalc/internal/calculator"
+
 type Expression struct {
-	ID        string  `json:"id"`
-	Text      string  `json:"text"`
-	Status    string  `json:"status"`
-	Result    float64 `json:"result"`
-	CreatedAt string  `json:"created_at"`
+	ID           string             `json:"id"`
+	Text         string             `json:"text"`
+	Canonical    string             `json:"canonical,omitempty"`
+	Variables    map[string]float64 `json:"variables,omitempty"`
+	Precision    string             `json:"precision,omitempty"`
+	Status       string             `json:"status"`
+	Result       float64            `json:"result"`
+	Unit         string             `json:"unit,omitempty"`
+	ResultText   string             `json:"result_text,omitempty"`
+	ResultLow    *float64           `json:"result_low,omitempty"`
+	ResultHigh   *float64           `json:"result_high,omitempty"`
+	ResultTensor *calculator.Tensor `json:"result_tensor,omitempty"`
+	CriticalPath int                `json:"critical_path,omitempty"`
+	Formatted    string             `json:"formatted,omitempty"` // Результат в записи локали пользователя, не хранится в БД
+	CreatedAt    string             `json:"created_at"`
 }
 
 type Task struct {
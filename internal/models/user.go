@@ -5,6 +5,7 @@ type User struct {
 	ID       int    `json:"id"`
 	Login    string `json:"login"`
 	Password string `json:"-"` // Не сериализуем пароль в JSON
+	Locale   string `json:"locale"`
 }
 
 // LoginRequest представляет запрос на вход в систему
@@ -17,6 +18,12 @@ type LoginRequest struct {
 type RegisterRequest struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
+	Locale   string `json:"locale,omitempty"` // Локаль для записи чисел, по умолчанию "en"
+}
+
+// SettingsRequest представляет настройки пользователя
+type SettingsRequest struct {
+	Locale string `json:"locale"`
 }
 
 // AuthResponse представляет ответ после успешной аутентификации
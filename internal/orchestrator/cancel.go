@@ -0,0 +1,98 @@
+package orchestrator
+
+import (
+	"errors"
+	"gocalc/internal/models"
+	"log"
+	"time"
+)
+
+// withdrawnRetention - сколько хранится отметка об отозванной задаче: опоздавший
+// результат за это время подтверждается агенту, а не отклоняется как неизвестный
+const withdrawnRetention = 10 * time.Minute
+
+var (
+	ErrExpressionNotFound = errors.New("выражение не найдено")
+	ErrExpressionFinished = errors.New("вычисление выражения уже завершено")
+)
+
+// CancelExpression отменяет вычисление выражения: статус CANCELLED, невыданные задачи
+// удаляются, а результаты уже выданных агентам задач будут приняты и отброшены
+func (tm *TaskManager) CancelExpression(exprID string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	expr, exists := tm.expressions[exprID]
+	if !exists {
+		return ErrExpressionNotFound
+	}
+	if expr.Status != "PROCESSING" {
+		return ErrExpressionFinished
+	}
+
+	log.Printf("Отмена выражения %s", exprID)
+	tm.abortExpression(exprID, "CANCELLED", "")
+	return nil
+}
+
+// TaskCancelled сообщает агенту, что результат выданной задачи больше не нужен:
+// её выражение отменено или уже завершено
+func (tm *TaskManager) TaskCancelled(taskID string) bool {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	if _, ok := tm.withdrawn[taskID]; ok {
+		return true
+	}
+	_, exists := tm.taskToExpression[taskID]
+	return !exists
+}
+
+// abortExpression завершает невычисленное выражение со статусом status (ERROR, CANCELLED, TIMEOUT),
+// сохраняет его в БД и удаляет все его задачи. Задачи, хотя бы раз выданные агентам (в том числе
+// с истёкшей арендой), помечаются отозванными, чтобы опоздавшие результаты были
+// приняты и отброшены.
+// Вызывается под tm.mu
+func (tm *TaskManager) abortExpression(exprID, status, reason string) {
+	expr, exists := tm.expressions[exprID]
+	if !exists {
+		return
+	}
+	delete(tm.deadlines, exprID)
+	expr.Status = status
+	expr.Error = reason
+	tm.expressions[exprID] = expr
+
+	dbExpr := models.Expression{
+		ID:           expr.ID,
+		Text:         expr.Original,
+		Canonical:    expr.Canonical,
+		Variables:    expr.Variables,
+		Precision:    expr.Precision,
+		Status:       expr.Status,
+		Unit:         expr.Unit,
+		CriticalPath: expr.CriticalPath,
+		CreatedAt:    expr.CreatedAt,
+	}
+	_ = SaveExpressionFunc(&dbExpr, tm.userIDs[exprID])
+
+	now := time.Now()
+	for _, taskID := range tm.expressionTasks[exprID] {
+		if tm.attempts[taskID] > 0 {
+			tm.withdrawn[taskID] = now
+		}
+		tm.forgetTask(taskID)
+	}
+	delete(tm.expressionTasks, exprID)
+	delete(tm.expressionRoots, exprID)
+}
+
+// pruneWithdrawn удаляет отметки об отозванных задачах старше withdrawnRetention.
+// Вызывается под tm.mu
+func (tm *TaskManager) pruneWithdrawn(now time.Time) {
+	for taskID, at := range tm.withdrawn {
+		if now.Sub(at) >= withdrawnRetention {
+			delete(tm.withdrawn, taskID)
+		}
+	}
+}
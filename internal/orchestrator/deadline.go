@@ -0,0 +1,66 @@
+package orchestrator
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// setDeadline назначает выражению срок вычисления: timeout из запроса или
+// tm.defaultTimeout (EXPRESSION_TIMEOUT_MS). Вызывается под tm.mu
+func (tm *TaskManager) setDeadline(exprID string, timeout time.Duration, now time.Time) {
+	if timeout <= 0 {
+		timeout = tm.defaultTimeout
+	}
+	if timeout <= 0 {
+		return
+	}
+	tm.deadlines[exprID] = now.Add(timeout)
+}
+
+// expireDeadlines завершает со статусом TIMEOUT выражения, не вычисленные к сроку.
+// Вызывается под tm.mu
+func (tm *TaskManager) expireDeadlines(now time.Time) {
+	for exprID, deadline := range tm.deadlines {
+		if now.Before(deadline) {
+			continue
+		}
+		delete(tm.deadlines, exprID)
+		if expr, exists := tm.expressions[exprID]; !exists || expr.Status != "PROCESSING" {
+			continue
+		}
+
+		log.Printf("Истёк срок вычисления выражения %s", exprID)
+		tm.abortExpression(exprID, "TIMEOUT", fmt.Sprintf("expression was not completed by %s", deadline.Format("02.01.2006 15:04:05")))
+	}
+}
+
+// ReapExpired завершает просроченные выражения, возвращает в очередь задачи
+// с истёкшей арендой и забывает давно отозванные задачи на момент now
+func (tm *TaskManager) ReapExpired(now time.Time) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.expireDeadlines(now)
+	tm.reclaimExpiredLeases(now)
+	tm.pruneWithdrawn(now)
+}
+
+// StartReaper запускает фоновую проверку сроков раз в interval: выражения завершаются
+// по сроку, даже если ни один агент не подключён. Возвращает функцию остановки
+func (tm *TaskManager) StartReaper(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				tm.ReapExpired(now)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,853 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"gocalc/internal/ast"
+	"gocalc/internal/calculator"
+	"log"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// taskOperand - операнд задачи: число, вектор, матрица или результат другой задачи (условного узла)
+type taskOperand struct {
+	value   float64
+	decimal string             // Точное значение числа в режиме decimal или интервал в режиме interval
+	tensor  *calculator.Tensor // Значение вектора или матрицы (isNum == true)
+	shape   []int              // Размерность значения: пустая у числа
+	taskID  string
+	isNum   bool
+	subtree []string // Задачи и условные узлы, из которых вычисляется операнд
+	depth   int      // Длина критического пути: наибольшее число задач, выполняемых друг за другом
+}
+
+// taskBuilder разбивает дерево выражения на задачи для агентов.
+// Вызывается под tm.mu
+type taskBuilder struct {
+	tm        *TaskManager
+	exprID    string
+	precision string
+	fold      bool                   // Вычислять операции над числами локально, без задач
+	shared    map[string]taskOperand // Уже созданные задачи по ключу подвыражения
+	taskIDs   []string               // Созданные задачи и условные узлы в порядке создания
+	children  map[string][]string    // Задачи и узлы, результаты которых нужны задаче или узлу
+}
+
+func newTaskBuilder(tm *TaskManager, exprID, precision string) *taskBuilder {
+	return &taskBuilder{
+		tm:        tm,
+		exprID:    exprID,
+		precision: precision,
+		fold:      tm.foldConstants,
+		shared:    make(map[string]taskOperand),
+		children:  make(map[string][]string),
+	}
+}
+
+func (b *taskBuilder) decimal() bool {
+	return b.precision == calculator.PrecisionDecimal
+}
+
+func (b *taskBuilder) interval() bool {
+	return b.precision == calculator.PrecisionInterval
+}
+
+// textual проверяет, что аргументы задач передаются текстом (Arg1Decimal, ArgsDecimal)
+func (b *taskBuilder) textual() bool {
+	return b.decimal() || b.interval()
+}
+
+// subtreeOf собирает поддерево новой задачи из поддеревьев её операндов.
+// Общая задача нескольких операндов входит в поддерево один раз
+func subtreeOf(taskID string, operands ...taskOperand) []string {
+	var subtree []string
+	seen := make(map[string]bool)
+	for _, operand := range operands {
+		for _, id := range operand.subtree {
+			if !seen[id] {
+				seen[id] = true
+				subtree = append(subtree, id)
+			}
+		}
+	}
+	return append(subtree, taskID)
+}
+
+// criticalPath возвращает длину критического пути операндов: задача над ними
+// начинается только после самой длинной цепочки задач среди операндов
+func criticalPath(operands ...taskOperand) int {
+	depth := 0
+	for _, operand := range operands {
+		depth = max(depth, operand.depth)
+	}
+	return depth
+}
+
+// key возвращает запись операнда в ключе подвыражения
+func (o taskOperand) key() string {
+	switch {
+	case !o.isNum:
+		return "#" + o.taskID
+	case o.tensor != nil:
+		return o.tensor.String()
+	case o.decimal != "":
+		return o.decimal
+	}
+	return strconv.FormatFloat(o.value, 'g', -1, 64)
+}
+
+// subexpressionKey возвращает ключ операции над операндами: одинаковые подвыражения
+// имеют одинаковый ключ, так как их операнды - те же числа или те же общие задачи
+func subexpressionKey(operation string, operands ...taskOperand) string {
+	keys := make([]string, len(operands))
+	for i, operand := range operands {
+		keys[i] = operand.key()
+	}
+	return operation + "(" + strings.Join(keys, ",") + ")"
+}
+
+// reuse возвращает задачу, уже созданную для такого же подвыражения
+func (b *taskBuilder) reuse(key string) (taskOperand, bool) {
+	operand, ok := b.shared[key]
+	if ok {
+		log.Printf("Подвыражение %s уже вычисляется задачей %s", key, operand.taskID)
+	}
+	return operand, ok
+}
+
+// foldOperands вычисляет операцию над числами локально, если свёртка включена.
+// При ошибке вычисления задача остаётся агентам: так ведёт себя, например,
+// деление на ноль в ветке условного оператора, которая не будет выбрана
+func (b *taskBuilder) foldOperands(operation string, operands []taskOperand) (taskOperand, bool) {
+	if !b.fold {
+		return taskOperand{}, false
+	}
+	for _, operand := range operands {
+		if !operand.isNum {
+			return taskOperand{}, false
+		}
+	}
+
+	if b.decimal() {
+		args := make([]*big.Rat, len(operands))
+		for i, operand := range operands {
+			arg, err := calculator.ParseDecimal(operand.decimal)
+			if err != nil {
+				return taskOperand{}, false
+			}
+			args[i] = arg
+		}
+		result, err := calculator.ApplyDecimal(operation, args)
+		if err != nil {
+			return taskOperand{}, false
+		}
+		value, _ := result.Float64()
+		return taskOperand{value: value, decimal: calculator.FormatDecimal(result), isNum: true}, true
+	}
+
+	if b.interval() {
+		args := make([]calculator.Interval, len(operands))
+		for i, operand := range operands {
+			arg, err := calculator.ParseInterval(operand.decimal)
+			if err != nil {
+				return taskOperand{}, false
+			}
+			args[i] = arg
+		}
+		result, err := calculator.ApplyInterval(operation, args)
+		if err != nil {
+			return taskOperand{}, false
+		}
+		return intervalOperand(result), true
+	}
+
+	if isTensorOperation(operation, operands) {
+		args := make([]calculator.Tensor, len(operands))
+		for i, operand := range operands {
+			args[i] = operand.asTensor()
+		}
+		result, err := calculator.ApplyTensor(operation, args)
+		if err != nil {
+			return taskOperand{}, false
+		}
+		return tensorOperand(result), true
+	}
+
+	values := make([]float64, len(operands))
+	for i, operand := range operands {
+		values[i] = operand.value
+	}
+	var result float64
+	var err error
+	if calculator.IsFunction(operation) {
+		result, err = calculator.ApplyFunction(operation, values)
+	} else if len(values) == 2 {
+		result, err = calculator.ApplyOperator(operation, values[0], values[1])
+	} else {
+		return taskOperand{}, false
+	}
+	if err != nil {
+		return taskOperand{}, false
+	}
+	return taskOperand{value: result, isNum: true}, true
+}
+
+// isTensorOperation проверяет, что операция выполняется над векторами и матрицами:
+// такие задачи получают аргументы в Arg1Tensor и Arg2Tensor
+func isTensorOperation(operation string, operands []taskOperand) bool {
+	if operation == calculator.OpMatMul || calculator.IsTensorFunction(operation) {
+		return true
+	}
+	for _, operand := range operands {
+		if len(operand.shape) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// asTensor возвращает значение числа или литерала как тензор
+func (o taskOperand) asTensor() calculator.Tensor {
+	if o.tensor != nil {
+		return *o.tensor
+	}
+	return calculator.Scalar(o.value)
+}
+
+// tensorOperand создаёт операнд из значения, вычисленного локально
+func tensorOperand(value calculator.Tensor) taskOperand {
+	if value.IsScalar() {
+		return taskOperand{value: value.Value(), isNum: true}
+	}
+	return taskOperand{tensor: &value, shape: value.Shape, isNum: true}
+}
+
+// operandShapes возвращает размерности операндов
+func operandShapes(operands []taskOperand) [][]int {
+	shapes := make([][]int, len(operands))
+	for i, operand := range operands {
+		shapes[i] = operand.shape
+	}
+	return shapes
+}
+
+// setTensorArg задаёт аргумент arg (1 или 2) задачи над тензорами: литерал передаётся
+// сразу, результат задачи подставляется при выдаче. row и column выбирают строку или
+// столбец матрицы (-1 - значение целиком)
+func (b *taskBuilder) setTensorArg(task *Task, arg int, operand taskOperand, row, column int) {
+	task.TensorArgs = true
+	if !operand.isNum {
+		task.addOperand(Operand{Slot: arg - 1, TaskID: operand.taskID, Row: row, Column: column})
+		return
+	}
+
+	value := operand.asTensor()
+	if row >= 0 {
+		value = value.Row(row)
+	}
+	if column >= 0 {
+		value = value.Column(column)
+	}
+	task.addOperand(Operand{Slot: arg - 1, Value: operand.value, Tensor: &value, Row: -1, Column: -1})
+}
+
+// operandOf возвращает аргумент slot задачи над числами: литерал или ссылку на задачу
+func operandOf(slot int, operand taskOperand) Operand {
+	if operand.isNum {
+		return Operand{Slot: slot, Value: operand.value, Decimal: operand.decimal, Row: -1, Column: -1}
+	}
+	return Operand{Slot: slot, TaskID: operand.taskID, Row: -1, Column: -1}
+}
+
+// sliceKey возвращает ключ строки или столбца операнда для общих задач скалярных произведений
+func sliceKey(operand taskOperand, row, column int) string {
+	return fmt.Sprintf("%s[%d,%d]", operand.key(), row, column)
+}
+
+// matMul разбивает произведение "left @ right" на задачи скалярного произведения строки left на столбец right:
+// задачи выполняются агентами параллельно, а узел сборки составляет из их результатов матрицу
+func (b *taskBuilder) matMul(left, right taskOperand, shape []int) taskOperand {
+	rows, columns := 1, 1
+	if len(left.shape) == 2 {
+		rows = left.shape[0]
+	}
+	if len(right.shape) == 2 {
+		columns = right.shape[1]
+	}
+
+	dotTask := func(row, column int) taskOperand {
+		if len(left.shape) < 2 {
+			row = -1
+		}
+		if len(right.shape) < 2 {
+			column = -1
+		}
+		key := "dot(" + sliceKey(left, row, -1) + "," + sliceKey(right, -1, column) + ")"
+		if shared, ok := b.reuse(key); ok {
+			return shared
+		}
+
+		task := Task{
+			ID:            uuid.New().String(),
+			Operation:     "dot",
+			OperationTime: getEnvOrDefaultInt("TIME_DOT_MS", 530),
+			Priority:      2,
+			Precision:     b.precision,
+		}
+		b.setTensorArg(&task, 1, left, row, -1)
+		b.setTensorArg(&task, 2, right, -1, column)
+		b.addTask(task)
+
+		result := taskOperand{taskID: task.ID, subtree: subtreeOf(task.ID, left, right), depth: criticalPath(left, right) + 1}
+		b.shared[key] = result
+		return result
+	}
+
+	if len(shape) == 0 {
+		return dotTask(0, 0)
+	}
+
+	elements := make([]taskOperand, 0, rows*columns)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < columns; j++ {
+			elements = append(elements, dotTask(i, j))
+		}
+	}
+	log.Printf("Произведение %s @ %s разбито на %d задач скалярного произведения",
+		calculator.ShapeString(left.shape), calculator.ShapeString(right.shape), len(elements))
+	return b.assemble(elements, shape)
+}
+
+// assemble создаёт узел сборки тензора размерности shape из элементов, записанных подряд.
+// Узел не отправляется агентам: он заполняется по мере вычисления задач-элементов
+func (b *taskBuilder) assemble(elements []taskOperand, shape []int) taskOperand {
+	id := uuid.New().String()
+	node := assembly{
+		exprID:  b.exprID,
+		tensor:  calculator.Tensor{Shape: shape},
+		offsets: make(map[string][]int),
+	}
+
+	offset := 0
+	for _, element := range elements {
+		if element.isNum {
+			value := element.asTensor()
+			node.tensor.Values = append(node.tensor.Values, value.Values...)
+			offset += len(value.Values)
+			continue
+		}
+
+		if _, waiting := node.offsets[element.taskID]; !waiting {
+			node.pending++
+			b.tm.assemblyWaiters[element.taskID] = append(b.tm.assemblyWaiters[element.taskID], id)
+		}
+		node.offsets[element.taskID] = append(node.offsets[element.taskID], offset)
+
+		size := 1
+		for _, n := range element.shape {
+			size *= n
+		}
+		node.tensor.Values = append(node.tensor.Values, make([]float64, size)...)
+		offset += size
+	}
+
+	b.tm.assemblies[id] = node
+	b.taskIDs = append(b.taskIDs, id)
+	for _, element := range elements {
+		if !element.isNum {
+			b.addChildren(id, element.taskID)
+		}
+	}
+	return taskOperand{taskID: id, shape: shape, subtree: subtreeOf(id, elements...), depth: criticalPath(elements...)}
+}
+
+// reduce разбивает sum и avg на сбалансированное дерево задач сложения глубиной
+// log2(n): агенты складывают пары параллельно, а не цепочкой из n-1 задач.
+// Среднее - сумма, делённая отдельной задачей на количество аргументов
+func (b *taskBuilder) reduce(name string, operands []taskOperand) (taskOperand, error) {
+	total, err := b.sumTree(operands)
+	if err != nil {
+		return taskOperand{}, err
+	}
+	log.Printf("Функция %s от %d аргументов разбита на дерево сложений", name, len(operands))
+	if name == "sum" || len(operands) == 1 {
+		return total, nil
+	}
+
+	count := taskOperand{value: float64(len(operands)), isNum: true}
+	if b.textual() {
+		count.decimal = strconv.Itoa(len(operands))
+	}
+	return b.binaryTask("/", total, count)
+}
+
+// sumTree складывает половины списка рекурсивно
+func (b *taskBuilder) sumTree(operands []taskOperand) (taskOperand, error) {
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	mid := len(operands) / 2
+	left, err := b.sumTree(operands[:mid])
+	if err != nil {
+		return taskOperand{}, err
+	}
+	right, err := b.sumTree(operands[mid:])
+	if err != nil {
+		return taskOperand{}, err
+	}
+	return b.binaryTask("+", left, right)
+}
+
+// walkBranch разбивает ветку условного оператора. Задачи ветки могут быть отброшены,
+// поэтому ветка использует общие задачи снаружи (не включая их в своё поддерево),
+// но свои задачи наружу и в другую ветку не отдаёт
+func (b *taskBuilder) walkBranch(node ast.Node) (taskOperand, error) {
+	outer := b.shared
+	b.shared = make(map[string]taskOperand, len(outer))
+	for key, operand := range outer {
+		operand.subtree = nil
+		b.shared[key] = operand
+	}
+	defer func() { b.shared = outer }()
+
+	return ast.Walk[taskOperand](node, b)
+}
+
+// addTask регистрирует задачу выражения в менеджере
+func (b *taskBuilder) addTask(task Task) {
+	b.tm.tasks[task.ID] = task
+	b.tm.taskToExpression[task.ID] = b.exprID
+	b.taskIDs = append(b.taskIDs, task.ID)
+	b.addChildren(task.ID, task.Dependencies()...)
+}
+
+// addChildren запоминает, что узлу id нужны результаты children: от них зависят
+// длины путей до результата выражения, а задачи ждут их в очереди готовых
+func (b *taskBuilder) addChildren(id string, children ...string) {
+	for _, child := range children {
+		if child == "" {
+			continue
+		}
+		b.children[id] = append(b.children[id], child)
+		if _, isTask := b.tm.tasks[id]; isTask {
+			b.tm.dependents[child] = append(b.tm.dependents[child], id)
+		}
+	}
+}
+
+// assignDepths задаёт задачам длину самого длинного пути до корня выражения rootID.
+// Узлы создаются после своих операндов, поэтому обратный порядок создания обходит
+// всех родителей узла раньше него самого
+func (b *taskBuilder) assignDepths(rootID string) {
+	remaining := map[string]int{rootID: 0}
+	for i := len(b.taskIDs) - 1; i >= 0; i-- {
+		id := b.taskIDs[i]
+		depth, reachable := remaining[id]
+		if !reachable {
+			continue
+		}
+		// Условные узлы и узлы сборки агентам не выдаются и длину пути не увеличивают
+		if task, isTask := b.tm.tasks[id]; isTask {
+			depth++
+			task.Depth = depth
+			b.tm.tasks[id] = task
+		}
+		for _, child := range b.children[id] {
+			if depth > remaining[child] {
+				remaining[child] = depth
+			}
+		}
+	}
+}
+
+// discard удаляет все созданные задачи, если разбиение не удалось
+func (b *taskBuilder) discard() {
+	for _, id := range b.taskIDs {
+		b.tm.forgetTask(id)
+	}
+	b.taskIDs = nil
+}
+
+func (b *taskBuilder) VisitNumber(n *ast.Number) (taskOperand, error) {
+	num, _ := strconv.ParseFloat(n.Value, 64)
+	item := taskOperand{
+		value: num,
+		isNum: true,
+	}
+	if b.decimal() {
+		exact, err := calculator.ParseDecimal(n.Value)
+		if err != nil {
+			return taskOperand{}, errors.New("invalid expression")
+		}
+		item.decimal = calculator.FormatDecimal(exact)
+	}
+	if b.interval() {
+		item.decimal = calculator.FormatInterval(calculator.Point(num))
+	}
+	return item, nil
+}
+
+func (b *taskBuilder) VisitIdent(n *ast.Ident) (taskOperand, error) {
+	return taskOperand{}, errors.New("invalid expression")
+}
+
+func (b *taskBuilder) VisitCall(n *ast.Call) (taskOperand, error) {
+	operands := make([]taskOperand, len(n.Args))
+	for i, arg := range n.Args {
+		operand, err := ast.Walk[taskOperand](arg, b)
+		if err != nil {
+			return taskOperand{}, err
+		}
+		operands[i] = operand
+	}
+
+	if (n.Name == "sum" || n.Name == "avg") && !isTensorOperation(n.Name, operands) {
+		return b.reduce(n.Name, operands)
+	}
+
+	if folded, ok := b.foldOperands(n.Name, operands); ok {
+		return folded, nil
+	}
+	key := subexpressionKey(n.Name, operands...)
+	if shared, ok := b.reuse(key); ok {
+		return shared, nil
+	}
+
+	taskID := uuid.New().String()
+	task := Task{
+		ID:            taskID,
+		Operation:     n.Name,
+		OperationTime: getEnvOrDefaultInt("TIME_FUNCTION_MS", 600),
+		Priority:      5,
+		Precision:     b.precision,
+	}
+
+	var shape []int
+	if isTensorOperation(n.Name, operands) {
+		var err error
+		if shape, err = calculator.ResultShape(n.Name, operandShapes(operands)); err != nil {
+			return taskOperand{}, err
+		}
+		if n.Name == "dot" {
+			task.OperationTime = getEnvOrDefaultInt("TIME_DOT_MS", 530)
+		}
+		for i, operand := range operands {
+			b.setTensorArg(&task, i+1, operand, -1, -1)
+		}
+	} else {
+		task.Args = make([]float64, len(n.Args))
+		if b.textual() {
+			task.ArgsDecimal = make([]string, len(n.Args))
+		}
+		for i, operand := range operands {
+			task.addOperand(operandOf(i, operand))
+		}
+	}
+
+	log.Printf("Создана задача %s: функция %s от %d аргументов, время выполнения: %d мс",
+		taskID, task.Operation, len(operands), task.OperationTime)
+
+	b.addTask(task)
+	result := taskOperand{taskID: taskID, shape: shape, subtree: subtreeOf(taskID, operands...), depth: criticalPath(operands...) + 1}
+	b.shared[key] = result
+	return result, nil
+}
+
+func (b *taskBuilder) VisitUnary(n *ast.UnaryOp) (taskOperand, error) {
+	operand, err := ast.Walk[taskOperand](n.Operand, b)
+	if err != nil {
+		return taskOperand{}, err
+	}
+
+	// Унарный плюс ничего не меняет
+	if n.Op == calculator.UnaryPlus {
+		return operand, nil
+	}
+
+	// Унарный оператор над числом вычисляем сразу, без отдельной задачи
+	if operand.isNum && operand.tensor != nil {
+		folded, _ := calculator.ApplyTensor(n.Op, []calculator.Tensor{*operand.tensor})
+		return tensorOperand(folded), nil
+	}
+	if operand.isNum {
+		operand.value, _ = calculator.ApplyUnaryOperator(n.Op, operand.value)
+		if b.decimal() {
+			exact, _ := calculator.ParseDecimal(operand.decimal)
+			folded, _ := calculator.ApplyDecimal(n.Op, []*big.Rat{exact})
+			operand.decimal = calculator.FormatDecimal(folded)
+		}
+		if b.interval() {
+			value, _ := calculator.ParseInterval(operand.decimal)
+			folded, _ := calculator.ApplyInterval(n.Op, []calculator.Interval{value})
+			return intervalOperand(folded), nil
+		}
+		return operand, nil
+	}
+
+	key := subexpressionKey(n.Op, operand)
+	if shared, ok := b.reuse(key); ok {
+		return shared, nil
+	}
+
+	taskID := uuid.New().String()
+	task := Task{
+		ID:        taskID,
+		Operation: n.Op,
+		Priority:  3,
+		Precision: b.precision,
+	}
+	if n.Op == calculator.UnaryNot {
+		task.OperationTime = getEnvOrDefaultInt("TIME_LOGICAL_MS", 510)
+	} else {
+		task.OperationTime = getEnvOrDefaultInt("TIME_NEGATION_MS", 500)
+	}
+	if len(operand.shape) > 0 {
+		b.setTensorArg(&task, 1, operand, -1, -1)
+	} else {
+		task.addOperand(operandOf(0, operand))
+	}
+
+	log.Printf("Создана задача %s: операция %s, время выполнения: %d мс",
+		taskID, task.Operation, task.OperationTime)
+
+	b.addTask(task)
+	result := taskOperand{taskID: taskID, shape: operand.shape, subtree: subtreeOf(taskID, operand), depth: operand.depth + 1}
+	b.shared[key] = result
+	return result, nil
+}
+
+func (b *taskBuilder) VisitBinary(n *ast.BinaryOp) (taskOperand, error) {
+	leftOp, err := ast.Walk[taskOperand](n.Left, b)
+	if err != nil {
+		return taskOperand{}, err
+	}
+	rightOp, err := ast.Walk[taskOperand](n.Right, b)
+	if err != nil {
+		return taskOperand{}, err
+	}
+	// Число с погрешностью из чисел - литерал, как и "[4.8, 5.2]": задача для него не нужна
+	if n.Op == calculator.OpPlusMinus && b.interval() && leftOp.isNum && rightOp.isNum {
+		return literalInterval(n.Op, leftOp, rightOp)
+	}
+	return b.binaryTask(n.Op, leftOp, rightOp)
+}
+
+// binaryTask создаёт задачу бинарной операции над готовыми операндами
+func (b *taskBuilder) binaryTask(op string, leftOp, rightOp taskOperand) (taskOperand, error) {
+	if folded, ok := b.foldOperands(op, []taskOperand{leftOp, rightOp}); ok {
+		return folded, nil
+	}
+	key := subexpressionKey(op, leftOp, rightOp)
+	if shared, ok := b.reuse(key); ok {
+		return shared, nil
+	}
+
+	operands := []taskOperand{leftOp, rightOp}
+	tensor := isTensorOperation(op, operands)
+	var shape []int
+	if tensor {
+		var err error
+		if shape, err = calculator.ResultShape(op, operandShapes(operands)); err != nil {
+			return taskOperand{}, err
+		}
+	}
+	if op == calculator.OpMatMul {
+		result := b.matMul(leftOp, rightOp, shape)
+		b.shared[key] = result
+		return result, nil
+	}
+
+	taskID := uuid.New().String()
+	task := Task{
+		ID:        taskID,
+		Operation: op,
+		Precision: b.precision,
+	}
+
+	switch op {
+	case "^":
+		task.Priority = 4
+	case "*", "/", calculator.OpModulo, calculator.OpIntDivide:
+		task.Priority = 2
+	default:
+		task.Priority = 1
+	}
+
+	// Устанавливаем время выполнения операции из переменных окружения
+	switch op {
+	case "+":
+		task.OperationTime = getEnvOrDefaultInt("TIME_ADDITION_MS", 510)
+	case "-":
+		task.OperationTime = getEnvOrDefaultInt("TIME_SUBTRACTION_MS", 520)
+	case "*":
+		task.OperationTime = getEnvOrDefaultInt("TIME_MULTIPLICATIONS_MS", 530)
+	case "/":
+		task.OperationTime = getEnvOrDefaultInt("TIME_DIVISIONS_MS", 540)
+	case "^":
+		task.OperationTime = getEnvOrDefaultInt("TIME_POWER_MS", 550)
+	case calculator.OpModulo:
+		task.OperationTime = getEnvOrDefaultInt("TIME_MODULO_MS", 540)
+	case calculator.OpIntDivide:
+		task.OperationTime = getEnvOrDefaultInt("TIME_INT_DIVISION_MS", 540)
+	case calculator.OpBitAnd, calculator.OpBitOr, calculator.OpBitXor:
+		task.OperationTime = getEnvOrDefaultInt("TIME_BITWISE_MS", 510)
+	case calculator.OpShiftLeft, calculator.OpShiftRight:
+		task.OperationTime = getEnvOrDefaultInt("TIME_SHIFT_MS", 510)
+	case calculator.OpLess, calculator.OpLessEqual, calculator.OpGreater, calculator.OpGreaterEqual,
+		calculator.OpEqual, calculator.OpNotEqual:
+		task.OperationTime = getEnvOrDefaultInt("TIME_COMPARISON_MS", 510)
+	case calculator.OpAnd, calculator.OpOr:
+		task.OperationTime = getEnvOrDefaultInt("TIME_LOGICAL_MS", 510)
+	}
+
+	log.Printf("Создана задача %s: операция %s, время выполнения: %d мс",
+		taskID, op, task.OperationTime)
+
+	if tensor {
+		b.setTensorArg(&task, 1, leftOp, -1, -1)
+		b.setTensorArg(&task, 2, rightOp, -1, -1)
+	} else {
+		task.addOperand(operandOf(0, leftOp))
+		task.addOperand(operandOf(1, rightOp))
+	}
+
+	b.addTask(task)
+	result := taskOperand{taskID: taskID, shape: shape, subtree: subtreeOf(taskID, leftOp, rightOp), depth: criticalPath(leftOp, rightOp) + 1}
+	b.shared[key] = result
+	return result, nil
+}
+
+func (b *taskBuilder) VisitConditional(n *ast.Conditional) (taskOperand, error) {
+	cond, err := ast.Walk[taskOperand](n.Cond, b)
+	if err != nil {
+		return taskOperand{}, err
+	}
+
+	// Условие - число: задачи создаются только для выбранной ветки
+	if cond.isNum {
+		if isTrue(cond.value, cond.decimal) {
+			return ast.Walk[taskOperand](n.Then, b)
+		}
+		return ast.Walk[taskOperand](n.Else, b)
+	}
+
+	then, err := b.walkBranch(n.Then)
+	if err != nil {
+		return taskOperand{}, err
+	}
+	otherwise, err := b.walkBranch(n.Else)
+	if err != nil {
+		return taskOperand{}, err
+	}
+
+	// Результат узла - значение любой из веток, поэтому их размерности должны совпадать
+	if !slices.Equal(then.shape, otherwise.shape) {
+		return taskOperand{}, fmt.Errorf("incompatible shapes: %s and %s",
+			calculator.ShapeString(then.shape), calculator.ShapeString(otherwise.shape))
+	}
+
+	condID := uuid.New().String()
+	node := conditional{
+		exprID:    b.exprID,
+		then:      conditionalBranch{value: then.value, decimal: then.decimal, tensor: then.tensor, taskID: then.taskID, tasks: then.subtree},
+		otherwise: conditionalBranch{value: otherwise.value, decimal: otherwise.decimal, tensor: otherwise.tensor, taskID: otherwise.taskID, tasks: otherwise.subtree},
+	}
+
+	// Задачи обеих веток ждут вычисления условия
+	for _, id := range append(append([]string{}, then.subtree...), otherwise.subtree...) {
+		b.tm.conditionGates[id] = append(b.tm.conditionGates[id], condID)
+	}
+	b.tm.conditionWaiters[cond.taskID] = append(b.tm.conditionWaiters[cond.taskID], condID)
+	b.tm.conditionals[condID] = node
+	b.taskIDs = append(b.taskIDs, condID)
+	b.addChildren(condID, cond.taskID, then.taskID, otherwise.taskID)
+
+	log.Printf("Создан условный узел %s: условие %s, ветки ожидают его результата", condID, cond.taskID)
+
+	// Выполняется только одна ветка, но какая - неизвестно: учитывается более длинная
+	return taskOperand{
+		taskID:  condID,
+		shape:   then.shape,
+		subtree: subtreeOf(condID, cond, then, otherwise),
+		depth:   cond.depth + criticalPath(then, otherwise),
+	}, nil
+}
+
+// VisitVector собирает литерал из чисел локально, а литерал с вычисляемыми элементами -
+// узлом сборки, который ждёт результатов их задач
+func (b *taskBuilder) VisitVector(n *ast.Vector) (taskOperand, error) {
+	if b.interval() {
+		return b.intervalLiteral(n)
+	}
+
+	elements := make([]taskOperand, len(n.Elements))
+	literal := true
+	for i, element := range n.Elements {
+		operand, err := ast.Walk[taskOperand](element, b)
+		if err != nil {
+			return taskOperand{}, err
+		}
+		elements[i] = operand
+		literal = literal && operand.isNum
+	}
+
+	shape, err := calculator.StackShape(operandShapes(elements))
+	if err != nil {
+		return taskOperand{}, err
+	}
+	if literal {
+		values := make([]calculator.Tensor, len(elements))
+		for i, element := range elements {
+			values[i] = element.asTensor()
+		}
+		tensor, err := calculator.StackTensors(values)
+		if err != nil {
+			return taskOperand{}, err
+		}
+		return tensorOperand(tensor), nil
+	}
+	return b.assemble(elements, shape), nil
+}
+
+// intervalLiteral разбирает литерал "[low, high]" режима interval. Литерал из чисел
+// собирается локально, а с вычисляемыми границами - задачей, которая ждёт их результатов
+func (b *taskBuilder) intervalLiteral(n *ast.Vector) (taskOperand, error) {
+	if len(n.Elements) != 2 {
+		return taskOperand{}, errors.New("invalid interval: expected [low, high]")
+	}
+	low, err := ast.Walk[taskOperand](n.Elements[0], b)
+	if err != nil {
+		return taskOperand{}, err
+	}
+	high, err := ast.Walk[taskOperand](n.Elements[1], b)
+	if err != nil {
+		return taskOperand{}, err
+	}
+
+	if low.isNum && high.isNum {
+		return literalInterval(calculator.OpInterval, low, high)
+	}
+	return b.binaryTask(calculator.OpInterval, low, high)
+}
+
+// literalInterval собирает интервал из числовых операндов операции op:
+// границ "[low, high]" или числа с погрешностью "5±0.2"
+func literalInterval(op string, left, right taskOperand) (taskOperand, error) {
+	leftValue, _ := calculator.ParseInterval(left.decimal)
+	rightValue, _ := calculator.ParseInterval(right.decimal)
+	value, err := calculator.ApplyInterval(op, []calculator.Interval{leftValue, rightValue})
+	if err != nil {
+		return taskOperand{}, err
+	}
+	return intervalOperand(value), nil
+}
+
+// intervalOperand возвращает операнд-интервал; value - его середина
+func intervalOperand(value calculator.Interval) taskOperand {
+	return taskOperand{value: value.Mid(), decimal: calculator.FormatInterval(value), isNum: true}
+}
@@ -2,13 +2,16 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"errors"
 	"gocalc/internal/calculator"
+	"gocalc/internal/database"
 	"gocalc/internal/types"
 	"log"
 	"net/http"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -64,7 +67,14 @@ func GetTaskManager() *TaskManager {
 }
 
 type CalculateRequest struct {
-	Expression string `json:"expression"`
+	Expression string             `json:"expression"`
+	Variables  map[string]float64 `json:"variables,omitempty"` // Значения переменных выражения, например {"rate": 0.05}
+	Precision  string             `json:"precision,omitempty"` // Режим точности: "float" (по умолчанию), "decimal" или "interval"
+	// Вычислять цепочки операторов в порядке записи, не перестраивая их (REBALANCE_CHAINS)
+	PreserveOrder bool `json:"preserve_order,omitempty"`
+	// Срок вычисления в миллисекундах, по истечении которого выражение получает статус TIMEOUT.
+	// 0 - срок по умолчанию (EXPRESSION_TIMEOUT_MS)
+	TimeoutMs int `json:"timeout_ms,omitempty"`
 }
 
 func HandleCalculate(w http.ResponseWriter, r *http.Request) {
@@ -88,15 +98,33 @@ func HandleCalculate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	calcReq.Expression = strings.TrimSpace(calcReq.Expression)
+	expression, err := calculator.LocaleFor(UserLocaleFunc(userID)).Normalize(strings.TrimSpace(calcReq.Expression))
+	if err != nil {
+		sendSyntaxError(w, err)
+		return
+	}
+	calcReq.Expression = expression
+	if calcReq.TimeoutMs < 0 {
+		http.Error(w, "timeout_ms must not be negative", http.StatusBadRequest)
+		return
+	}
 
 	log.Printf("Токен действителен, начинаем вычисление выражения через оркестратор-агент")
 	log.Printf("Вызываем локальную обработку выражения: %s", calcReq.Expression)
 
 	// Создаем выражение в TaskManager
-	exprID, err := GetTaskManager().CreateExpression(calcReq.Expression, userID)
+	exprID, err := GetTaskManager().CreateExpressionWithOptions(calcReq.Expression, ExpressionOptions{
+		Variables:     calcReq.Variables,
+		Precision:     calcReq.Precision,
+		PreserveOrder: calcReq.PreserveOrder,
+		Timeout:       time.Duration(calcReq.TimeoutMs) * time.Millisecond,
+	}, userID)
 	if err != nil {
 		log.Printf("Ошибка создания выражения: %v", err)
+		if _, ok := calculator.AsSyntaxError(err); ok {
+			sendSyntaxError(w, err)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -159,6 +187,11 @@ func HandleGetExpressions(w http.ResponseWriter, r *http.Request) {
 	log.Printf("HandleGetExpressions: объединение выражений (глобальные + менеджер)")
 	allExpressions := append(globalExpressions, managerExpressions...)
 
+	locale := calculator.LocaleFor(UserLocaleFunc(userID))
+	for i := range allExpressions {
+		localizeExpression(&allExpressions[i], locale)
+	}
+
 	log.Printf("HandleGetExpressions: сортировка выражений по дате создания")
 	sort.Slice(allExpressions, func(i, j int) bool {
 		return allExpressions[i].CreatedAt > allExpressions[j].CreatedAt
@@ -222,6 +255,8 @@ func HandleGetExpression(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	localizeExpression(&expr, calculator.LocaleFor(UserLocaleFunc(userID)))
+
 	log.Printf("Найдено выражение: ID=%s, статус=%s, оригинал=%s, результат=%f",
 		expr.ID, expr.Status, expr.Original, expr.Result)
 
@@ -239,6 +274,193 @@ func HandleGetExpression(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonData)
 }
 
+// HandleCancelExpression отменяет вычисление выражения: DELETE /api/v1/expressions/{id}
+// или POST /api/v1/expressions/{id}/cancel. Невыданные задачи удаляются, результаты
+// задач, которые агенты уже выполняют, отбрасываются
+func HandleCancelExpression(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	userID, ok := getUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	taskManager := GetTaskManager()
+	if !taskManager.OwnedBy(id, userID) {
+		log.Printf("Выражение с ID %s не принадлежит пользователю %d", id, userID)
+		http.Error(w, "Expression not found", http.StatusNotFound)
+		return
+	}
+
+	switch err := taskManager.CancelExpression(id); {
+	case errors.Is(err, ErrExpressionNotFound):
+		http.Error(w, "Expression not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrExpressionFinished):
+		http.Error(w, "Expression is already finished", http.StatusConflict)
+		return
+	}
+
+	expr, _ := taskManager.GetExpression(id)
+	mu.Lock()
+	expressions[id] = expr
+	mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(expr)
+}
+
+// GetExpressionFunc читает выражение из истории пользователя, когда его уже нет в TaskManager
+var GetExpressionFunc = database.GetExpression
+
+// HandleRenderExpression возвращает типографскую запись сохранённого выражения:
+// GET /api/v1/expressions/{id}/render?format=latex|mathml (по умолчанию latex)
+func HandleRenderExpression(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	userID, ok := getUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = calculator.RenderLaTeX
+	}
+	if format != calculator.RenderLaTeX && format != calculator.RenderMathML {
+		http.Error(w, "Unsupported render format: "+format, http.StatusBadRequest)
+		return
+	}
+
+	taskManager := GetTaskManager()
+	var text string
+	if expr, exists := taskManager.GetExpression(id); exists && taskManager.OwnedBy(id, userID) {
+		text = expr.Original
+	} else {
+		// Выражения прошлых запусков оркестратора есть только в истории пользователя в БД
+		stored, err := GetExpressionFunc(id, userID)
+		if err != nil {
+			log.Printf("Ошибка чтения выражения %s из БД: %v", id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if stored == nil {
+			log.Printf("Выражение с ID %s пользователя %d не найдено", id, userID)
+			http.Error(w, "Expression not found", http.StatusNotFound)
+			return
+		}
+		text = stored.Canonical
+		if text == "" {
+			text = stored.Text
+		}
+	}
+
+	rendered, err := calculator.Render(text, format)
+	if err != nil {
+		log.Printf("Ошибка типографской записи выражения %s: %v", id, err)
+		http.Error(w, "Expression cannot be rendered: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":         id,
+		"expression": text,
+		"format":     format,
+		"rendered":   rendered,
+	})
+}
+
+type DifferentiateRequest struct {
+	Expression string             `json:"expression"`
+	Variable   string             `json:"variable,omitempty"`  // Переменная дифференцирования, по умолчанию "x"
+	At         *float64           `json:"at,omitempty"`        // Точка, в которой нужно вычислить производную
+	Variables  map[string]float64 `json:"variables,omitempty"` // Значения остальных переменных для вычисления в точке
+}
+
+// HandleDifferentiate возвращает упрощённую производную выражения: POST /api/v1/differentiate.
+// Если указана точка "at", производная дополнительно отправляется на вычисление
+// агентами как обычное выражение, и в ответе возвращается его ID
+func HandleDifferentiate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req DifferentiateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	expression, err := calculator.LocaleFor(UserLocaleFunc(userID)).Normalize(strings.TrimSpace(req.Expression))
+	if err != nil {
+		sendSyntaxError(w, err)
+		return
+	}
+	req.Expression = expression
+	if req.Variable == "" {
+		req.Variable = "x"
+	}
+
+	derivative, err := calculator.Differentiate(req.Expression, req.Variable)
+	if err != nil {
+		log.Printf("Ошибка дифференцирования выражения %s: %v", req.Expression, err)
+		if _, ok := calculator.AsSyntaxError(err); ok {
+			sendSyntaxError(w, err)
+			return
+		}
+		http.Error(w, "Expression cannot be differentiated: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	response := map[string]string{
+		"expression": req.Expression,
+		"variable":   req.Variable,
+		"derivative": derivative,
+	}
+	if req.At == nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	// Значение переменной дифференцирования в точке имеет приоритет над переданными переменными
+	variables := make(map[string]float64, len(req.Variables)+1)
+	for name, value := range req.Variables {
+		variables[name] = value
+	}
+	variables[req.Variable] = *req.At
+
+	taskManager := GetTaskManager()
+	exprID, err := taskManager.CreateExpressionWithOptions(derivative, ExpressionOptions{Variables: variables}, userID)
+	if err != nil {
+		log.Printf("Ошибка создания выражения производной: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expr, exists := taskManager.GetExpression(exprID)
+	if !exists {
+		log.Printf("Созданное выражение не найдено: %s", exprID)
+		http.Error(w, "Не удалось создать выражение", http.StatusInternalServerError)
+		return
+	}
+
+	mu.Lock()
+	expressions[exprID] = expr
+	mu.Unlock()
+
+	log.Printf("Производная %s отправлена на вычисление в точке %s=%v: ID=%s", derivative, req.Variable, *req.At, exprID)
+
+	response["id"] = exprID
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
 func HandleGetTask(w http.ResponseWriter, r *http.Request) {
 	task, found := GetTaskManager().GetNextTask()
 	if !found {
@@ -259,8 +481,9 @@ func HandleSubmitTaskResult(w http.ResponseWriter, r *http.Request) {
 
 	// Конвертируем types.TaskResult в orchestrator.TaskResult
 	taskResult := TaskResult{
-		ID:     result.ID,
-		Result: result.Result,
+		ID:      result.ID,
+		Result:  result.Result,
+		Decimal: result.Decimal,
 	}
 
 	err := GetTaskManager().SubmitTaskResult(taskResult)
@@ -296,3 +519,18 @@ func getUserIDFromContext(ctx interface{}) (int, bool) {
 	userID, ok := c.Value("userID").(int)
 	return userID, ok
 }
+
+// sendSyntaxError отвечает 400 с позицией синтаксической ошибки выражения
+func sendSyntaxError(w http.ResponseWriter, err error) {
+	synErr, ok := calculator.AsSyntaxError(err)
+	if !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":        synErr.Error(),
+		"syntax_error": synErr,
+	})
+}
@@ -0,0 +1,64 @@
+package orchestrator
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// lease - аренда выданной агенту задачи: если результат не получен до deadline,
+// задача снова ставится в очередь готовых
+type lease struct {
+	task     Task
+	deadline time.Time
+}
+
+// leaseTask переводит задачу в множество выданных со сроком аренды, вычисленным
+// из времени выполнения операции. Вызывается под tm.mu
+func (tm *TaskManager) leaseTask(task Task, now time.Time) {
+	tm.attempts[task.ID]++
+	deadline := now.Add(time.Duration(task.OperationTime)*time.Millisecond + tm.leaseGrace)
+	tm.inFlight[task.ID] = lease{task: task, deadline: deadline}
+	if tm.nextLeaseExpiry.IsZero() || deadline.Before(tm.nextLeaseExpiry) {
+		tm.nextLeaseExpiry = deadline
+	}
+}
+
+// reclaimExpiredLeases возвращает в очередь задачи с истёкшей арендой. Выражение,
+// задача которого не вычислена за tm.maxAttempts выдач, завершается с ошибкой.
+// Вызывается под tm.mu
+func (tm *TaskManager) reclaimExpiredLeases(now time.Time) {
+	if tm.nextLeaseExpiry.IsZero() || now.Before(tm.nextLeaseExpiry) {
+		return
+	}
+
+	tm.nextLeaseExpiry = time.Time{}
+	for id, l := range tm.inFlight {
+		if now.Before(l.deadline) {
+			if tm.nextLeaseExpiry.IsZero() || l.deadline.Before(tm.nextLeaseExpiry) {
+				tm.nextLeaseExpiry = l.deadline
+			}
+			continue
+		}
+
+		delete(tm.inFlight, id)
+		exprID := tm.taskToExpression[id]
+		if tm.attempts[id] >= tm.maxAttempts {
+			log.Printf("Аренда задачи %s истекла %d раз, выражение %s завершается с ошибкой", id, tm.attempts[id], exprID)
+			tm.abortExpression(exprID, "ERROR", fmt.Sprintf("task %s was not completed after %d attempts", l.task.Operation, tm.attempts[id]))
+			continue
+		}
+
+		log.Printf("Аренда задачи %s истекла (попытка %d из %d), задача возвращается в очередь", id, tm.attempts[id], tm.maxAttempts)
+		tm.tasks[id] = l.task
+		tm.enqueueIfReady(id)
+	}
+}
+
+// ReclaimExpiredLeases возвращает в очередь задачи, аренда которых истекла к моменту now
+func (tm *TaskManager) ReclaimExpiredLeases(now time.Time) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.reclaimExpiredLeases(now)
+}
@@ -3,7 +3,6 @@ package orchestrator
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"gocalc/internal/auth"
 	"gocalc/internal/calculator"
 	"gocalc/internal/database"
@@ -124,26 +123,51 @@ func HandleProtectedCalculate(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
 		return
 	}
+	expression, normalizeErr := calculator.LocaleFor(UserLocaleFunc(userID)).Normalize(calcReq.Expression)
+	if synErr, ok := calculator.AsSyntaxError(normalizeErr); ok {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":        "Invalid expression: " + synErr.Error(),
+			"syntax_error": synErr,
+		})
+		return
+	}
+	calcReq.Expression = expression
+
+	if !calculator.IsValidPrecision(calcReq.Precision) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unsupported precision: " + calcReq.Precision})
+		return
+	}
+	if calcReq.TimeoutMs < 0 {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "timeout_ms must not be negative"})
+		return
+	}
 
 	log.Printf("Вызываем локальную обработку выражения: %s", calcReq.Expression)
 	log.Printf("Expression string: %q", calcReq.Expression)
 
-	var invalidExprError error
-	if calcReq.Expression == "" {
-		invalidExprError = errors.New("empty expression")
-	} else {
-		_, calcErr := calculator.Calc(calcReq.Expression)
-		if calcErr != nil {
-			invalidExprError = calcErr
-		}
-	}
+	_, invalidExprError := calculator.Evaluate(calcReq.Expression, calculator.EvaluateOptions{
+		Precision: calcReq.Precision,
+		Variables: calcReq.Variables,
+	})
 
 	if invalidExprError != nil {
 		exprID := uuid.New().String()
 
+		// Выражение с ошибкой вычисления (например, деление на ноль) разбирается
+		// и имеет каноническую запись, синтаксически неверное - нет
+		canonical, _ := calculator.Canonicalize(calcReq.Expression)
 		expr := types.Expression{
 			ID:        exprID,
 			Original:  calcReq.Expression,
+			Canonical: canonical,
+			Variables: calcReq.Variables,
+			Precision: calcReq.Precision,
 			Status:    "error",
 			Result:    0,
 			CreatedAt: time.Now().Format("02.01.2006 15:04:05"),
@@ -158,6 +182,9 @@ func HandleProtectedCalculate(w http.ResponseWriter, r *http.Request) {
 		dbExpr := models.Expression{
 			ID:        expr.ID,
 			Text:      expr.Original,
+			Canonical: expr.Canonical,
+			Variables: expr.Variables,
+			Precision: expr.Precision,
 			Status:    expr.Status,
 			Result:    expr.Result,
 			CreatedAt: expr.CreatedAt,
@@ -166,18 +193,18 @@ func HandleProtectedCalculate(w http.ResponseWriter, r *http.Request) {
 
 		errMsg := invalidExprError.Error()
 
-		if strings.Contains(errMsg, "invalid character") {
+		// Синтаксические ошибки возвращаются с позицией для подсветки в интерфейсе
+		if synErr, ok := calculator.AsSyntaxError(invalidExprError); ok {
 			w.Header().Set("Content-Type", "application/json; charset=utf-8")
 			w.WriteHeader(http.StatusUnprocessableEntity)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid expression: invalid character"})
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":        "Invalid expression: " + synErr.Error(),
+				"syntax_error": synErr,
+			})
 			return
 		}
 
-		if strings.Contains(errMsg, "empty expression") ||
-			strings.Contains(errMsg, "invalid expression") ||
-			strings.Contains(errMsg, "division by zero") ||
-			strings.Contains(errMsg, "mismatched parentheses") ||
-			strings.Contains(errMsg, "tokenization error") {
+		if calculator.IsEvaluationError(invalidExprError) {
 			w.Header().Set("Content-Type", "application/json; charset=utf-8")
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid expression: " + errMsg})
@@ -191,10 +218,21 @@ func HandleProtectedCalculate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Если выражение валидно, обрабатываем через оркестратор-агент
-	exprID, err := GetTaskManager().CreateExpression(calcReq.Expression, userID)
+	exprID, err := GetTaskManager().CreateExpressionWithOptions(calcReq.Expression, ExpressionOptions{
+		Variables:     calcReq.Variables,
+		Precision:     calcReq.Precision,
+		PreserveOrder: calcReq.PreserveOrder,
+		Timeout:       time.Duration(calcReq.TimeoutMs) * time.Millisecond,
+	}, userID)
 	if err != nil {
 		log.Printf("Ошибка при создании выражения: %v", err)
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		// Размерности веток условного выражения сверяются только при разбиении на задачи
+		if calculator.IsEvaluationError(err) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid expression: " + err.Error()})
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Error processing expression: " + err.Error()})
 		return
@@ -0,0 +1,75 @@
+package orchestrator
+
+import "container/heap"
+
+// readyTask - задача, все зависимости которой вычислены, в очереди на выдачу агентам
+type readyTask struct {
+	id       string
+	priority int    // Task.Priority: задачи с большим приоритетом выдаются раньше
+	sequence uint64 // Порядковый номер выражения: задачи более старых выражений выдаются раньше
+	depth    int    // Task.Depth: задачи, от которых дальше до результата выражения, выдаются раньше
+	order    uint64 // Порядок постановки в очередь при прочих равных
+}
+
+// readyQueue - куча готовых задач (container/heap), в начале - задача, выдаваемая первой
+type readyQueue []readyTask
+
+func (q readyQueue) Len() int { return len(q) }
+
+func (q readyQueue) Less(i, j int) bool {
+	a, b := q[i], q[j]
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if a.sequence != b.sequence {
+		return a.sequence < b.sequence
+	}
+	if a.depth != b.depth {
+		return a.depth > b.depth
+	}
+	return a.order < b.order
+}
+
+func (q readyQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *readyQueue) Push(x any) { *q = append(*q, x.(readyTask)) }
+
+func (q *readyQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// enqueueIfReady ставит задачу в очередь готовых, если она ещё не выдана, не ждёт
+// условия и результаты всех её зависимостей известны. Вызывается под tm.mu
+func (tm *TaskManager) enqueueIfReady(id string) {
+	task, exists := tm.tasks[id]
+	if !exists || tm.queued[id] || len(tm.conditionGates[id]) > 0 {
+		return
+	}
+	for _, depID := range task.Dependencies() {
+		if _, done := tm.taskResults[depID]; !done {
+			return
+		}
+	}
+
+	tm.queueOrder++
+	heap.Push(&tm.ready, readyTask{
+		id:       id,
+		priority: task.Priority,
+		sequence: tm.expressionSequence[tm.taskToExpression[id]],
+		depth:    task.Depth,
+		order:    tm.queueOrder,
+	})
+	tm.queued[id] = true
+}
+
+// notifyDependents проверяет готовность задач, ожидавших результат id
+func (tm *TaskManager) notifyDependents(id string) {
+	dependents := tm.dependents[id]
+	delete(tm.dependents, id)
+	for _, dependentID := range dependents {
+		tm.enqueueIfReady(dependentID)
+	}
+}
@@ -0,0 +1,68 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"gocalc/internal/calculator"
+	"gocalc/internal/database"
+	"gocalc/internal/models"
+	"gocalc/internal/types"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var (
+	UserLocaleFunc    = database.GetUserLocale
+	SetUserLocaleFunc = database.SetUserLocale
+)
+
+// localizeExpression заполняет результат вычисленного выражения в записи локали
+func localizeExpression(expr *types.Expression, locale calculator.Locale) {
+	if strings.EqualFold(expr.Status, "completed") {
+		expr.Formatted = locale.FormatResult(expr.Result, expr.ResultText, expr.ResultTensor)
+	}
+}
+
+// HandleGetSettings возвращает настройки пользователя: GET /api/v1/settings
+func HandleGetSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.SettingsRequest{Locale: calculator.LocaleFor(UserLocaleFunc(userID)).Name})
+}
+
+// HandleUpdateSettings сохраняет настройки пользователя: PUT /api/v1/settings
+// с телом {"locale": "ru"}
+func HandleUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	locale, ok := calculator.LookupLocale(req.Locale)
+	if !ok {
+		http.Error(w, "Unsupported locale: "+req.Locale+" (supported: "+
+			strings.Join(calculator.LocaleNames(), ", ")+")", http.StatusBadRequest)
+		return
+	}
+
+	if err := SetUserLocaleFunc(userID, locale.Name); err != nil {
+		log.Printf("Ошибка сохранения локали пользователя %d: %v", userID, err)
+		http.Error(w, "Не удалось сохранить настройки", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.SettingsRequest{Locale: locale.Name})
+}
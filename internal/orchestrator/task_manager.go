@@ -1,7 +1,9 @@
 package orchestrator
 
 import (
+	"container/heap"
 	"errors"
+	"gocalc/internal/ast"
 	"gocalc/internal/calculator"
 	"gocalc/internal/types"
 	"log"
@@ -20,29 +22,185 @@ var SaveExpressionFunc = database.SaveExpression
 
 // Task представляет задачу для вычисления
 type Task struct {
-	ID            string  // Уникальный идентификатор задачи
-	Arg1          float64 // Первый аргумент
-	Arg2          float64 // Второй аргумент
-	Operation     string  // Операция: "+", "-", "*", "/"
-	OperationTime int     // Время выполнения в мс (для эмуляции нагрузки)
-	Priority      int     // Приоритет задачи (1 - низкий, 2 - высокий)
+	ID            string    // Уникальный идентификатор задачи
+	Arg1          float64   // Первый аргумент
+	Arg2          float64   // Второй аргумент
+	Args          []float64 // Аргументы вызова функции (для операций-функций вместо Arg1/Arg2)
+	Operation     string    // Операция: "+", "-", "*", "/", "^", "neg" и "not" (унарные, используют только Arg1) или имя функции
+	OperationTime int       // Время выполнения в мс (для эмуляции нагрузки)
+	Priority      int       // Приоритет задачи (1 - низкий, 5 - высокий)
+	Depth         int       // Число задач на самом длинном пути от этой задачи до результата выражения, включая её
+
+	// Точный режим (Precision == calculator.PrecisionDecimal): аргументы передаются
+	// текстом без потери точности, пустая строка - аргумент ещё не вычислен.
+	// В режиме calculator.PrecisionInterval так же передаются интервалы "[4.8, 5.2]"
+	Precision   string
+	Arg1Decimal string
+	Arg2Decimal string
+	ArgsDecimal []string
+
+	// Аргументы операций над векторами и матрицами (вместо Arg1/Arg2): nil - аргумент ещё не вычислен
+	TensorArgs bool
+	Arg1Tensor *calculator.Tensor
+	Arg2Tensor *calculator.Tensor
+
+	// Operands описывает каждый аргумент задачи: литерал или результат другой задачи.
+	// Результаты зависимостей подставляются по позиции Slot при выдаче задачи агенту
+	Operands []Operand
+}
+
+// Operand - аргумент задачи: литерал или ссылка на результат другой задачи
+type Operand struct {
+	Slot   int    // Позиция аргумента: 0 - Arg1 (Arg1Tensor), 1 - Arg2 (Arg2Tensor), у функций - индекс в Args
+	TaskID string // Задача, результат которой подставляется в аргумент; "" - литерал
+
+	// Значение литерала
+	Value   float64
+	Decimal string             // Точное значение в режиме decimal или интервал в режиме interval
+	Tensor  *calculator.Tensor // Вектор или матрица
+
+	// Строка и столбец матрицы-результата задачи TaskID, -1 - результат целиком
+	Row    int
+	Column int
+}
+
+// IsLiteral проверяет, что значение аргумента известно при создании задачи
+func (o Operand) IsLiteral() bool {
+	return o.TaskID == ""
+}
+
+// addOperand добавляет аргумент задачи; литерал сразу записывается в свою позицию
+func (t *Task) addOperand(operand Operand) {
+	t.Operands = append(t.Operands, operand)
+	if operand.IsLiteral() {
+		t.setArg(operand.Slot, operand.Value, operand.Decimal, operand.Tensor)
+	}
+}
+
+// setArg записывает значение в аргумент slot. Аргументы задач над тензорами -
+// Arg1Tensor и Arg2Tensor (число передаётся как тензор без размерности),
+// функций - Args и ArgsDecimal, операторов - Arg1 и Arg2 с текстовыми Arg1Decimal и Arg2Decimal
+func (t *Task) setArg(slot int, value float64, decimal string, tensor *calculator.Tensor) {
+	switch {
+	case t.TensorArgs:
+		if tensor == nil {
+			scalar := calculator.Scalar(value)
+			tensor = &scalar
+		}
+		if slot == 0 {
+			t.Arg1Tensor = tensor
+		} else {
+			t.Arg2Tensor = tensor
+		}
+	case t.Args != nil:
+		t.Args[slot] = value
+		if t.ArgsDecimal != nil {
+			t.ArgsDecimal[slot] = decimal
+		}
+	case slot == 0:
+		t.Arg1, t.Arg1Decimal = value, decimal
+	default:
+		t.Arg2, t.Arg2Decimal = value, decimal
+	}
+}
+
+// Dependencies возвращает задачи, результаты которых подставляются в аргументы
+func (t Task) Dependencies() []string {
+	var ids []string
+	for _, operand := range t.Operands {
+		if !operand.IsLiteral() {
+			ids = append(ids, operand.TaskID)
+		}
+	}
+	return ids
 }
 
 type TaskResult struct {
-	ID     string
-	Result float64
+	ID      string
+	Result  float64
+	Decimal string             // Точный результат в режиме decimal
+	Tensor  *calculator.Tensor // Результат-вектор или матрица
+}
+
+// conditionalBranch - ветка условного узла: число или результат задачи
+type conditionalBranch struct {
+	value   float64
+	decimal string
+	tensor  *calculator.Tensor
+	taskID  string   // Пустая строка - ветка является числом
+	tasks   []string // Задачи и условные узлы, из которых вычисляется ветка
+}
+
+// conditional - узел "cond ? a : b". Агентам он не отправляется: когда условие вычислено,
+// задачи невыбранной ветки отбрасываются, а результатом узла становится результат выбранной
+type conditional struct {
+	exprID    string
+	then      conditionalBranch
+	otherwise conditionalBranch
+}
+
+// assembly - узел сборки вектора или матрицы из результатов задач (например, произведения
+// матриц из скалярных произведений строк на столбцы). Агентам он не отправляется
+type assembly struct {
+	exprID  string
+	tensor  calculator.Tensor
+	offsets map[string][]int // Позиции в tensor.Values, с которых записывается результат задачи
+	pending int              // Количество задач, результатов которых ещё нет
+}
+
+// ExpressionOptions задаёт параметры вычисления выражения
+type ExpressionOptions struct {
+	Variables map[string]float64 // Значения переменных, подставляемые до разбиения на задачи
+	Precision string             // Режим точности: "", calculator.PrecisionFloat, calculator.PrecisionDecimal или calculator.PrecisionInterval
+	// PreserveOrder отключает перестройку цепочек ассоциативных операторов (REBALANCE_CHAINS):
+	// операции выполняются в порядке записи, как при локальном вычислении
+	PreserveOrder bool
+	Timeout       time.Duration // Срок вычисления выражения, 0 - EXPRESSION_TIMEOUT_MS
 }
 
 type TaskManager struct {
 	expressions      map[string]types.Expression
 	tasks            map[string]Task
 	taskResults      map[string]float64
+	decimalResults   map[string]string            // Точные результаты задач в режиме decimal
+	tensorResults    map[string]calculator.Tensor // Результаты-векторы и матрицы (в taskResults для них 0)
 	taskToExpression map[string]string
 	expressionTasks  map[string][]string
-	dependsOnTask    map[string][]string
+	expressionRoots  map[string]string      // Задача или условный узел, результат которого - результат выражения
+	conditionals     map[string]conditional // Условные узлы "?:" по их ID
+	conditionGates   map[string][]string    // Условные узлы, до вычисления условий которых задача не выдаётся агентам
+	conditionWaiters map[string][]string    // Условные узлы, ожидающие результат задачи как условие
+	resultForwards   map[string][]string    // Условные узлы, результат которых равен результату задачи (выбранная ветка)
+	assemblies       map[string]assembly    // Узлы сборки векторов и матриц по их ID
+	assemblyWaiters  map[string][]string    // Узлы сборки, ожидающие результат задачи
 	userIDs          map[string]int
-	mu               sync.RWMutex           // Мьютекс для синхронизации
-	calc             *calculator.Calculator // Калькулятор для разбора выражений
+
+	// Очередь готовых задач: задача попадает в неё, когда вычислена её последняя зависимость
+	ready              readyQueue
+	queued             map[string]bool     // Задачи, находящиеся в очереди готовых
+	dependents         map[string][]string // Задачи, в аргументы которых подставляется результат задачи или узла
+	expressionSequence map[string]uint64   // Порядковые номера выражений по их ID
+	lastSequence       uint64
+	queueOrder         uint64
+
+	// Выданные агентам задачи: аренда истекает через OperationTime + leaseGrace
+	inFlight        map[string]lease
+	attempts        map[string]int // Сколько раз задача выдавалась агентам
+	nextLeaseExpiry time.Time      // Ближайший срок аренды, нулевое значение - выданных задач нет
+	leaseGrace      time.Duration  // Запас времени сверх OperationTime (TASK_LEASE_GRACE_MS)
+	maxAttempts     int            // Число выдач задачи, после которого выражение завершается с ошибкой (TASK_MAX_ATTEMPTS)
+
+	// Выданные задачи отменённых и прерванных выражений со временем отзыва:
+	// их опоздавшие результаты подтверждаются агенту и отбрасываются
+	withdrawn map[string]time.Time
+
+	deadlines      map[string]time.Time // Сроки вычисления выражений, после которых они завершаются со статусом TIMEOUT
+	defaultTimeout time.Duration        // Срок вычисления по умолчанию (EXPRESSION_TIMEOUT_MS)
+
+	mu              sync.RWMutex           // Мьютекс для синхронизации
+	calc            *calculator.Calculator // Калькулятор для разбора выражений
+	foldConstants   bool                   // Операции над числами вычисляются локально, без задач (CONSTANT_FOLDING)
+	rebalanceChains bool                   // Цепочки a+b+c+... перестраиваются в дерево глубины log2(n) (REBALANCE_CHAINS)
 }
 
 // NewTaskManager создает новый менеджер задач
@@ -52,16 +210,51 @@ func NewTaskManager() *TaskManager {
 	log.Printf("TIME_SUBTRACTION_MS: %s", os.Getenv("TIME_SUBTRACTION_MS"))
 	log.Printf("TIME_MULTIPLICATIONS_MS: %s", os.Getenv("TIME_MULTIPLICATIONS_MS"))
 	log.Printf("TIME_DIVISIONS_MS: %s", os.Getenv("TIME_DIVISIONS_MS"))
+	log.Printf("TIME_NEGATION_MS: %s", os.Getenv("TIME_NEGATION_MS"))
+	log.Printf("TIME_POWER_MS: %s", os.Getenv("TIME_POWER_MS"))
+	log.Printf("TIME_FUNCTION_MS: %s", os.Getenv("TIME_FUNCTION_MS"))
+	log.Printf("TIME_MODULO_MS: %s", os.Getenv("TIME_MODULO_MS"))
+	log.Printf("TIME_INT_DIVISION_MS: %s", os.Getenv("TIME_INT_DIVISION_MS"))
+	log.Printf("TIME_BITWISE_MS: %s", os.Getenv("TIME_BITWISE_MS"))
+	log.Printf("TIME_SHIFT_MS: %s", os.Getenv("TIME_SHIFT_MS"))
+	log.Printf("TIME_COMPARISON_MS: %s", os.Getenv("TIME_COMPARISON_MS"))
+	log.Printf("TIME_LOGICAL_MS: %s", os.Getenv("TIME_LOGICAL_MS"))
+	log.Printf("TIME_DOT_MS: %s", os.Getenv("TIME_DOT_MS"))
+	log.Printf("CONSTANT_FOLDING: %s", os.Getenv("CONSTANT_FOLDING"))
+	log.Printf("REBALANCE_CHAINS: %s", os.Getenv("REBALANCE_CHAINS"))
+	log.Printf("TASK_LEASE_GRACE_MS: %s", os.Getenv("TASK_LEASE_GRACE_MS"))
+	log.Printf("TASK_MAX_ATTEMPTS: %s", os.Getenv("TASK_MAX_ATTEMPTS"))
+	log.Printf("EXPRESSION_TIMEOUT_MS: %s", os.Getenv("EXPRESSION_TIMEOUT_MS"))
 
 	return &TaskManager{
-		expressions:      make(map[string]types.Expression),
-		tasks:            make(map[string]Task),
-		taskResults:      make(map[string]float64),
-		taskToExpression: make(map[string]string),
-		expressionTasks:  make(map[string][]string),
-		dependsOnTask:    make(map[string][]string),
-		userIDs:          make(map[string]int),
-		calc:             calculator.NewCalculator(),
+		expressions:        make(map[string]types.Expression),
+		tasks:              make(map[string]Task),
+		taskResults:        make(map[string]float64),
+		decimalResults:     make(map[string]string),
+		tensorResults:      make(map[string]calculator.Tensor),
+		taskToExpression:   make(map[string]string),
+		expressionTasks:    make(map[string][]string),
+		expressionRoots:    make(map[string]string),
+		conditionals:       make(map[string]conditional),
+		conditionGates:     make(map[string][]string),
+		conditionWaiters:   make(map[string][]string),
+		resultForwards:     make(map[string][]string),
+		assemblies:         make(map[string]assembly),
+		assemblyWaiters:    make(map[string][]string),
+		userIDs:            make(map[string]int),
+		queued:             make(map[string]bool),
+		dependents:         make(map[string][]string),
+		expressionSequence: make(map[string]uint64),
+		inFlight:           make(map[string]lease),
+		attempts:           make(map[string]int),
+		withdrawn:          make(map[string]time.Time),
+		leaseGrace:         time.Duration(getEnvOrDefaultInt("TASK_LEASE_GRACE_MS", 10000)) * time.Millisecond,
+		maxAttempts:        max(getEnvOrDefaultInt("TASK_MAX_ATTEMPTS", 3), 1),
+		deadlines:          make(map[string]time.Time),
+		defaultTimeout:     time.Duration(getEnvOrDefaultInt("EXPRESSION_TIMEOUT_MS", 300000)) * time.Millisecond,
+		calc:               calculator.NewCalculator(),
+		foldConstants:      getEnvOrDefaultBool("CONSTANT_FOLDING", false),
+		rebalanceChains:    getEnvOrDefaultBool("REBALANCE_CHAINS", false),
 	}
 }
 
@@ -79,173 +272,107 @@ func getEnvOrDefaultInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvOrDefaultBool получает логическое значение переменной окружения или возвращает значение по умолчанию
+func getEnvOrDefaultBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		} else {
+			log.Printf("Ошибка при преобразовании значения переменной %s: %v", key, err)
+		}
+	}
+	return defaultValue
+}
+
 // CreateExpression создает новое выражение и разбивает его на задачи
 func (tm *TaskManager) CreateExpression(expressionText string, userID int) (string, error) {
-	if expressionText == "" {
-		return "", errors.New("empty expression")
-	}
+	return tm.CreateExpressionWithOptions(expressionText, ExpressionOptions{}, userID)
+}
 
-	testCalc := calculator.NewCalculator()
-	_, err := testCalc.Calculate(expressionText)
+// CreateExpressionWithOptions создает выражение с параметрами вычисления.
+// Привязки переменных и режим точности сохраняются в выражении для воспроизводимости истории
+func (tm *TaskManager) CreateExpressionWithOptions(expressionText string, opts ExpressionOptions, userID int) (string, error) {
+	// Выражение проверяется вычислением: ошибку в нём клиент получает сразу, а не от агента
+	checked, err := calculator.Evaluate(expressionText, calculator.EvaluateOptions{
+		Precision: opts.Precision,
+		Variables: opts.Variables,
+	})
 	if err != nil {
-		errStr := err.Error()
-		if errStr == "division by zero" {
-			return "", errors.New("division by zero")
-		} else if errStr == "unexpected character" || errStr == "syntax error" {
-			return "", errors.New("invalid character")
-		} else if errStr == "unbalanced parentheses" {
-			return "", errors.New("mismatched parentheses")
-		} else {
-			return "", errors.New("invalid expression")
+		// Синтаксическая ошибка сохраняется в цепочке: клиенту нужна её позиция
+		if synErr, ok := calculator.AsSyntaxError(err); ok {
+			log.Printf("Синтаксическая ошибка в выражении (%s):\n%s", synErr.Code, synErr.Caret(expressionText))
 		}
+		return "", err
 	}
 
-	// Токенизируем выражение
-	if err := tm.calc.Tokenize(expressionText); err != nil {
-		return "", errors.New("invalid expression")
-	}
-
-	// Преобразуем в RPN
-	rpn, err := tm.calc.ToRPN()
+	// Разбираем выражение в дерево (переменные и единицы измерения подставляются на этом шаге)
+	calc := calculator.NewCalculator()
+	calc.SetVariables(opts.Variables)
+	node, err := calc.Parse(expressionText)
 	if err != nil {
-		return "", errors.New("invalid expression")
+		return "", &calculator.EvaluationError{Err: err}
+	}
+	if tm.rebalanceChains && !opts.PreserveOrder {
+		node = calculator.Rebalance(node)
 	}
 
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	if len(rpn) == 1 && rpn[0].Type == calculator.Number {
-		exprID := uuid.New().String()
-		result, _ := testCalc.Calculate(expressionText)
-
-		taskID := uuid.New().String()
-		task := Task{
-			ID:            taskID,
-			Arg1:          result,
-			Arg2:          0,
-			Operation:     "", // Пустая операция для числа
-			OperationTime: 0,
-			Priority:      1,
-		}
-
-		expr := types.Expression{
-			ID:        exprID,
-			Original:  expressionText,
-			Status:    "PROCESSING", // Изменил статус
-			Result:    result,
-			CreatedAt: time.Now().Format("02.01.2006 15:04:05"),
-		}
-
-		log.Printf("ОТЛАДКА: Создано выражение для числа")
-		log.Printf("ID выражения: %s", exprID)
-		log.Printf("Оригинальное выражение: %s", expressionText)
-		log.Printf("Результат: %f", result)
-		log.Printf("Статус: %s", expr.Status)
-		log.Printf("Время создания: %s", expr.CreatedAt)
-
-		tm.expressions[exprID] = expr
-		tm.tasks[taskID] = task
-		tm.taskToExpression[taskID] = exprID
-		tm.expressionTasks[exprID] = []string{taskID}
-		tm.userIDs[exprID] = userID
-
-		return exprID, nil
-	}
-
 	// Создаем выражение
 	exprID := uuid.New().String()
+	canonical, _ := calculator.Canonicalize(expressionText)
 	expr := types.Expression{
 		ID:        exprID,
 		Original:  expressionText,
+		Canonical: canonical,
+		Variables: opts.Variables,
+		Precision: opts.Precision,
+		Unit:      checked.Unit,
 		Status:    "PROCESSING",
 		CreatedAt: time.Now().Format("02.01.2006 15:04:05"),
 	}
 	tm.expressions[exprID] = expr
 	tm.userIDs[exprID] = userID
+	tm.lastSequence++
+	tm.expressionSequence[exprID] = tm.lastSequence
 
 	// Разбиваем выражение на задачи
-	var taskIDs []string
-	type stackItem struct {
-		value  float64
-		taskID string
-		isNum  bool
-	}
-
-	var stack []stackItem
-
-	// Обработка RPN и создание задач
-	for _, token := range rpn {
-		switch token.Type {
-		case calculator.Number:
-			num, _ := strconv.ParseFloat(token.Value, 64)
-			stack = append(stack, stackItem{
-				value: num,
-				isNum: true,
-			})
-		case calculator.Operator:
-			if len(stack) < 2 {
-				return "", errors.New("invalid expression")
-			}
-
-			taskID := uuid.New().String()
-
-			rightOp := stack[len(stack)-1]
-			leftOp := stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-
-			task := Task{
-				ID:        taskID,
-				Operation: token.Value,
-			}
-
-			if token.Value == "*" || token.Value == "/" {
-				task.Priority = 2
-			} else {
-				task.Priority = 1
-			}
-
-			// Устанавливаем время выполнения операции из переменных окружения
-			switch token.Value {
-			case "+":
-				task.OperationTime = getEnvOrDefaultInt("TIME_ADDITION_MS", 510)
-			case "-":
-				task.OperationTime = getEnvOrDefaultInt("TIME_SUBTRACTION_MS", 520)
-			case "*":
-				task.OperationTime = getEnvOrDefaultInt("TIME_MULTIPLICATIONS_MS", 530)
-			case "/":
-				task.OperationTime = getEnvOrDefaultInt("TIME_DIVISIONS_MS", 540)
-			}
-
-			log.Printf("Создана задача %s: операция %s, время выполнения: %d мс",
-				taskID, token.Value, task.OperationTime)
-
-			if leftOp.isNum {
-				task.Arg1 = leftOp.value
-			} else {
-				task.Arg1 = 0
-				tm.dependsOnTask[taskID] = append(tm.dependsOnTask[taskID], leftOp.taskID)
-			}
-
-			if rightOp.isNum {
-				task.Arg2 = rightOp.value
-			} else {
-				task.Arg2 = 0
-				tm.dependsOnTask[taskID] = append(tm.dependsOnTask[taskID], rightOp.taskID)
-			}
-
-			tm.tasks[taskID] = task
-			tm.taskToExpression[taskID] = exprID
-			taskIDs = append(taskIDs, taskID)
+	builder := newTaskBuilder(tm, exprID, opts.Precision)
+	final, err := ast.Walk[taskOperand](node, builder)
+	if err != nil {
+		delete(tm.expressions, exprID)
+		delete(tm.userIDs, exprID)
+		delete(tm.expressionSequence, exprID)
+		builder.discard()
+		// Например, ветки условного выражения разной размерности обнаруживаются только при разбиении
+		return "", &calculator.EvaluationError{Err: err}
+	}
+	taskIDs := builder.taskIDs
+	expr.CriticalPath = final.depth
+	tm.expressions[exprID] = expr
+	log.Printf("Критический путь выражения %s: %d задач", exprID, final.depth)
 
-			stack = append(stack, stackItem{
-				taskID: taskID,
-				isNum:  false,
-			})
+	// Выражение свелось к числу (одно число, свёртка констант или условия-числа): агенты не нужны
+	if final.isNum {
+		log.Printf("Выражение %s вычислено без задач для агентов: %f", exprID, final.value)
+		if err := tm.completeExpression(exprID, final.value, final.decimal, final.tensor); err != nil {
+			return "", err
 		}
+		return exprID, nil
 	}
+	tm.expressionRoots[exprID] = final.taskID
+	tm.setDeadline(exprID, opts.Timeout, time.Now())
+	builder.assignDepths(final.taskID)
 
 	log.Printf("После создания выражения %s количество задач в taskManager: %d", exprID, len(tm.tasks))
 	for _, taskID := range taskIDs {
+		if _, isConditional := tm.conditionals[taskID]; isConditional {
+			continue
+		}
+		if _, isAssembly := tm.assemblies[taskID]; isAssembly {
+			continue
+		}
 		if _, exists := tm.tasks[taskID]; !exists {
 			log.Printf("ОШИБКА: Задача %s не найдена в tm.tasks после создания", taskID)
 		} else {
@@ -254,167 +381,370 @@ func (tm *TaskManager) CreateExpression(expressionText string, userID int) (stri
 	}
 
 	tm.expressionTasks[exprID] = taskIDs
+	for _, taskID := range taskIDs {
+		tm.enqueueIfReady(taskID)
+	}
 	return exprID, nil
 }
 
+// GetNextTask выдаёт первую задачу из очереди готовых и переводит её в множество
+// выданных до получения результата. Задачи, отброшенные после постановки в очередь
+// (ветки условных выражений), пропускаются
 func (tm *TaskManager) GetNextTask() (Task, bool) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	for id, task := range tm.tasks {
-		dependTaskIDs, hasDependency := tm.dependsOnTask[id]
+	now := time.Now()
+	tm.reclaimExpiredLeases(now)
+
+	for tm.ready.Len() > 0 {
+		item := heap.Pop(&tm.ready).(readyTask)
+		delete(tm.queued, item.id)
 
-		if !hasDependency || len(dependTaskIDs) == 0 {
-			log.Printf("Подготовка задачи %s для распределения. Нет зависимостей.", id)
-			delete(tm.tasks, id)
-			return task, true
+		task, exists := tm.tasks[item.id]
+		if !exists {
+			continue
 		}
+		log.Printf("Подготовка задачи %s. Все зависимости выполнены.", item.id)
+		tm.bindOperands(&task)
+		delete(tm.tasks, item.id)
+		tm.leaseTask(task, now)
+		return task, true
+	}
 
-		// Проверяем, все ли зависимости выполнены
-		allDepsDone := true
-		for _, depID := range dependTaskIDs {
-			if _, ok := tm.taskResults[depID]; !ok {
-				allDepsDone = false
-				break
-			}
+	return Task{}, false
+}
+
+// bindOperands подставляет результаты зависимостей в аргументы задачи по позициям операндов
+func (tm *TaskManager) bindOperands(task *Task) {
+	for _, operand := range task.Operands {
+		if operand.IsLiteral() {
+			continue
 		}
-		if allDepsDone {
-			log.Printf("Подготовка задачи %s. Все зависимости выполнены.", id)
-			depIdx := 0
-			if task.Arg1 == 0 && depIdx < len(dependTaskIDs) {
-				task.Arg1 = tm.taskResults[dependTaskIDs[depIdx]]
-				depIdx++
+
+		tensor := tm.tensorResult(operand.TaskID)
+		if task.TensorArgs && (operand.Row >= 0 || operand.Column >= 0) {
+			value := calculator.Scalar(tm.taskResults[operand.TaskID])
+			if tensor != nil {
+				value = *tensor
 			}
-			if task.Arg2 == 0 && depIdx < len(dependTaskIDs) {
-				task.Arg2 = tm.taskResults[dependTaskIDs[depIdx]]
+			if operand.Row >= 0 {
+				value = value.Row(operand.Row)
 			}
-			delete(tm.tasks, id)
-			delete(tm.dependsOnTask, id)
-			return task, true
+			if operand.Column >= 0 {
+				value = value.Column(operand.Column)
+			}
+			tensor = &value
 		}
+		task.setArg(operand.Slot, tm.taskResults[operand.TaskID], tm.decimalResults[operand.TaskID], tensor)
 	}
+}
 
-	return Task{}, false
+// tensorResult возвращает результат-вектор или матрицу задачи; nil - результат число
+func (tm *TaskManager) tensorResult(id string) *calculator.Tensor {
+	value, ok := tm.tensorResults[id]
+	if !ok {
+		return nil
+	}
+	return &value
 }
 
-// SubmitTaskResult обрабатывает результат вычисления
-func (tm *TaskManager) SubmitTaskResult(result TaskResult) error {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
+// applyDecimalResult записывает в выражение точный результат,
+// а приближённое значение Result вычисляет из него, а не из float-результатов агентов
+func applyDecimalResult(expr *types.Expression, text string) {
+	if text == "" {
+		return
+	}
+	expr.ResultText = text
+	if exact, err := calculator.ParseDecimal(text); err == nil {
+		expr.Result, _ = exact.Float64()
+	}
+}
 
-	log.Printf("Получен результат задачи %s: %f", result.ID, result.Result)
+// applyIntervalResult записывает в выражение интервал-результат и его границы;
+// Result - середина интервала
+func applyIntervalResult(expr *types.Expression, text string) {
+	if text == "" {
+		return
+	}
+	value, err := calculator.ParseInterval(text)
+	if err != nil {
+		return
+	}
+	expr.ResultText = calculator.FormatInterval(value)
+	expr.ResultLow, expr.ResultHigh = &value.Low, &value.High
+	expr.Result = value.Mid()
+}
 
-	tm.taskResults[result.ID] = result.Result
+// isTrue проверяет истинность условия; в режимах decimal и interval - по текстовому значению.
+// Неопределённые условия-интервалы отклоняются при создании выражения
+func isTrue(value float64, decimal string) bool {
+	if decimal != "" {
+		if exact, err := calculator.ParseDecimal(decimal); err == nil {
+			return exact.Sign() != 0
+		}
+		if interval, err := calculator.ParseInterval(decimal); err == nil {
+			truth, _ := interval.Truth()
+			return truth
+		}
+	}
+	return value != 0
+}
 
-	exprID, exists := tm.taskToExpression[result.ID]
-	if !exists {
-		log.Printf("ОШИБКА: Задача %s не найдена в taskToExpression", result.ID)
-		return errors.New("задача не найдена")
+// withoutIDs возвращает список ids без элементов removed
+func withoutIDs(ids []string, removed []string) []string {
+	if len(removed) == 0 {
+		return ids
+	}
+	skip := make(map[string]bool, len(removed))
+	for _, id := range removed {
+		skip[id] = true
 	}
+	var result []string
+	for _, id := range ids {
+		if !skip[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
 
-	log.Printf("Задача %s связана с выражением %s", result.ID, exprID)
+// storeResult сохраняет результат задачи или условного узла, разрешает условные узлы,
+// для которых он является условием, и передаёт его узлам, выбравшим эту ветку, и узлам сборки
+func (tm *TaskManager) storeResult(id string, result float64, decimal string, tensor *calculator.Tensor) {
+	if tensor != nil && tensor.IsScalar() {
+		result, tensor = tensor.Value(), nil
+	}
+	tm.taskResults[id] = result
+	if decimal != "" {
+		tm.decimalResults[id] = decimal
+	}
+	if tensor != nil {
+		tm.tensorResults[id] = *tensor
+	}
+	tm.notifyDependents(id)
 
-	taskIDs, ok := tm.expressionTasks[exprID]
+	waiters := tm.conditionWaiters[id]
+	delete(tm.conditionWaiters, id)
+	for _, condID := range waiters {
+		tm.resolveConditional(condID, isTrue(result, decimal))
+	}
+
+	forwards := tm.resultForwards[id]
+	delete(tm.resultForwards, id)
+	for _, condID := range forwards {
+		if _, ok := tm.conditionals[condID]; ok {
+			tm.storeResult(condID, result, decimal, tensor)
+		}
+	}
+
+	assemblies := tm.assemblyWaiters[id]
+	delete(tm.assemblyWaiters, id)
+	for _, assemblyID := range assemblies {
+		tm.fillAssembly(assemblyID, id, result, tensor)
+	}
+}
+
+// fillAssembly записывает результат задачи в узел сборки; когда известны все элементы,
+// собранный вектор или матрица становится результатом узла
+func (tm *TaskManager) fillAssembly(assemblyID, taskID string, result float64, tensor *calculator.Tensor) {
+	node, ok := tm.assemblies[assemblyID]
 	if !ok {
-		log.Printf("ОШИБКА: Для выражения %s не найдены связанные задачи", exprID)
-		return errors.New("задачи выражения не найдены")
+		return
 	}
 
-	allTasksCompleted := true
-	completedTasks := 0
-	for _, taskID := range taskIDs {
-		if _, ok := tm.taskResults[taskID]; ok {
-			completedTasks++
+	values := []float64{result}
+	if tensor != nil {
+		values = tensor.Values
+	}
+	for _, offset := range node.offsets[taskID] {
+		copy(node.tensor.Values[offset:], values)
+	}
+	node.pending--
+	tm.assemblies[assemblyID] = node
+
+	if node.pending == 0 {
+		value := node.tensor
+		tm.storeResult(assemblyID, 0, "", &value)
+	}
+}
+
+// resolveConditional выбирает ветку условного узла: задачи другой ветки отбрасываются,
+// задачи выбранной становятся доступны агентам
+func (tm *TaskManager) resolveConditional(condID string, truth bool) {
+	node, ok := tm.conditionals[condID]
+	if !ok {
+		return
+	}
+
+	taken, dropped := node.then, node.otherwise
+	if !truth {
+		taken, dropped = node.otherwise, node.then
+	}
+	log.Printf("Условие узла %s вычислено (%t), отбрасывается задач: %d", condID, truth, len(dropped.tasks))
+
+	tm.discardTasks(node.exprID, dropped.tasks)
+	for _, id := range taken.tasks {
+		gates := withoutIDs(tm.conditionGates[id], []string{condID})
+		if len(gates) == 0 {
+			delete(tm.conditionGates, id)
+			tm.enqueueIfReady(id)
 		} else {
-			allTasksCompleted = false
+			tm.conditionGates[id] = gates
 		}
 	}
 
-	log.Printf("Для выражения %s выполнено %d/%d задач", exprID, completedTasks, len(taskIDs))
+	if taken.taskID == "" {
+		tm.storeResult(condID, taken.value, taken.decimal, taken.tensor)
+		return
+	}
+	if result, done := tm.taskResults[taken.taskID]; done {
+		tm.storeResult(condID, result, tm.decimalResults[taken.taskID], tm.tensorResult(taken.taskID))
+		return
+	}
+	tm.resultForwards[taken.taskID] = append(tm.resultForwards[taken.taskID], condID)
+}
 
-	if allTasksCompleted {
-		log.Printf("Все задачи для выражения %s выполнены, обновляем статус", exprID)
+// discardTasks удаляет задачи и условные узлы невыбранной ветки
+func (tm *TaskManager) discardTasks(exprID string, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	for _, id := range ids {
+		tm.forgetTask(id)
+	}
+	if taskIDs, ok := tm.expressionTasks[exprID]; ok {
+		tm.expressionTasks[exprID] = withoutIDs(taskIDs, ids)
+	}
+}
 
-		expr, exists := tm.expressions[exprID]
-		if !exists {
-			log.Printf("ОШИБКА: Выражение %s не найдено в списке выражений", exprID)
-			return errors.New("выражение не найдено")
-		}
+// forgetTask удаляет все сведения о задаче или условном узле
+func (tm *TaskManager) forgetTask(id string) {
+	delete(tm.tasks, id)
+	delete(tm.taskResults, id)
+	delete(tm.decimalResults, id)
+	delete(tm.tensorResults, id)
+	delete(tm.taskToExpression, id)
+	delete(tm.conditionals, id)
+	delete(tm.conditionGates, id)
+	delete(tm.conditionWaiters, id)
+	delete(tm.resultForwards, id)
+	delete(tm.assemblies, id)
+	delete(tm.assemblyWaiters, id)
+	delete(tm.queued, id)
+	delete(tm.dependents, id)
+	delete(tm.inFlight, id)
+	delete(tm.attempts, id)
+}
 
-		log.Printf("Текущее состояние выражения %s: статус=%s", exprID, expr.Status)
+// completeExpression помечает выражение вычисленным и сохраняет его в БД
+func (tm *TaskManager) completeExpression(exprID string, result float64, decimal string, tensor *calculator.Tensor) error {
+	expr, exists := tm.expressions[exprID]
+	if !exists {
+		log.Printf("ОШИБКА: Выражение %s не найдено в списке выражений", exprID)
+		return errors.New("выражение не найдено")
+	}
 
-		var rootTaskID string
-		isRoot := make(map[string]bool)
-		for _, taskID := range taskIDs {
-			isRoot[taskID] = true
-		}
+	log.Printf("Текущее состояние выражения %s: статус=%s", exprID, expr.Status)
+
+	delete(tm.deadlines, exprID)
+	expr.Status = "COMPLETED"
+	expr.Result = result
+	expr.ResultTensor = tensor
+	switch expr.Precision {
+	case calculator.PrecisionDecimal:
+		applyDecimalResult(&expr, decimal)
+	case calculator.PrecisionInterval:
+		applyIntervalResult(&expr, decimal)
+	}
+	tm.expressions[exprID] = expr
 
-		for _, dependIDs := range tm.dependsOnTask {
-			for _, dependID := range dependIDs {
-				isRoot[dependID] = false
-			}
-		}
+	// Сохраняем в БД
+	dbExpr := models.Expression{
+		ID:           expr.ID,
+		Text:         expr.Original,
+		Canonical:    expr.Canonical,
+		Variables:    expr.Variables,
+		Precision:    expr.Precision,
+		Status:       expr.Status,
+		Result:       expr.Result,
+		Unit:         expr.Unit,
+		ResultText:   expr.ResultText,
+		ResultLow:    expr.ResultLow,
+		ResultHigh:   expr.ResultHigh,
+		ResultTensor: expr.ResultTensor,
+		CriticalPath: expr.CriticalPath,
+		CreatedAt:    expr.CreatedAt,
+	}
+	_ = SaveExpressionFunc(&dbExpr, tm.userIDs[exprID])
 
-		for _, taskID := range taskIDs {
-			if isRoot[taskID] {
-				rootTaskID = taskID
-			}
-		}
+	log.Printf("Обновлено выражение %s: статус=%s, результат=%f", exprID, expr.Status, expr.Result)
+	return nil
+}
 
-		userID := tm.userIDs[exprID]
+// SubmitTaskResult обрабатывает результат вычисления. Выражение вычислено, когда известен
+// результат его корня: задачи отброшенных веток условных выражений не выполняются
+func (tm *TaskManager) SubmitTaskResult(result TaskResult) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
 
-		if rootTaskID != "" {
-			finalResult := tm.taskResults[rootTaskID]
-			log.Printf("Используем результат корневой задачи %s: %f", rootTaskID, finalResult)
+	log.Printf("Получен результат задачи %s: %f", result.ID, result.Result)
 
-			expr.Status = "COMPLETED"
-			expr.Result = finalResult
-			tm.expressions[exprID] = expr
+	// Результат задачи отменённого или прерванного выражения подтверждается агенту
+	// и отбрасывается, даже если аренда задачи уже истекла
+	if _, ok := tm.withdrawn[result.ID]; ok {
+		log.Printf("Задача %s отозвана, результат отброшен", result.ID)
+		return nil
+	}
 
-			// Сохраняем в БД
-			dbExpr := models.Expression{
-				ID:        expr.ID,
-				Text:      expr.Original,
-				Status:    expr.Status,
-				Result:    expr.Result,
-				CreatedAt: expr.CreatedAt,
-			}
-			_ = SaveExpressionFunc(&dbExpr, userID)
+	exprID, exists := tm.taskToExpression[result.ID]
+	if !exists {
+		log.Printf("ОШИБКА: Задача %s не найдена в taskToExpression", result.ID)
+		return errors.New("задача не найдена")
+	}
 
-			log.Printf("Выражение %s (%s) вычислено с учетом временных задержек операций. Итоговый результат: %f", exprID, expr.Original, finalResult)
-		} else {
-			lastTaskID := taskIDs[len(taskIDs)-1]
-			finalResult := tm.taskResults[lastTaskID]
-			log.Printf("Корневая задача не найдена, используем последнюю задачу %s: %f", lastTaskID, finalResult)
-
-			expr.Status = "COMPLETED"
-			expr.Result = finalResult
-			tm.expressions[exprID] = expr
-
-			// Сохраняем в БД
-			dbExpr := models.Expression{
-				ID:        expr.ID,
-				Text:      expr.Original,
-				Status:    expr.Status,
-				Result:    expr.Result,
-				CreatedAt: expr.CreatedAt,
-			}
-			_ = SaveExpressionFunc(&dbExpr, userID)
+	// Задача могла быть выдана повторно после истечения аренды: принимается первый результат
+	if _, done := tm.taskResults[result.ID]; done {
+		log.Printf("Результат задачи %s уже получен, повторный результат отброшен", result.ID)
+		return nil
+	}
+	delete(tm.inFlight, result.ID)
+	delete(tm.tasks, result.ID)
 
-			log.Printf("Выражение %s (%s) вычислено с использованием последней задачи. Итоговый результат: %f", exprID, expr.Original, finalResult)
-		}
+	tm.storeResult(result.ID, result.Result, result.Decimal, result.Tensor)
 
-		log.Printf("Обновлено выражение %s: статус=%s, результат=%f", exprID, expr.Status, expr.Result)
+	log.Printf("Задача %s связана с выражением %s", result.ID, exprID)
+
+	taskIDs, ok := tm.expressionTasks[exprID]
+	if !ok {
+		log.Printf("ОШИБКА: Для выражения %s не найдены связанные задачи", exprID)
+		return errors.New("задачи выражения не найдены")
+	}
 
-		// Очищаем данные о выполненных задачах
+	rootTaskID := tm.expressionRoots[exprID]
+	finalResult, done := tm.taskResults[rootTaskID]
+	if !done {
+		completedTasks := 0
 		for _, taskID := range taskIDs {
-			delete(tm.taskResults, taskID)
-			delete(tm.taskToExpression, taskID)
-			delete(tm.dependsOnTask, taskID)
-			delete(tm.tasks, taskID)
+			if _, ok := tm.taskResults[taskID]; ok {
+				completedTasks++
+			}
 		}
-		delete(tm.expressionTasks, exprID)
+		log.Printf("Для выражения %s выполнено %d/%d задач", exprID, completedTasks, len(taskIDs))
+		return nil
+	}
+
+	log.Printf("Используем результат корневой задачи %s: %f", rootTaskID, finalResult)
+	if err := tm.completeExpression(exprID, finalResult, tm.decimalResults[rootTaskID], tm.tensorResult(rootTaskID)); err != nil {
+		return err
+	}
+
+	// Очищаем данные о выполненных задачах
+	for _, taskID := range taskIDs {
+		tm.forgetTask(taskID)
 	}
+	delete(tm.expressionTasks, exprID)
+	delete(tm.expressionRoots, exprID)
 
 	return nil
 }
@@ -427,6 +757,16 @@ func (tm *TaskManager) GetExpression(id string) (types.Expression, bool) {
 	return expr, exists
 }
 
+// OwnedBy сообщает, создано ли выражение id пользователем userID. Проверка идёт под
+// блокировкой TaskManager, поэтому ею пользуются и отмена, и типографская запись выражения
+func (tm *TaskManager) OwnedBy(id string, userID int) bool {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	exprUserID, exists := tm.userIDs[id]
+	return exists && exprUserID == userID
+}
+
 func (tm *TaskManager) GetAllExpressions() []types.Expression {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
@@ -462,10 +802,27 @@ func (tm *TaskManager) ResetState() {
 	tm.expressions = make(map[string]types.Expression)
 	tm.tasks = make(map[string]Task)
 	tm.taskResults = make(map[string]float64)
+	tm.decimalResults = make(map[string]string)
+	tm.tensorResults = make(map[string]calculator.Tensor)
 	tm.taskToExpression = make(map[string]string)
 	tm.expressionTasks = make(map[string][]string)
-	tm.dependsOnTask = make(map[string][]string)
+	tm.expressionRoots = make(map[string]string)
+	tm.conditionals = make(map[string]conditional)
+	tm.conditionGates = make(map[string][]string)
+	tm.conditionWaiters = make(map[string][]string)
+	tm.resultForwards = make(map[string][]string)
+	tm.assemblies = make(map[string]assembly)
+	tm.assemblyWaiters = make(map[string][]string)
 	tm.userIDs = make(map[string]int)
+	tm.ready = nil
+	tm.queued = make(map[string]bool)
+	tm.dependents = make(map[string][]string)
+	tm.expressionSequence = make(map[string]uint64)
+	tm.inFlight = make(map[string]lease)
+	tm.attempts = make(map[string]int)
+	tm.withdrawn = make(map[string]time.Time)
+	tm.nextLeaseExpiry = time.Time{}
+	tm.deadlines = make(map[string]time.Time)
 	tm.calc = calculator.NewCalculator()
 }
 
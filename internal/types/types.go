@@ -1,30 +1,54 @@
 package types
 
+import "gocalc/internal/calculator"
+
 type Task struct {
-	ID            string   `json:"id"`
-	Arg1          float64  `json:"arg1"`
-	Arg2          float64  `json:"arg2"`
-	Operation     string   `json:"operation"`
-	OperationTime int      `json:"operation_time"`
-	Priority      int      `json:"priority"`
-	DependsOn     []string `json:"depends_on,omitempty"`
+	ID            string    `json:"id"`
+	Arg1          float64   `json:"arg1"`
+	Arg2          float64   `json:"arg2"`
+	Args          []float64 `json:"args,omitempty"`
+	Operation     string    `json:"operation"`
+	OperationTime int       `json:"operation_time"`
+	Priority      int       `json:"priority"`
+	DependsOn     []string  `json:"depends_on,omitempty"`
+	Precision     string    `json:"precision,omitempty"`
+	Arg1Decimal   string    `json:"arg1_decimal,omitempty"`
+	Arg2Decimal   string    `json:"arg2_decimal,omitempty"`
+	ArgsDecimal   []string  `json:"args_decimal,omitempty"`
 }
 
 type TaskResult struct {
-	ID     string  `json:"id"`
-	Result float64 `json:"result"`
+	ID      string             `json:"id"`
+	Result  float64            `json:"result"`
+	Decimal string             `json:"result_decimal,omitempty"`
+	Tensor  *calculator.Tensor `json:"result_tensor,omitempty"`
 }
 
 type Expression struct {
-	ID        string  `json:"id"`
-	Original  string  `json:"expression"`
-	Status    string  `json:"status"`
-	Result    float64 `json:"result"`
-	CreatedAt string  `json:"created_at"`
+	ID           string             `json:"id"`
+	Original     string             `json:"expression"`
+	Canonical    string             `json:"canonical,omitempty"` // Каноническая запись выражения
+	Variables    map[string]float64 `json:"variables,omitempty"`
+	Precision    string             `json:"precision,omitempty"`
+	Status       string             `json:"status"`
+	Result       float64            `json:"result"`
+	Unit         string             `json:"unit,omitempty"`          // Единица измерения результата ("km/h"), "" - безразмерный
+	ResultText   string             `json:"result_text,omitempty"`   // Точный результат в режиме decimal или интервал в режиме interval
+	ResultLow    *float64           `json:"result_low,omitempty"`    // Нижняя граница результата в режиме interval
+	ResultHigh   *float64           `json:"result_high,omitempty"`   // Верхняя граница результата в режиме interval
+	ResultTensor *calculator.Tensor `json:"result_tensor,omitempty"` // Результат-вектор или матрица
+	CriticalPath int                `json:"critical_path,omitempty"` // Наибольшее число задач, выполняемых друг за другом
+	Formatted    string             `json:"formatted,omitempty"`     // Результат в записи локали пользователя ("1 234,5")
+	Error        string             `json:"error,omitempty"`         // Причина завершения выражения со статусом ERROR
+	CreatedAt    string             `json:"created_at"`
 }
 
 type CalculateRequest struct {
-	Expression string `json:"expression"`
+	Expression string             `json:"expression"`
+	Variables  map[string]float64 `json:"variables,omitempty"`
+	Precision  string             `json:"precision,omitempty"` // "float" (по умолчанию), "decimal" или "interval"
+	// Вычислять цепочки операторов в порядке записи, не перестраивая их (REBALANCE_CHAINS)
+	PreserveOrder bool `json:"preserve_order,omitempty"`
 }
 
 type ExpressionResponse struct {
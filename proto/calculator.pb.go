@@ -21,22 +21,41 @@ func (x *TaskRequest) ProtoMessage()  {}
 
 // Task представляет задачу для вычисления
 type Task struct {
-	Id            string  `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Arg1          float64 `protobuf:"fixed64,2,opt,name=arg1,proto3" json:"arg1,omitempty"`
-	Arg2          float64 `protobuf:"fixed64,3,opt,name=arg2,proto3" json:"arg2,omitempty"`
-	Operation     string  `protobuf:"bytes,4,opt,name=operation,proto3" json:"operation,omitempty"`
-	OperationTime int32   `protobuf:"varint,5,opt,name=operation_time,json=operationTime,proto3" json:"operation_time,omitempty"`
-	Priority      int32   `protobuf:"varint,6,opt,name=priority,proto3" json:"priority,omitempty"`
+	Id            string    `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Arg1          float64   `protobuf:"fixed64,2,opt,name=arg1,proto3" json:"arg1,omitempty"`
+	Arg2          float64   `protobuf:"fixed64,3,opt,name=arg2,proto3" json:"arg2,omitempty"`
+	Operation     string    `protobuf:"bytes,4,opt,name=operation,proto3" json:"operation,omitempty"`
+	OperationTime int32     `protobuf:"varint,5,opt,name=operation_time,json=operationTime,proto3" json:"operation_time,omitempty"`
+	Priority      int32     `protobuf:"varint,6,opt,name=priority,proto3" json:"priority,omitempty"`
+	Args          []float64 `protobuf:"fixed64,7,rep,packed,name=args,proto3" json:"args,omitempty"`
+	Precision     string    `protobuf:"bytes,8,opt,name=precision,proto3" json:"precision,omitempty"`
+	Arg1Decimal   string    `protobuf:"bytes,9,opt,name=arg1_decimal,json=arg1Decimal,proto3" json:"arg1_decimal,omitempty"`
+	Arg2Decimal   string    `protobuf:"bytes,10,opt,name=arg2_decimal,json=arg2Decimal,proto3" json:"arg2_decimal,omitempty"`
+	ArgsDecimal   []string  `protobuf:"bytes,11,rep,name=args_decimal,json=argsDecimal,proto3" json:"args_decimal,omitempty"`
+	Arg1Tensor    *Tensor   `protobuf:"bytes,12,opt,name=arg1_tensor,json=arg1Tensor,proto3" json:"arg1_tensor,omitempty"`
+	Arg2Tensor    *Tensor   `protobuf:"bytes,13,opt,name=arg2_tensor,json=arg2Tensor,proto3" json:"arg2_tensor,omitempty"`
 }
 
 func (x *Task) Reset()         {}
 func (x *Task) String() string { return "" }
 func (x *Task) ProtoMessage()  {}
 
+// Tensor представляет вектор или матрицу
+type Tensor struct {
+	Shape  []int32   `protobuf:"varint,1,rep,packed,name=shape,proto3" json:"shape,omitempty"`
+	Values []float64 `protobuf:"fixed64,2,rep,packed,name=values,proto3" json:"values,omitempty"`
+}
+
+func (x *Tensor) Reset()         {}
+func (x *Tensor) String() string { return "" }
+func (x *Tensor) ProtoMessage()  {}
+
 // TaskResult представляет результат выполнения задачи
 type TaskResult struct {
-	Id     string  `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Result float64 `protobuf:"fixed64,2,opt,name=result,proto3" json:"result,omitempty"`
+	Id            string  `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Result        float64 `protobuf:"fixed64,2,opt,name=result,proto3" json:"result,omitempty"`
+	ResultDecimal string  `protobuf:"bytes,3,opt,name=result_decimal,json=resultDecimal,proto3" json:"result_decimal,omitempty"`
+	ResultTensor  *Tensor `protobuf:"bytes,4,opt,name=result_tensor,json=resultTensor,proto3" json:"result_tensor,omitempty"`
 }
 
 func (x *TaskResult) Reset()         {}
@@ -53,4 +72,22 @@ func (x *TaskResultResponse) Reset()         {}
 func (x *TaskResultResponse) String() string { return "" }
 func (x *TaskResultResponse) ProtoMessage()  {}
 
+// TaskStatusRequest представляет запрос состояния выданной задачи
+type TaskStatusRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *TaskStatusRequest) Reset()         {}
+func (x *TaskStatusRequest) String() string { return "" }
+func (x *TaskStatusRequest) ProtoMessage()  {}
+
+// TaskStatus представляет состояние выданной задачи
+type TaskStatus struct {
+	Cancelled bool `protobuf:"varint,1,opt,name=cancelled,proto3" json:"cancelled,omitempty"`
+}
+
+func (x *TaskStatus) Reset()         {}
+func (x *TaskStatus) String() string { return "" }
+func (x *TaskStatus) ProtoMessage()  {}
+
 var File_proto_calculator_proto protoreflect.FileDescriptor
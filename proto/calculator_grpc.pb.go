@@ -25,6 +25,8 @@ type CalculatorClient interface {
 	GetTask(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*Task, error)
 	// SubmitTaskResult отправляет результат выполнения задачи
 	SubmitTaskResult(ctx context.Context, in *TaskResult, opts ...grpc.CallOption) (*TaskResultResponse, error)
+	// GetTaskStatus запрашивает состояние выданной задачи
+	GetTaskStatus(ctx context.Context, in *TaskStatusRequest, opts ...grpc.CallOption) (*TaskStatus, error)
 }
 
 type calculatorClient struct {
@@ -53,6 +55,15 @@ func (c *calculatorClient) SubmitTaskResult(ctx context.Context, in *TaskResult,
 	return out, nil
 }
 
+func (c *calculatorClient) GetTaskStatus(ctx context.Context, in *TaskStatusRequest, opts ...grpc.CallOption) (*TaskStatus, error) {
+	out := new(TaskStatus)
+	err := c.cc.Invoke(ctx, "/calculator.Calculator/GetTaskStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // CalculatorServer is the server API for Calculator service.
 // All implementations must embed UnimplementedCalculatorServer
 // for forward compatibility
@@ -61,6 +72,8 @@ type CalculatorServer interface {
 	GetTask(context.Context, *TaskRequest) (*Task, error)
 	// SubmitTaskResult принимает результат выполнения задачи
 	SubmitTaskResult(context.Context, *TaskResult) (*TaskResultResponse, error)
+	// GetTaskStatus сообщает, нужен ли ещё результат выданной задачи
+	GetTaskStatus(context.Context, *TaskStatusRequest) (*TaskStatus, error)
 	mustEmbedUnimplementedCalculatorServer()
 }
 
@@ -74,6 +87,9 @@ func (UnimplementedCalculatorServer) GetTask(context.Context, *TaskRequest) (*Ta
 func (UnimplementedCalculatorServer) SubmitTaskResult(context.Context, *TaskResult) (*TaskResultResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SubmitTaskResult not implemented")
 }
+func (UnimplementedCalculatorServer) GetTaskStatus(context.Context, *TaskStatusRequest) (*TaskStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTaskStatus not implemented")
+}
 func (UnimplementedCalculatorServer) mustEmbedUnimplementedCalculatorServer() {}
 
 // UnsafeCalculatorServer may be embedded to opt out of forward compatibility for this service.
@@ -123,6 +139,24 @@ func _Calculator_SubmitTaskResult_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Calculator_GetTaskStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalculatorServer).GetTaskStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/calculator.Calculator/GetTaskStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalculatorServer).GetTaskStatus(ctx, req.(*TaskStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Calculator_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "calculator.Calculator",
 	HandlerType: (*CalculatorServer)(nil),
@@ -135,6 +169,10 @@ var _Calculator_serviceDesc = grpc.ServiceDesc{
 			MethodName: "SubmitTaskResult",
 			Handler:    _Calculator_SubmitTaskResult_Handler,
 		},
+		{
+			MethodName: "GetTaskStatus",
+			Handler:    _Calculator_GetTaskStatus_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/calculator.proto",
@@ -5,12 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"gocalc/internal/calculator"
+	"gocalc/internal/models"
 	"gocalc/internal/orchestrator"
 	"gocalc/internal/types"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -44,6 +46,12 @@ func prepareRouter() *mux.Router {
 	apiRouter.HandleFunc("/calculate", orchestrator.HandleCalculate).Methods("POST")
 	apiRouter.HandleFunc("/expressions", orchestrator.HandleGetExpressions).Methods("GET")
 	apiRouter.HandleFunc("/expressions/{id}", orchestrator.HandleGetExpression).Methods("GET")
+	apiRouter.HandleFunc("/expressions/{id}", orchestrator.HandleCancelExpression).Methods("DELETE")
+	apiRouter.HandleFunc("/expressions/{id}/cancel", orchestrator.HandleCancelExpression).Methods("POST")
+	apiRouter.HandleFunc("/expressions/{id}/render", orchestrator.HandleRenderExpression).Methods("GET")
+	apiRouter.HandleFunc("/differentiate", orchestrator.HandleDifferentiate).Methods("POST")
+	apiRouter.HandleFunc("/settings", orchestrator.HandleGetSettings).Methods("GET")
+	apiRouter.HandleFunc("/settings", orchestrator.HandleUpdateSettings).Methods("PUT")
 
 	// Маршруты, не требующие авторизации
 	router.HandleFunc("/internal/task", orchestrator.HandleGetTask).Methods("GET")
@@ -81,6 +89,17 @@ func TestHandleGetExpressions(t *testing.T) {
 	if response.Expressions == nil {
 		t.Errorf("HandleGetExpressions() должен вернуть список выражений, даже если он пустой")
 	}
+
+	// В ответе есть и исходная, и каноническая запись выражения
+	if len(response.Expressions) == 0 {
+		t.Fatalf("HandleGetExpressions() не вернул созданное выражение")
+	}
+	for _, expr := range response.Expressions {
+		if expr.Original != "2+2*2" || expr.Canonical != "2 + 2 * 2" {
+			t.Errorf("Выражение: исходное %q, каноническое %q, ожидалось %q и %q",
+				expr.Original, expr.Canonical, "2+2*2", "2 + 2 * 2")
+		}
+	}
 }
 
 func TestHandleGetTask(t *testing.T) {
@@ -218,6 +237,424 @@ func TestHandleSubmitTaskResult(t *testing.T) {
 	}
 }
 
+func TestHandleCancelExpression(t *testing.T) {
+	setupTest()
+
+	router := prepareRouter()
+	send := func(method, target string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer test-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	calcW := send(http.MethodPost, "/api/v1/calculate", []byte(`{"expression": "(1+2)*(3+4)"}`))
+	var calcResponse map[string]string
+	if err := json.Unmarshal(calcW.Body.Bytes(), &calcResponse); err != nil {
+		t.Fatalf("Невозможно распарсить ответ: %v", err)
+	}
+	exprID := calcResponse["id"]
+
+	// Обе независимые задачи выданы агентам
+	var task, slowTask types.Task
+	if err := json.Unmarshal(send(http.MethodGet, "/internal/task", nil).Body.Bytes(), &task); err != nil || task.ID == "" {
+		t.Fatalf("Задача не выдана: %v", err)
+	}
+	if err := json.Unmarshal(send(http.MethodGet, "/internal/task", nil).Body.Bytes(), &slowTask); err != nil || slowTask.ID == "" {
+		t.Fatalf("Вторая задача не выдана: %v", err)
+	}
+
+	w := send(http.MethodDelete, "/api/v1/expressions/"+exprID, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("HandleCancelExpression() код статуса = %v, ожидается %v", w.Code, http.StatusOK)
+	}
+	var expr types.Expression
+	if err := json.Unmarshal(w.Body.Bytes(), &expr); err != nil {
+		t.Fatalf("Невозможно распарсить ответ: %v", err)
+	}
+	if expr.Status != "CANCELLED" {
+		t.Errorf("Статус отменённого выражения %s, ожидается CANCELLED", expr.Status)
+	}
+
+	if w := send(http.MethodGet, "/internal/task", nil); w.Code != http.StatusNoContent {
+		t.Errorf("После отмены выдана задача: код статуса = %v, ожидается %v", w.Code, http.StatusNoContent)
+	}
+	if !orchestrator.GetTaskManager().TaskCancelled(task.ID) {
+		t.Errorf("Агенту не сообщается об отмене выполняемой задачи")
+	}
+
+	// Опоздавший результат выданной задачи принимается и отбрасывается
+	resultBody, _ := json.Marshal(types.TaskResult{ID: task.ID, Result: 3})
+	if w := send(http.MethodPost, "/internal/task", resultBody); w.Code != http.StatusOK {
+		t.Errorf("Результат задачи отменённого выражения: код статуса = %v, ожидается %v", w.Code, http.StatusOK)
+	}
+	if expr, _ := orchestrator.GetTaskManager().GetExpression(exprID); expr.Status != "CANCELLED" {
+		t.Errorf("После опоздавшего результата статус %s, ожидается CANCELLED", expr.Status)
+	}
+
+	// Результат, пришедший после истечения аренды, тоже подтверждается агенту
+	orchestrator.GetTaskManager().ReapExpired(time.Now().Add(time.Minute))
+	if !orchestrator.GetTaskManager().TaskCancelled(slowTask.ID) {
+		t.Errorf("После истечения аренды агенту не сообщается об отмене задачи")
+	}
+	resultBody, _ = json.Marshal(types.TaskResult{ID: slowTask.ID, Result: 7})
+	if w := send(http.MethodPost, "/internal/task", resultBody); w.Code != http.StatusOK {
+		t.Errorf("Результат после истечения аренды: код статуса = %v, ожидается %v", w.Code, http.StatusOK)
+	}
+
+	if w := send(http.MethodPost, "/api/v1/expressions/"+exprID+"/cancel", nil); w.Code != http.StatusConflict {
+		t.Errorf("Повторная отмена: код статуса = %v, ожидается %v", w.Code, http.StatusConflict)
+	}
+	if w := send(http.MethodDelete, "/api/v1/expressions/unknown", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Отмена неизвестного выражения: код статуса = %v, ожидается %v", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleCalculateTimeout(t *testing.T) {
+	setupTest()
+
+	router := prepareRouter()
+	calculate := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer test-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := calculate(`{"expression": "2*3", "timeout_ms": -1}`); w.Code != http.StatusBadRequest {
+		t.Errorf("HandleCalculate() с отрицательным timeout_ms: код статуса = %v, ожидается %v", w.Code, http.StatusBadRequest)
+	}
+
+	w := calculate(`{"expression": "2*3", "timeout_ms": 100}`)
+	var calcResponse map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &calcResponse); err != nil {
+		t.Fatalf("Невозможно распарсить ответ: %v", err)
+	}
+	exprID := calcResponse["id"]
+
+	orchestrator.GetTaskManager().ReapExpired(time.Now().Add(time.Second))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+exprID, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	exprW := httptest.NewRecorder()
+	router.ServeHTTP(exprW, req)
+
+	var expr types.Expression
+	if err := json.Unmarshal(exprW.Body.Bytes(), &expr); err != nil {
+		t.Fatalf("Невозможно распарсить ответ: %v", err)
+	}
+	if expr.Status != "TIMEOUT" || expr.Error == "" {
+		t.Errorf("Статус выражения %s, ошибка %q, ожидается TIMEOUT", expr.Status, expr.Error)
+	}
+}
+
+func TestUserLocale(t *testing.T) {
+	setupTest()
+	defer delete(userLocales, 1)
+
+	router := prepareRouter()
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer test-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve(http.MethodPut, "/api/v1/settings", `{"locale": "xx"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Неизвестная локаль: код статуса = %v, ожидается %v", w.Code, http.StatusBadRequest)
+	}
+	if w := serve(http.MethodPut, "/api/v1/settings", `{"locale": "RU"}`); w.Code != http.StatusOK {
+		t.Fatalf("Сохранение локали: код статуса = %v, ожидается %v", w.Code, http.StatusOK)
+	}
+	var settings map[string]string
+	if err := json.Unmarshal(serve(http.MethodGet, "/api/v1/settings", "").Body.Bytes(), &settings); err != nil {
+		t.Fatalf("Невозможно распарсить ответ: %v", err)
+	}
+	if settings["locale"] != "ru" {
+		t.Errorf("Локаль пользователя = %q, ожидается %q", settings["locale"], "ru")
+	}
+
+	// Число записано с десятичной запятой и пробелом между разрядами
+	calcW := serve(http.MethodPost, "/api/v1/calculate", `{"expression": "1 234,5 * 2"}`)
+	if calcW.Code != http.StatusAccepted {
+		t.Fatalf("HandleCalculate() код статуса = %v, ожидается %v: %s", calcW.Code, http.StatusAccepted, calcW.Body.String())
+	}
+	var calcResponse map[string]string
+	if err := json.Unmarshal(calcW.Body.Bytes(), &calcResponse); err != nil {
+		t.Fatalf("Невозможно распарсить ответ: %v", err)
+	}
+
+	var task types.Task
+	if err := json.Unmarshal(serve(http.MethodGet, "/internal/task", "").Body.Bytes(), &task); err != nil {
+		t.Fatalf("Невозможно получить задачу: %v", err)
+	}
+	if task.Arg1 != 1234.5 || task.Arg2 != 2 {
+		t.Errorf("Аргументы задачи = %v и %v, ожидаются 1234.5 и 2", task.Arg1, task.Arg2)
+	}
+	resultBody, _ := json.Marshal(types.TaskResult{ID: task.ID, Result: 2469})
+	serve(http.MethodPost, "/internal/task", string(resultBody))
+
+	var expr types.Expression
+	if err := json.Unmarshal(serve(http.MethodGet, "/api/v1/expressions/"+calcResponse["id"], "").Body.Bytes(), &expr); err != nil {
+		t.Fatalf("Невозможно распарсить ответ: %v", err)
+	}
+	if expr.Result != 2469 || expr.Formatted != "2 469" {
+		t.Errorf("Результат = %v (%q), ожидается 2469 (%q)", expr.Result, expr.Formatted, "2 469")
+	}
+}
+
+func TestHandleRenderExpression(t *testing.T) {
+	setupTest()
+
+	router := prepareRouter()
+
+	calcReq := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", strings.NewReader(`{"expression": "((1+2)/3)*4"}`))
+	calcReq.Header.Set("Content-Type", "application/json")
+	calcReq.Header.Set("Authorization", "Bearer test-token")
+	calcW := httptest.NewRecorder()
+	router.ServeHTTP(calcW, calcReq)
+
+	var calcResponse map[string]string
+	if err := json.Unmarshal(calcW.Body.Bytes(), &calcResponse); err != nil {
+		t.Fatalf("Невозможно распарсить ответ: %v", err)
+	}
+	exprID := calcResponse["id"]
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		want   string
+	}{
+		{name: "формат по умолчанию", query: "", status: http.StatusOK, want: `\frac{1 + 2}{3} \cdot 4`},
+		{name: "latex", query: "?format=latex", status: http.StatusOK, want: `\frac{1 + 2}{3} \cdot 4`},
+		{name: "mathml", query: "?format=mathml", status: http.StatusOK,
+			want: `<math xmlns="http://www.w3.org/1998/Math/MathML"><mrow><mfrac><mrow><mn>1</mn><mo>+</mo><mn>2</mn></mrow><mn>3</mn></mfrac><mo>&#x22C5;</mo><mn>4</mn></mrow></math>`},
+		{name: "неподдерживаемый формат", query: "?format=svg", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/"+exprID+"/render"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer test-token")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("HandleRenderExpression() код статуса = %v, ожидается %v", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Невозможно распарсить ответ: %v", err)
+			}
+			if response["rendered"] != tt.want {
+				t.Errorf("HandleRenderExpression() = %s, ожидалось %s", response["rendered"], tt.want)
+			}
+		})
+	}
+
+	// Выражения, которых уже нет в памяти оркестратора, берутся из истории в БД
+	storedExpressions[1] = []models.Expression{{ID: "stored", Text: "2*-3", Canonical: "2 * -3"}}
+	storedExpressions[2] = []models.Expression{{ID: "foreign", Text: "1 + 1"}}
+	t.Cleanup(func() { delete(storedExpressions, 1); delete(storedExpressions, 2) })
+
+	t.Run("выражение из истории", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/stored/render", nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("HandleRenderExpression() код статуса = %v, ожидается %v", w.Code, http.StatusOK)
+		}
+		var response map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Невозможно распарсить ответ: %v", err)
+		}
+		if want := `2 \cdot \left(-3\right)`; response["expression"] != "2 * -3" || response["rendered"] != want {
+			t.Errorf("HandleRenderExpression() = %v, ожидалось %s", response, want)
+		}
+	})
+
+	t.Run("выражение другого пользователя", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/foreign/render", nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("HandleRenderExpression() код статуса = %v, ожидается %v", w.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("неизвестное выражение", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/unknown/render", nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("HandleRenderExpression() код статуса = %v, ожидается %v", w.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestHandleDifferentiate(t *testing.T) {
+	setupTest()
+
+	router := prepareRouter()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   string
+	}{
+		{name: "переменная по умолчанию", body: `{"expression": "x^2 * sin(x)"}`, status: http.StatusOK,
+			want: "2 * x * sin(x) + x ^ 2 * cos(x)"},
+		{name: "другая переменная", body: `{"expression": "a*t^2 + b*t", "variable": "t"}`, status: http.StatusOK,
+			want: "a * (2 * t) + b"},
+		{name: "синтаксическая ошибка", body: `{"expression": "x^"}`, status: http.StatusBadRequest},
+		{name: "недифференцируемая функция", body: `{"expression": "max(x, 1)"}`, status: http.StatusUnprocessableEntity},
+		{name: "некорректная переменная", body: `{"expression": "x", "variable": "1"}`, status: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/differentiate", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer test-token")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("HandleDifferentiate() код статуса = %v, ожидается %v", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Невозможно распарсить ответ: %v", err)
+			}
+			if response["derivative"] != tt.want {
+				t.Errorf("HandleDifferentiate() = %s, ожидалось %s", response["derivative"], tt.want)
+			}
+			if response["id"] != "" {
+				t.Errorf("Без точки производная не должна отправляться на вычисление")
+			}
+		})
+	}
+
+	t.Run("вычисление в точке", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/differentiate",
+			strings.NewReader(`{"expression": "k * x^2", "at": 3, "variables": {"k": 5, "x": 100}}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer test-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("HandleDifferentiate() код статуса = %v, ожидается %v", w.Code, http.StatusAccepted)
+		}
+		var response map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Невозможно распарсить ответ: %v", err)
+		}
+		if response["derivative"] != "k * (2 * x)" || response["id"] == "" {
+			t.Fatalf("HandleDifferentiate() = %v", response)
+		}
+
+		// k * (2 * x) при k = 5, x = 3 вычисляется агентами: сначала 2 * 3, затем 5 * 6
+		tm := orchestrator.GetTaskManager()
+		for _, expected := range []struct{ arg1, arg2, result float64 }{{2, 3, 6}, {5, 6, 30}} {
+			task, found := tm.GetNextTask()
+			if !found {
+				t.Fatalf("Задача для производной не создана")
+			}
+			if task.Operation != "*" || task.Arg1 != expected.arg1 || task.Arg2 != expected.arg2 {
+				t.Fatalf("Задача = %+v, ожидалось %v * %v", task, expected.arg1, expected.arg2)
+			}
+			if err := tm.SubmitTaskResult(orchestrator.TaskResult{ID: task.ID, Result: expected.result}); err != nil {
+				t.Fatalf("SubmitTaskResult() error = %v", err)
+			}
+		}
+
+		expr, exists := tm.GetExpression(response["id"])
+		if !exists {
+			t.Fatalf("Выражение производной не найдено")
+		}
+		if expr.Status != "COMPLETED" || expr.Result != 30 {
+			t.Errorf("Выражение = %s %v, ожидалось COMPLETED 30", expr.Status, expr.Result)
+		}
+	})
+}
+
+func TestHandleCalculateWithVariables(t *testing.T) {
+	setupTest()
+
+	router := prepareRouter()
+
+	calcReq := httptest.NewRequest(http.MethodPost, "/api/v1/calculate",
+		strings.NewReader(`{"expression": "rate * principal", "variables": {"rate": 0.05, "principal": 1000}}`))
+	calcReq.Header.Set("Content-Type", "application/json")
+	calcReq.Header.Set("Authorization", "Bearer test-token")
+	calcW := httptest.NewRecorder()
+	router.ServeHTTP(calcW, calcReq)
+
+	if calcW.Code != http.StatusAccepted {
+		t.Fatalf("HandleCalculate() код статуса = %v, ожидается %v", calcW.Code, http.StatusAccepted)
+	}
+
+	var calcResponse map[string]string
+	if err := json.Unmarshal(calcW.Body.Bytes(), &calcResponse); err != nil {
+		t.Fatalf("Невозможно распарсить ответ: %v", err)
+	}
+
+	// Переменные подставлены до разбиения на задачи
+	task, found := orchestrator.GetTaskManager().GetNextTask()
+	if !found {
+		t.Fatalf("Задача для выражения не создана")
+	}
+	if task.Operation != "*" || task.Arg1 != 0.05 || task.Arg2 != 1000 {
+		t.Errorf("Задача = %+v, ожидалось 0.05 * 1000", task)
+	}
+
+	expr, exists := orchestrator.GetTaskManager().GetExpression(calcResponse["id"])
+	if !exists {
+		t.Fatalf("Выражение не найдено")
+	}
+	if expr.Variables["rate"] != 0.05 || expr.Variables["principal"] != 1000 {
+		t.Errorf("Привязки переменных не сохранены в выражении: %v", expr.Variables)
+	}
+
+	// Несвязанная переменная отклоняется
+	badReq := httptest.NewRequest(http.MethodPost, "/api/v1/calculate",
+		strings.NewReader(`{"expression": "rate * principal", "variables": {"rate": 0.05}}`))
+	badReq.Header.Set("Content-Type", "application/json")
+	badReq.Header.Set("Authorization", "Bearer test-token")
+	badW := httptest.NewRecorder()
+	router.ServeHTTP(badW, badReq)
+
+	if badW.Code != http.StatusBadRequest {
+		t.Errorf("HandleCalculate() код статуса = %v, ожидается %v", badW.Code, http.StatusBadRequest)
+	}
+	if !strings.Contains(badW.Body.String(), "undefined variable: principal") {
+		t.Errorf("Ожидалась ошибка о несвязанной переменной, получено: %s", badW.Body.String())
+	}
+}
+
 func TestOrderOfOperations(t *testing.T) {
 	tests := []struct {
 		name     string
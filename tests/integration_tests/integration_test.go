@@ -3,11 +3,16 @@ package integration_tests
 import (
 	"context"
 	"fmt"
+	"gocalc/internal/calculator"
 	"gocalc/internal/grpc"
 	"gocalc/internal/models"
 	"gocalc/internal/orchestrator"
 	pb "gocalc/proto"
+	"math"
+	"math/big"
 	"net"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -19,10 +24,31 @@ import (
 	"google.golang.org/grpc/test/bufconn"
 )
 
+// Локали пользователей вместо таблицы users
+var userLocales = map[int]string{}
+
+// История выражений пользователей вместо таблицы expressions
+var storedExpressions = map[int][]models.Expression{}
+
 var _ = func() bool {
 	orchestrator.SaveExpressionFunc = func(expression *models.Expression, userID int) error {
 		return nil // мок
 	}
+	orchestrator.UserLocaleFunc = func(userID int) (string, error) {
+		return userLocales[userID], nil
+	}
+	orchestrator.SetUserLocaleFunc = func(userID int, locale string) error {
+		userLocales[userID] = locale
+		return nil
+	}
+	orchestrator.GetExpressionFunc = func(id string, userID int) (*models.Expression, error) {
+		for _, expr := range storedExpressions[userID] {
+			if expr.ID == id {
+				return &expr, nil
+			}
+		}
+		return nil, nil
+	}
 	return true
 }()
 
@@ -77,9 +103,23 @@ func runGRPCAgent(t *testing.T, client pb.CalculatorClient, wg *sync.WaitGroup,
 			time.Sleep(50 * time.Millisecond)
 			continue
 		}
+		if task.Precision == calculator.PrecisionDecimal {
+			submitDecimalResult(t, client, task, id)
+			continue
+		}
+		if task.Precision == calculator.PrecisionInterval {
+			submitIntervalResult(t, client, task, id)
+			continue
+		}
+		if task.Arg1Tensor != nil || task.Arg2Tensor != nil {
+			submitTensorResult(t, client, task, id)
+			continue
+		}
 		// Выполняем вычисление
 		var result float64
 		switch task.Operation {
+		case "neg":
+			result = -task.Arg1
 		case "+":
 			result = task.Arg1 + task.Arg2
 		case "-":
@@ -92,6 +132,16 @@ func runGRPCAgent(t *testing.T, client pb.CalculatorClient, wg *sync.WaitGroup,
 			} else {
 				result = task.Arg1 / task.Arg2
 			}
+		case "^":
+			result = math.Pow(task.Arg1, task.Arg2)
+		case "not":
+			result, _ = calculator.ApplyUnaryOperator(task.Operation, task.Arg1)
+		case "%", "//", "&", "|", "xor", "<<", ">>", "<", "<=", ">", ">=", "==", "!=", "&&", "||":
+			result, _ = calculator.ApplyOperator(task.Operation, task.Arg1, task.Arg2)
+		default:
+			if calculator.IsFunction(task.Operation) {
+				result, _ = calculator.ApplyFunction(task.Operation, task.Args)
+			}
 		}
 		// Симулируем время выполнения
 		time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
@@ -106,6 +156,112 @@ func runGRPCAgent(t *testing.T, client pb.CalculatorClient, wg *sync.WaitGroup,
 	}
 }
 
+// submitDecimalResult вычисляет задачу точного режима и отправляет результат
+func submitDecimalResult(t *testing.T, client pb.CalculatorClient, task *pb.Task, id string) {
+	texts := []string{task.Arg1Decimal, task.Arg2Decimal}
+	switch {
+	case calculator.IsFunction(task.Operation):
+		texts = task.ArgsDecimal
+	case task.Operation == "" || task.Operation == calculator.UnaryMinus || task.Operation == calculator.UnaryNot:
+		texts = texts[:1]
+	}
+
+	args := make([]*big.Rat, len(texts))
+	for i, text := range texts {
+		arg, err := calculator.ParseDecimal(text)
+		if err != nil {
+			t.Errorf("Агент %s: неверный точный аргумент %q: %v", id, text, err)
+			return
+		}
+		args[i] = arg
+	}
+
+	result := args[0]
+	if task.Operation != "" {
+		var err error
+		result, err = calculator.ApplyDecimal(task.Operation, args)
+		if err != nil {
+			t.Errorf("Агент %s: ошибка точного вычисления: %v", id, err)
+			return
+		}
+	}
+
+	approx, _ := result.Float64()
+	_, err := client.SubmitTaskResult(context.Background(), &pb.TaskResult{
+		Id:            task.Id,
+		Result:        approx,
+		ResultDecimal: calculator.FormatDecimal(result),
+	})
+	if err != nil {
+		t.Logf("Агент %s: ошибка отправки результата: %v", id, err)
+	}
+}
+
+// submitIntervalResult вычисляет задачу режима interval и отправляет интервал-результат
+func submitIntervalResult(t *testing.T, client pb.CalculatorClient, task *pb.Task, id string) {
+	texts := []string{task.Arg1Decimal, task.Arg2Decimal}
+	switch {
+	case calculator.IsFunction(task.Operation):
+		texts = task.ArgsDecimal
+	case task.Operation == "" || task.Operation == calculator.UnaryMinus || task.Operation == calculator.UnaryNot:
+		texts = texts[:1]
+	}
+
+	args := make([]calculator.Interval, len(texts))
+	for i, text := range texts {
+		arg, err := calculator.ParseInterval(text)
+		if err != nil {
+			t.Errorf("Агент %s: неверный интервальный аргумент %q: %v", id, text, err)
+			return
+		}
+		args[i] = arg
+	}
+
+	result := args[0]
+	if task.Operation != "" {
+		var err error
+		result, err = calculator.ApplyInterval(task.Operation, args)
+		if err != nil {
+			t.Errorf("Агент %s: ошибка интервального вычисления: %v", id, err)
+			return
+		}
+	}
+
+	_, err := client.SubmitTaskResult(context.Background(), &pb.TaskResult{
+		Id:            task.Id,
+		Result:        result.Mid(),
+		ResultDecimal: calculator.FormatInterval(result),
+	})
+	if err != nil {
+		t.Logf("Агент %s: ошибка отправки результата: %v", id, err)
+	}
+}
+
+// submitTensorResult вычисляет задачу над векторами и матрицами и отправляет результат
+func submitTensorResult(t *testing.T, client pb.CalculatorClient, task *pb.Task, id string) {
+	var args []calculator.Tensor
+	for _, arg := range []*pb.Tensor{task.Arg1Tensor, task.Arg2Tensor} {
+		if arg != nil {
+			args = append(args, *grpc.TensorFromProto(arg))
+		}
+	}
+
+	result, err := calculator.ApplyTensor(task.Operation, args)
+	if err != nil {
+		t.Errorf("Агент %s: ошибка вычисления %s: %v", id, task.Operation, err)
+		return
+	}
+
+	_, err = client.SubmitTaskResult(context.Background(), &pb.TaskResult{
+		Id:           task.Id,
+		Result:       result.Value(),
+		ResultTensor: grpc.TensorToProto(&result),
+	})
+	if err != nil {
+		t.Logf("Агент %s: ошибка отправки результата: %v", id, err)
+	}
+}
+
 // TestFullExpressionCalculation проверяет полный цикл вычисления выражения
 func TestFullExpressionCalculation(t *testing.T) {
 	tests := []struct {
@@ -133,6 +289,76 @@ func TestFullExpressionCalculation(t *testing.T) {
 			expression: "1+2*3-4/2",
 			expected:   5.0,
 		},
+		{
+			name:       "unary minus literal",
+			expression: "-5+3",
+			expected:   -2.0,
+		},
+		{
+			name:       "unary minus of subexpression",
+			expression: "10+-(2*3)",
+			expected:   4.0,
+		},
+		{
+			name:       "right associative power",
+			expression: "2^3^2-(1+1)**2",
+			expected:   508.0,
+		},
+		{
+			name:       "function calls",
+			expression: "sqrt(16) + max(2, 3, 7)",
+			expected:   11.0,
+		},
+		{
+			name:       "function with dependent arguments",
+			expression: "max(0, 2*3, -(1+1)) - min(1+1, 5)",
+			expected:   4.0,
+		},
+		{
+			name:       "modulo and integer division",
+			expression: "17 % 5 + 7 // 2",
+			expected:   5.0,
+		},
+		{
+			name:       "bitwise operators",
+			expression: "(0b1100 & 0b1010) | 1 << 4",
+			expected:   24.0,
+		},
+		{
+			name:       "xor with floored modulo",
+			expression: "(5 xor 3) * -7 % 4",
+			expected:   2.0,
+		},
+		{
+			name:       "comparisons and logic",
+			expression: "(1+1 < 3) && !(2*2 == 5) || 0",
+			expected:   1.0,
+		},
+		{
+			name:       "conditional skips failing branch",
+			expression: "2*3 > 5 ? 10+1 : 1/0",
+			expected:   11.0,
+		},
+		{
+			name:       "nested conditional",
+			expression: "1+1 == 3 ? 100 : 2*2 >= 4 ? 7*2 : -(1+1)",
+			expected:   14.0,
+		},
+		{
+			name:       "pricing threshold",
+			expression: "(3*40 >= 100 ? 0.9 : 1) * (3*40)",
+			expected:   108.0,
+		},
+		{
+			name:       "conditional as condition",
+			expression: "(2+2 > 3 ? 0 : 1) ? 5*5 : 6*6",
+			expected:   36.0,
+		},
+		{
+			name:       "literal condition",
+			expression: "1 > 2 ? 3*4 : 5",
+			expected:   5.0,
+		},
 	}
 
 	for _, tt := range tests {
@@ -220,6 +446,685 @@ func TestFullExpressionCalculation(t *testing.T) {
 	})
 }
 
+// TestDecimalExpressionCalculation проверяет вычисление в точном режиме через агентов
+func TestDecimalExpressionCalculation(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "decimal addition", expression: "0.1+0.2", expected: "0.3"},
+		{name: "repeating fraction", expression: "1/3+1/3", expected: "2/3"},
+		{name: "negated subexpression", expression: "-(0.1*3)", expected: "-0.3"},
+		{name: "negative exponent", expression: "2^-3+0.1", expected: "0.225"},
+		{name: "function arguments", expression: "max(0.1+0.2, 0.25)", expected: "0.3"},
+		{name: "single number", expression: "0.7", expected: "0.7"},
+		{name: "exact comparison", expression: "0.1+0.2 == 0.3 ? 1/3 : 2*2", expected: "1/3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskManager, client, cleanup := setupIntegrationTest(t)
+			defer cleanup()
+
+			exprID, err := taskManager.CreateExpressionWithOptions(tt.expression, orchestrator.ExpressionOptions{
+				Precision: calculator.PrecisionDecimal,
+			}, 1)
+			if err != nil {
+				t.Fatalf("Ошибка создания выражения: %v", err)
+			}
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go runGRPCAgent(t, client, &wg, "decimal-agent")
+
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("Таймаут ожидания результата")
+			}
+
+			expr, exists := taskManager.GetExpression(exprID)
+			if !exists {
+				t.Fatalf("Выражение не найдено после обработки")
+			}
+			if expr.Status != "COMPLETED" {
+				t.Errorf("Неверный статус выражения: %s", expr.Status)
+			}
+			if expr.ResultText != tt.expected {
+				t.Errorf("Неверный точный результат: ожидалось %s, получено %s", tt.expected, expr.ResultText)
+			}
+		})
+	}
+
+	t.Run("unsupported function", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		_, err := taskManager.CreateExpressionWithOptions("sin(1)", orchestrator.ExpressionOptions{
+			Precision: calculator.PrecisionDecimal,
+		}, 1)
+		if err == nil || err.Error() != "function sin is not supported in decimal mode" {
+			t.Errorf("Ожидалась ошибка неподдерживаемой функции, получено %v", err)
+		}
+	})
+
+	t.Run("unsupported precision", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		_, err := taskManager.CreateExpressionWithOptions("1+1", orchestrator.ExpressionOptions{
+			Precision: "quad",
+		}, 1)
+		if err == nil || err.Error() != "unsupported precision" {
+			t.Errorf("Ожидалась ошибка режима точности, получено %v", err)
+		}
+	})
+}
+
+// TestIntervalExpressionCalculation проверяет вычисление чисел с погрешностью через агентов
+func TestIntervalExpressionCalculation(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+		low, high  float64
+	}{
+		{name: "speed with uncertainty", expression: "(100±1) / (20±0.5)", expected: "[4.829268292682927, 5.17948717948718]", low: 4.829268292682927, high: 5.17948717948718},
+		{name: "interval literal", expression: "[1, 2] * [3, 4] - 1", expected: "[2, 7]", low: 2, high: 7},
+		{name: "computed bounds", expression: "[1 + 1, 2 * 3] + 0±1", expected: "[1, 7]", low: 1, high: 7},
+		{name: "function of interval", expression: "max(5±0.2, 4) + sqrt([4, 9])", expected: "[6.8, 8.2]", low: 6.8, high: 8.2},
+		{name: "certain condition", expression: "2±0.5 > 1 ? -(3±1) : 0", expected: "[-4, -2]", low: -4, high: -2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskManager, client, cleanup := setupIntegrationTest(t)
+			defer cleanup()
+
+			exprID, err := taskManager.CreateExpressionWithOptions(tt.expression, orchestrator.ExpressionOptions{
+				Precision: calculator.PrecisionInterval,
+			}, 1)
+			if err != nil {
+				t.Fatalf("Ошибка создания выражения: %v", err)
+			}
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go runGRPCAgent(t, client, &wg, "interval-agent")
+
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("Таймаут ожидания результата")
+			}
+
+			expr, exists := taskManager.GetExpression(exprID)
+			if !exists {
+				t.Fatalf("Выражение не найдено после обработки")
+			}
+			if expr.Status != "COMPLETED" {
+				t.Errorf("Неверный статус выражения: %s", expr.Status)
+			}
+			if expr.ResultText != tt.expected {
+				t.Errorf("Неверный интервал: ожидалось %s, получено %s", tt.expected, expr.ResultText)
+			}
+			if expr.ResultLow == nil || expr.ResultHigh == nil || *expr.ResultLow != tt.low || *expr.ResultHigh != tt.high {
+				t.Errorf("Неверные границы результата: %v, %v", expr.ResultLow, expr.ResultHigh)
+			}
+			if expr.Result != (tt.low+tt.high)/2 {
+				t.Errorf("Результат должен быть серединой интервала, получено %v", expr.Result)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		name       string
+		expression string
+		precision  string
+		errMsg     string
+	}{
+		{name: "uncertain condition", expression: "[0, 2] > 1 ? 1 : 2", precision: calculator.PrecisionInterval, errMsg: "invalid condition: condition is uncertain over [0, 1]"},
+		{name: "division by interval with zero", expression: "1 / (0±1)", precision: calculator.PrecisionInterval, errMsg: "division by zero"},
+		{name: "uncertainty in float mode", expression: "5±0.2", precision: calculator.PrecisionFloat, errMsg: `numbers with uncertainty require precision "interval"`},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskManager := orchestrator.NewTaskManager()
+			_, err := taskManager.CreateExpressionWithOptions(tt.expression, orchestrator.ExpressionOptions{
+				Precision: tt.precision,
+			}, 1)
+			if err == nil || err.Error() != tt.errMsg {
+				t.Errorf("Ожидалась ошибка %q, получено %v", tt.errMsg, err)
+			}
+		})
+	}
+
+	// Литералы "5±0.2" и "[4.8, 5.2]" собираются при разборе и без свёртки констант:
+	// обе записи одного интервала стоят одинаково
+	literalTests := []struct {
+		expression string
+		operations []string
+		expected   string
+	}{
+		{expression: "(5±0.2) * 2", operations: []string{"*"}, expected: "[9.6, 10.4]"},
+		{expression: "[4.8, 5.2] * 2", operations: []string{"*"}, expected: "[9.6, 10.4]"},
+		{expression: "-(5±0.2)", expected: "[-5.2, -4.8]"},
+	}
+	for _, tt := range literalTests {
+		t.Run("literal "+tt.expression, func(t *testing.T) {
+			t.Setenv("CONSTANT_FOLDING", "false")
+			taskManager := orchestrator.NewTaskManager()
+			exprID, err := taskManager.CreateExpressionWithOptions(tt.expression, orchestrator.ExpressionOptions{
+				Precision: calculator.PrecisionInterval,
+			}, 1)
+			if err != nil {
+				t.Fatalf("Ошибка создания выражения: %v", err)
+			}
+
+			var operations []string
+			for {
+				task, ok := taskManager.GetNextTask()
+				if !ok {
+					break
+				}
+				operations = append(operations, task.Operation)
+				left, _ := calculator.ParseInterval(task.Arg1Decimal)
+				right, _ := calculator.ParseInterval(task.Arg2Decimal)
+				value, err := calculator.ApplyInterval(task.Operation, []calculator.Interval{left, right})
+				if err != nil {
+					t.Fatalf("Ошибка вычисления задачи %s: %v", task.Operation, err)
+				}
+				if err := taskManager.SubmitTaskResult(orchestrator.TaskResult{ID: task.ID, Result: value.Mid(), Decimal: calculator.FormatInterval(value)}); err != nil {
+					t.Fatalf("Ошибка отправки результата: %v", err)
+				}
+			}
+			if !slices.Equal(operations, tt.operations) {
+				t.Errorf("Выданы задачи %v, ожидается %v", operations, tt.operations)
+			}
+			if expr, _ := taskManager.GetExpression(exprID); expr.Status != "COMPLETED" || expr.ResultText != tt.expected {
+				t.Errorf("Выражение: статус %s, результат %s, ожидается COMPLETED, %s", expr.Status, expr.ResultText, tt.expected)
+			}
+		})
+	}
+}
+
+// TestUnitExpressionCalculation проверяет вычисление величин с единицами измерения через агентов
+func TestUnitExpressionCalculation(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   float64
+		unit       string
+	}{
+		{name: "speed in SI", expression: "5 km / 2 h", expected: 5000.0 / 7200, unit: "m/s"},
+		{name: "speed conversion", expression: "5 km / 2 h to km/h", expected: 2.5, unit: "km/h"},
+		{name: "area", expression: "3 m * 4 m + 2 m^2", expected: 14, unit: "m^2"},
+		{name: "energy", expression: "2 kW * 30 min to kWh", expected: 1, unit: "kWh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskManager, client, cleanup := setupIntegrationTest(t)
+			defer cleanup()
+
+			exprID, err := taskManager.CreateExpression(tt.expression, 1)
+			if err != nil {
+				t.Fatalf("Ошибка создания выражения: %v", err)
+			}
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go runGRPCAgent(t, client, &wg, "unit-agent")
+
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("Таймаут ожидания результата")
+			}
+
+			expr, exists := taskManager.GetExpression(exprID)
+			if !exists {
+				t.Fatalf("Выражение не найдено после обработки")
+			}
+			if expr.Status != "COMPLETED" {
+				t.Errorf("Неверный статус выражения: %s", expr.Status)
+			}
+			if math.Abs(expr.Result-tt.expected) > 1e-9 {
+				t.Errorf("Неверный результат: ожидалось %v, получено %v", tt.expected, expr.Result)
+			}
+			if expr.Unit != tt.unit {
+				t.Errorf("Неверная единица результата: ожидалось %q, получено %q", tt.unit, expr.Unit)
+			}
+		})
+	}
+
+	t.Run("incompatible units", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		_, err := taskManager.CreateExpression("1 m + 1 s", 1)
+		synErr, ok := calculator.AsSyntaxError(err)
+		if !ok || synErr.Code != calculator.ErrCodeIncompatibleUnits {
+			t.Errorf("Ожидалась ошибка несовместимых единиц, получено %v", err)
+		}
+	})
+}
+
+// TestMatrixExpressionCalculation проверяет распределённое вычисление выражений с векторами и матрицами
+func TestMatrixExpressionCalculation(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "matrix product", expression: "[[1, 2], [3, 4]] @ [[5, 6], [7, 8]]", expected: "[[19, 22], [43, 50]]"},
+		{name: "computed operands", expression: "([[1, 2], [3, 4]] * 2) @ transpose([[1, 0], [0, 1]] + 1)", expected: "[[8, 10], [20, 22]]"},
+		{name: "vector elements", expression: "[1 + 1, 2 * 3] - [1, 1]", expected: "[1, 5]"},
+		{name: "scalar result", expression: "det([[1, 2], [3, 4]] @ [[2, 0], [0, 2]]) + 1", expected: "-7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskManager, client, cleanup := setupIntegrationTest(t)
+			defer cleanup()
+
+			exprID, err := taskManager.CreateExpression(tt.expression, 1)
+			if err != nil {
+				t.Fatalf("Ошибка создания выражения: %v", err)
+			}
+
+			var wg sync.WaitGroup
+			for i := 1; i <= 2; i++ {
+				wg.Add(1)
+				go runGRPCAgent(t, client, &wg, fmt.Sprintf("matrix-agent-%d", i))
+			}
+
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(20 * time.Second):
+				t.Fatal("Таймаут ожидания результата")
+			}
+
+			expr, exists := taskManager.GetExpression(exprID)
+			if !exists {
+				t.Fatalf("Выражение не найдено после обработки")
+			}
+			if expr.Status != "COMPLETED" {
+				t.Fatalf("Неверный статус выражения: %s", expr.Status)
+			}
+			got := calculator.Scalar(expr.Result).String()
+			if expr.ResultTensor != nil {
+				got = expr.ResultTensor.String()
+			}
+			if got != tt.expected {
+				t.Errorf("Неверный результат: ожидалось %s, получено %s", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("dot tasks per element", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		if _, err := taskManager.CreateExpression("[[1, 2], [3, 4], [5, 6]] @ [[1, 0], [0, 1]]", 1); err != nil {
+			t.Fatalf("Ошибка создания выражения: %v", err)
+		}
+
+		dots := 0
+		for {
+			task, ok := taskManager.GetNextTask()
+			if !ok {
+				break
+			}
+			if task.Operation != "dot" || task.Arg1Tensor == nil || task.Arg2Tensor == nil {
+				t.Fatalf("Ожидалась задача dot над векторами, получено %+v", task)
+			}
+			dots++
+		}
+		if dots != 6 {
+			t.Errorf("Ожидалось 6 независимых задач dot, получено %d", dots)
+		}
+	})
+
+	t.Run("incompatible shapes", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		_, err := taskManager.CreateExpression("[1, 2] + [1, 2, 3]", 1)
+		if err == nil || err.Error() != "incompatible shapes: vector of 2 and vector of 3" {
+			t.Errorf("Ожидалась ошибка несовместимых размерностей, получено %v", err)
+		}
+	})
+}
+
+// runInRounds выполняет задачи раундами: в каждом раунде агенты берут все готовые задачи.
+// Возвращает число раундов - длину цепочки задач, выполняемых друг за другом
+func runInRounds(t *testing.T, taskManager *orchestrator.TaskManager) int {
+	rounds := 0
+	for {
+		var ready []orchestrator.Task
+		for {
+			task, ok := taskManager.GetNextTask()
+			if !ok {
+				break
+			}
+			ready = append(ready, task)
+		}
+		if len(ready) == 0 {
+			return rounds
+		}
+		rounds++
+
+		for _, task := range ready {
+			var result float64
+			if calculator.IsFunction(task.Operation) {
+				result, _ = calculator.ApplyFunction(task.Operation, task.Args)
+			} else {
+				result, _ = calculator.ApplyOperator(task.Operation, task.Arg1, task.Arg2)
+			}
+			if err := taskManager.SubmitTaskResult(orchestrator.TaskResult{ID: task.ID, Result: result}); err != nil {
+				t.Fatalf("Ошибка отправки результата: %v", err)
+			}
+		}
+	}
+}
+
+// TestParallelReduction проверяет, что sum и avg разбиваются на дерево сложений:
+// за один раунд агенты получают все задачи, готовые к выполнению
+func TestParallelReduction(t *testing.T) {
+	args := func(n int) string {
+		values := make([]string, n)
+		for i := range values {
+			values[i] = fmt.Sprint(i + 1)
+		}
+		return strings.Join(values, ", ")
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		rounds   int
+		expected float64
+	}{
+		{name: "sum of 100", expr: "sum(" + args(100) + ")", rounds: 7, expected: 5050},
+		{name: "avg of 10", expr: "avg(" + args(10) + ")", rounds: 5, expected: 5.5},
+		{name: "computed arguments", expr: "sum(1+1, 2*3, sqrt(16), 4)", rounds: 3, expected: 16},
+		{name: "single argument", expr: "avg(2*3)", rounds: 1, expected: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskManager := orchestrator.NewTaskManager()
+			exprID, err := taskManager.CreateExpression(tt.expr, 1)
+			if err != nil {
+				t.Fatalf("Ошибка создания выражения: %v", err)
+			}
+
+			rounds := runInRounds(t, taskManager)
+			if rounds != tt.rounds {
+				t.Errorf("Неверная глубина вычисления: ожидалось %d раундов, получено %d", tt.rounds, rounds)
+			}
+			expr, _ := taskManager.GetExpression(exprID)
+			if expr.Status != "COMPLETED" || expr.Result != tt.expected {
+				t.Errorf("Выражение: статус=%s, результат=%f, ожидалось COMPLETED и %f", expr.Status, expr.Result, tt.expected)
+			}
+		})
+	}
+
+	t.Run("decimal avg", func(t *testing.T) {
+		taskManager, client, cleanup := setupIntegrationTest(t)
+		defer cleanup()
+
+		exprID, err := taskManager.CreateExpressionWithOptions("avg(0.1, 0.2, 0.3)", orchestrator.ExpressionOptions{
+			Precision: calculator.PrecisionDecimal,
+		}, 1)
+		if err != nil {
+			t.Fatalf("Ошибка создания выражения: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go runGRPCAgent(t, client, &wg, "reduction-agent")
+		wg.Wait()
+
+		expr, _ := taskManager.GetExpression(exprID)
+		if expr.Status != "COMPLETED" || expr.ResultText != "0.2" {
+			t.Errorf("Выражение: статус=%s, результат=%s, ожидалось COMPLETED и 0.2", expr.Status, expr.ResultText)
+		}
+	})
+}
+
+// TestChainRebalancing проверяет перестройку цепочек ассоциативных операторов
+func TestChainRebalancing(t *testing.T) {
+	chain := func(op string, n int) string {
+		values := make([]string, n)
+		for i := range values {
+			values[i] = fmt.Sprint(i + 1)
+		}
+		return strings.Join(values, op)
+	}
+
+	tests := []struct {
+		name          string
+		rebalance     string
+		expr          string
+		preserveOrder bool
+		criticalPath  int
+		expected      float64
+	}{
+		{name: "left-deep chain by default", rebalance: "false", expr: chain("+", 16), criticalPath: 15, expected: 136},
+		{name: "rebalanced sum", rebalance: "true", expr: chain("+", 16), criticalPath: 4, expected: 136},
+		{name: "preserve order", rebalance: "true", expr: chain("+", 16), preserveOrder: true, criticalPath: 15, expected: 136},
+		{name: "rebalanced product", rebalance: "true", expr: chain("*", 10), criticalPath: 4, expected: 3628800},
+		{name: "chain inside chain", rebalance: "true", expr: "1*2*3*4 + 5 + 6 + 7 - 8", criticalPath: 5, expected: 34},
+		{name: "conditional", rebalance: "true", expr: "1+2+3+4 > 5 ? " + chain("+", 8) + " : 0", criticalPath: 6, expected: 36},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REBALANCE_CHAINS", tt.rebalance)
+			taskManager := orchestrator.NewTaskManager()
+			exprID, err := taskManager.CreateExpressionWithOptions(tt.expr, orchestrator.ExpressionOptions{
+				PreserveOrder: tt.preserveOrder,
+			}, 1)
+			if err != nil {
+				t.Fatalf("Ошибка создания выражения: %v", err)
+			}
+
+			expr, _ := taskManager.GetExpression(exprID)
+			if expr.CriticalPath != tt.criticalPath {
+				t.Errorf("Неверная длина критического пути: ожидалось %d, получено %d", tt.criticalPath, expr.CriticalPath)
+			}
+
+			if rounds := runInRounds(t, taskManager); rounds != tt.criticalPath {
+				t.Errorf("Неверное число раундов: ожидалось %d, получено %d", tt.criticalPath, rounds)
+			}
+			expr, _ = taskManager.GetExpression(exprID)
+			if expr.Status != "COMPLETED" || expr.Result != tt.expected {
+				t.Errorf("Выражение: статус=%s, результат=%f, ожидалось COMPLETED и %f", expr.Status, expr.Result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestConditionalLazyDispatch проверяет, что агентам выдаются только задачи выбранной ветки
+func TestConditionalLazyDispatch(t *testing.T) {
+	taskManager := orchestrator.NewTaskManager()
+	exprID, err := taskManager.CreateExpression("2*3 > 5 ? 10+1 : 20-1", 1)
+	if err != nil {
+		t.Fatalf("Ошибка создания выражения: %v", err)
+	}
+
+	// Задачи веток ждут условия, поэтому доступна только одна задача за раз
+	steps := []struct {
+		operation string
+		result    float64
+	}{
+		{operation: "*", result: 6},
+		{operation: ">", result: 1},
+		{operation: "+", result: 11},
+	}
+	for _, step := range steps {
+		task, ok := taskManager.GetNextTask()
+		if !ok {
+			t.Fatalf("Ожидалась задача %s, задач нет", step.operation)
+		}
+		if task.Operation != step.operation {
+			t.Fatalf("Неверная задача: ожидалась %s, получена %s", step.operation, task.Operation)
+		}
+		if next, ok := taskManager.GetNextTask(); ok {
+			t.Fatalf("Задача %s выдана до готовности её зависимостей", next.Operation)
+		}
+		if err := taskManager.SubmitTaskResult(orchestrator.TaskResult{ID: task.ID, Result: step.result}); err != nil {
+			t.Fatalf("Ошибка отправки результата: %v", err)
+		}
+	}
+
+	if task, ok := taskManager.GetNextTask(); ok {
+		t.Errorf("Задача невыбранной ветки выдана агенту: %s", task.Operation)
+	}
+
+	expr, _ := taskManager.GetExpression(exprID)
+	if expr.Status != "COMPLETED" || expr.Result != 11 {
+		t.Errorf("Выражение: статус=%s, результат=%f, ожидалось COMPLETED и 11", expr.Status, expr.Result)
+	}
+
+	t.Run("literal condition", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		exprID, err := taskManager.CreateExpression("1 ? 2 : 3*4", 1)
+		if err != nil {
+			t.Fatalf("Ошибка создания выражения: %v", err)
+		}
+		if task, ok := taskManager.GetNextTask(); ok {
+			t.Errorf("Для выражения без задач выдана задача %s", task.Operation)
+		}
+		expr, _ := taskManager.GetExpression(exprID)
+		if expr.Status != "COMPLETED" || expr.Result != 2 {
+			t.Errorf("Выражение: статус=%s, результат=%f, ожидалось COMPLETED и 2", expr.Status, expr.Result)
+		}
+	})
+}
+
+// TestConstantFolding проверяет локальное вычисление операций над числами
+func TestConstantFolding(t *testing.T) {
+	t.Setenv("CONSTANT_FOLDING", "true")
+
+	tests := []struct {
+		name      string
+		expr      string
+		precision string
+		expected  float64
+		exact     string
+	}{
+		{name: "arithmetic", expr: "2*3 + 4", expected: 10},
+		{name: "functions", expr: "max(1, 2) * sqrt(16)", expected: 8},
+		{name: "conditional", expr: "2 > 1 ? 5 : 1/0", expected: 5},
+		{name: "single number", expr: "-5", expected: -5},
+		{name: "decimal", expr: "0.1 + 0.2", precision: calculator.PrecisionDecimal, expected: 0.3, exact: "0.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskManager := orchestrator.NewTaskManager()
+			exprID, err := taskManager.CreateExpressionWithOptions(tt.expr, orchestrator.ExpressionOptions{
+				Precision: tt.precision,
+			}, 1)
+			if err != nil {
+				t.Fatalf("Ошибка создания выражения: %v", err)
+			}
+			if task, ok := taskManager.GetNextTask(); ok {
+				t.Errorf("Для свёрнутого выражения выдана задача %s", task.Operation)
+			}
+
+			expr, _ := taskManager.GetExpression(exprID)
+			if expr.Status != "COMPLETED" || expr.Result != tt.expected || expr.ResultText != tt.exact {
+				t.Errorf("Выражение: статус=%s, результат=%f (%q), ожидалось COMPLETED и %f (%q)",
+					expr.Status, expr.Result, expr.ResultText, tt.expected, tt.exact)
+			}
+		})
+	}
+}
+
+// TestSharedSubexpressions проверяет, что одинаковые подвыражения вычисляются одной задачей
+func TestSharedSubexpressions(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		steps    []string // Операции задач в порядке выдачи агентам
+		results  []float64
+		expected float64
+	}{
+		{
+			name:     "repeated operand",
+			expr:     "(2+3)*(2+3)",
+			steps:    []string{"+", "*"},
+			results:  []float64{5, 25},
+			expected: 25,
+		},
+		{
+			name:     "repeated function call",
+			expr:     "sqrt(16) + sqrt(16) * 2",
+			steps:    []string{"sqrt", "*", "+"},
+			results:  []float64{4, 8, 12},
+			expected: 12,
+		},
+		{
+			// Ветка использует задачу условия: она не должна ждать сама себя
+			name:     "branch reuses condition operand",
+			expr:     "2+3 > 4 ? (2+3)*2 : 0",
+			steps:    []string{"+", ">", "*"},
+			results:  []float64{5, 1, 10},
+			expected: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskManager := orchestrator.NewTaskManager()
+			exprID, err := taskManager.CreateExpression(tt.expr, 1)
+			if err != nil {
+				t.Fatalf("Ошибка создания выражения: %v", err)
+			}
+
+			for i, operation := range tt.steps {
+				task, ok := taskManager.GetNextTask()
+				if !ok {
+					t.Fatalf("Ожидалась задача %s, задач нет", operation)
+				}
+				if task.Operation != operation {
+					t.Fatalf("Неверная задача: ожидалась %s, получена %s", operation, task.Operation)
+				}
+				if err := taskManager.SubmitTaskResult(orchestrator.TaskResult{ID: task.ID, Result: tt.results[i]}); err != nil {
+					t.Fatalf("Ошибка отправки результата: %v", err)
+				}
+			}
+
+			if task, ok := taskManager.GetNextTask(); ok {
+				t.Errorf("Выдана лишняя задача %s", task.Operation)
+			}
+			expr, _ := taskManager.GetExpression(exprID)
+			if expr.Status != "COMPLETED" || expr.Result != tt.expected {
+				t.Errorf("Выражение: статус=%s, результат=%f, ожидалось COMPLETED и %f", expr.Status, expr.Result, tt.expected)
+			}
+		})
+	}
+}
+
 // TestConcurrentExpressionProcessing проверяет параллельное вычисление нескольких выражений
 func TestConcurrentExpressionProcessing(t *testing.T) {
 	taskManager, client, cleanup := setupIntegrationTest(t)
@@ -0,0 +1,339 @@
+package integration_tests
+
+import (
+	"fmt"
+	"gocalc/internal/calculator"
+	"gocalc/internal/models"
+	"gocalc/internal/orchestrator"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// executeTask вычисляет задачу так же, как агент в режиме float
+func executeTask(task orchestrator.Task) (float64, error) {
+	switch {
+	case task.Operation == calculator.UnaryMinus || task.Operation == calculator.UnaryNot:
+		return calculator.ApplyUnaryOperator(task.Operation, task.Arg1)
+	case calculator.IsFunction(task.Operation):
+		return calculator.ApplyFunction(task.Operation, task.Args)
+	}
+	return calculator.ApplyOperator(task.Operation, task.Arg1, task.Arg2)
+}
+
+// calculateDistributed вычисляет выражение задачами, выдавая их в произвольном порядке готовности
+func calculateDistributed(taskManager *orchestrator.TaskManager, expr string) (float64, error) {
+	exprID, err := taskManager.CreateExpression(expr, 1)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		if result, ok := taskManager.GetExpression(exprID); ok && result.Status == "COMPLETED" {
+			return result.Result, nil
+		}
+		task, ok := taskManager.GetNextTask()
+		if !ok {
+			return 0, fmt.Errorf("выражение %s не вычислено, а готовых задач нет", expr)
+		}
+		result, err := executeTask(task)
+		if err != nil {
+			return 0, fmt.Errorf("задача %s %v: %w", task.Operation, task.Operands, err)
+		}
+		if err := taskManager.SubmitTaskResult(orchestrator.TaskResult{ID: task.ID, Result: result}); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// randomExpression строит случайное выражение глубины не больше depth.
+// Нули встречаются часто: литерал 0 рядом с результатом задачи - главный случай проверки
+func randomExpression(rng *rand.Rand, depth int) string {
+	if depth == 0 || rng.Intn(4) == 0 {
+		literals := []string{"0", "0", "1", "2", "3", "0.5", "10"}
+		return literals[rng.Intn(len(literals))]
+	}
+
+	operand := func() string { return randomExpression(rng, depth-1) }
+	switch rng.Intn(9) {
+	case 0:
+		return "-(" + operand() + ")"
+	case 1:
+		functions := []string{"max", "min"}
+		args := make([]string, 1+rng.Intn(3))
+		for i := range args {
+			args[i] = operand()
+		}
+		return functions[rng.Intn(len(functions))] + "(" + strings.Join(args, ", ") + ")"
+	case 2:
+		return "abs(" + operand() + ")"
+	case 3:
+		return "(" + operand() + " < " + operand() + " ? " + operand() + " : " + operand() + ")"
+	}
+	operators := []string{"+", "-", "*", "/", "=="}
+	return "(" + operand() + " " + operators[rng.Intn(len(operators))] + " " + operand() + ")"
+}
+
+// TestDistributedMatchesLocal сравнивает результат вычисления задачами агентов
+// с локальным calculator.Calc: аргументы задач подставляются по позициям операндов
+func TestDistributedMatchesLocal(t *testing.T) {
+	fixed := []string{"0 - (2*3)", "(1+1) - 0", "0 / (1+1)", "(2*3) - (1+1)", "max(0, 2*3, 0)", "0 - -(1+1)"}
+
+	rng := rand.New(rand.NewSource(1))
+	expressions := append([]string{}, fixed...)
+	for len(expressions) < 3000 {
+		expressions = append(expressions, randomExpression(rng, 4))
+	}
+
+	taskManager := orchestrator.NewTaskManager()
+	checked := 0
+	for _, expr := range expressions {
+		want, err := calculator.Calc(expr)
+		if err != nil || math.IsNaN(want) || math.IsInf(want, 0) {
+			continue
+		}
+		got, err := calculateDistributed(taskManager, expr)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		if math.Abs(got-want) > 1e-9*math.Max(1, math.Abs(want)) {
+			t.Errorf("%s = %v, локально %v", expr, got, want)
+		}
+		checked++
+	}
+	if checked < 2000 {
+		t.Errorf("Проверено только %d выражений", checked)
+	}
+}
+
+// TestReadyQueueOrder проверяет порядок выдачи готовых задач: по приоритету,
+// затем по возрасту выражения, затем по длине пути до результата выражения
+func TestReadyQueueOrder(t *testing.T) {
+	next := func(taskManager *orchestrator.TaskManager) orchestrator.Task {
+		t.Helper()
+		task, ok := taskManager.GetNextTask()
+		if !ok {
+			t.Fatalf("Очередь готовых задач пуста")
+		}
+		return task
+	}
+	create := func(taskManager *orchestrator.TaskManager, expr string) {
+		t.Helper()
+		if _, err := taskManager.CreateExpression(expr, 1); err != nil {
+			t.Fatalf("Ошибка создания выражения %s: %v", expr, err)
+		}
+	}
+
+	t.Run("приоритет операции", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		create(taskManager, "1 + 2")
+		create(taskManager, "3 * 4")
+		create(taskManager, "max(1, 2)")
+		for _, want := range []string{"max", "*", "+"} {
+			if task := next(taskManager); task.Operation != want {
+				t.Errorf("Выдана задача %s, ожидается %s", task.Operation, want)
+			}
+		}
+	})
+
+	t.Run("возраст выражения", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		for i := 1; i <= 5; i++ {
+			create(taskManager, fmt.Sprintf("%d + 1", i))
+		}
+		for i := 1; i <= 5; i++ {
+			if task := next(taskManager); task.Arg1 != float64(i) {
+				t.Errorf("Выдана задача %v + 1, ожидается %d + 1", task.Arg1, i)
+			}
+		}
+	})
+
+	t.Run("критический путь", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		create(taskManager, "(4 + 5) + ((1 + 2) + 3)")
+
+		first, second := next(taskManager), next(taskManager)
+		if first.Arg1 != 1 || first.Depth != 3 || second.Arg1 != 4 || second.Depth != 2 {
+			t.Fatalf("Выданы задачи %v + %v (путь %d) и %v + %v (путь %d), ожидаются 1 + 2 (3) и 4 + 5 (2)",
+				first.Arg1, first.Arg2, first.Depth, second.Arg1, second.Arg2, second.Depth)
+		}
+
+		// Следующая задача становится готовой только после результата зависимости
+		if task, ok := taskManager.GetNextTask(); ok {
+			t.Fatalf("Выдана задача %s, зависимости которой не вычислены", task.Operation)
+		}
+		if err := taskManager.SubmitTaskResult(orchestrator.TaskResult{ID: first.ID, Result: 3}); err != nil {
+			t.Fatalf("Ошибка отправки результата: %v", err)
+		}
+		if task := next(taskManager); task.Arg1 != 3 || task.Arg2 != 3 {
+			t.Errorf("Выдана задача %v + %v, ожидается 3 + 3", task.Arg1, task.Arg2)
+		}
+	})
+}
+
+// TestTaskLease проверяет возврат в очередь задач с истёкшей арендой
+// и завершение выражения с ошибкой после TASK_MAX_ATTEMPTS выдач
+func TestTaskLease(t *testing.T) {
+	t.Setenv("TIME_ADDITION_MS", "10")
+	t.Setenv("TASK_LEASE_GRACE_MS", "100")
+	t.Setenv("TASK_MAX_ATTEMPTS", "2")
+
+	t.Run("повторная выдача", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		exprID, err := taskManager.CreateExpression("(1 + 2) * 3", 1)
+		if err != nil {
+			t.Fatalf("Ошибка создания выражения: %v", err)
+		}
+
+		first, ok := taskManager.GetNextTask()
+		if !ok {
+			t.Fatalf("Задача не выдана")
+		}
+		if _, ok := taskManager.GetNextTask(); ok {
+			t.Fatalf("Задача выдана повторно до истечения аренды")
+		}
+
+		taskManager.ReclaimExpiredLeases(time.Now().Add(time.Second))
+		second, ok := taskManager.GetNextTask()
+		if !ok || second.ID != first.ID || second.Arg1 != 1 || second.Arg2 != 2 {
+			t.Fatalf("После истечения аренды выдана задача %+v, ожидается %s", second, first.ID)
+		}
+
+		// Принимается первый полученный результат, опоздавший - отбрасывается
+		for _, result := range []orchestrator.TaskResult{{ID: second.ID, Result: 3}, {ID: first.ID, Result: 100}} {
+			if err := taskManager.SubmitTaskResult(result); err != nil {
+				t.Fatalf("Ошибка отправки результата: %v", err)
+			}
+		}
+		product, ok := taskManager.GetNextTask()
+		if !ok || product.Arg1 != 3 || product.Arg2 != 3 {
+			t.Fatalf("Выдана задача %v * %v, ожидается 3 * 3", product.Arg1, product.Arg2)
+		}
+		if err := taskManager.SubmitTaskResult(orchestrator.TaskResult{ID: product.ID, Result: 9}); err != nil {
+			t.Fatalf("Ошибка отправки результата: %v", err)
+		}
+		if expr, _ := taskManager.GetExpression(exprID); expr.Status != "COMPLETED" || expr.Result != 9 {
+			t.Errorf("Выражение: статус %s, результат %v, ожидается COMPLETED, 9", expr.Status, expr.Result)
+		}
+	})
+
+	t.Run("исчерпание попыток", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		exprID, err := taskManager.CreateExpression("(1 + 2) * 3", 1)
+		if err != nil {
+			t.Fatalf("Ошибка создания выражения: %v", err)
+		}
+
+		var task orchestrator.Task
+		for attempt := 1; attempt <= 2; attempt++ {
+			var ok bool
+			if task, ok = taskManager.GetNextTask(); !ok {
+				t.Fatalf("Попытка %d: задача не выдана", attempt)
+			}
+			taskManager.ReclaimExpiredLeases(time.Now().Add(time.Second))
+		}
+
+		expr, _ := taskManager.GetExpression(exprID)
+		if expr.Status != "ERROR" || expr.Error == "" {
+			t.Errorf("Выражение: статус %s, ошибка %q, ожидается ERROR", expr.Status, expr.Error)
+		}
+		if task, ok := taskManager.GetNextTask(); ok {
+			t.Errorf("Выдана задача %s выражения, завершённого с ошибкой", task.Operation)
+		}
+
+		// Медленный агент, аренда которого истекла последней, получает подтверждение, а не ошибку
+		if !taskManager.TaskCancelled(task.ID) {
+			t.Errorf("Агенту не сообщается об отзыве задачи с исчерпанными попытками")
+		}
+		if err := taskManager.SubmitTaskResult(orchestrator.TaskResult{ID: task.ID, Result: 3}); err != nil {
+			t.Errorf("Опоздавший результат задачи с исчерпанными попытками: ошибка %v", err)
+		}
+		if expr, _ := taskManager.GetExpression(exprID); expr.Status != "ERROR" {
+			t.Errorf("После опоздавшего результата статус %s, ожидается ERROR", expr.Status)
+		}
+	})
+}
+
+// TestExpressionDeadline проверяет завершение выражения со статусом TIMEOUT по сроку
+// и сохранение этого статуса в БД
+func TestExpressionDeadline(t *testing.T) {
+	t.Setenv("EXPRESSION_TIMEOUT_MS", "60000")
+
+	saved := make(map[string]string)
+	var savedMu sync.Mutex
+	saveExpression := orchestrator.SaveExpressionFunc
+	orchestrator.SaveExpressionFunc = func(expression *models.Expression, userID int) error {
+		savedMu.Lock()
+		defer savedMu.Unlock()
+		saved[expression.ID] = expression.Status
+		return nil
+	}
+	t.Cleanup(func() { orchestrator.SaveExpressionFunc = saveExpression })
+
+	status := func(taskManager *orchestrator.TaskManager, exprID string) string {
+		expr, _ := taskManager.GetExpression(exprID)
+		return expr.Status
+	}
+
+	t.Run("срок из запроса", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		exprID, err := taskManager.CreateExpressionWithOptions("(1 + 2) * 3", orchestrator.ExpressionOptions{Timeout: time.Second}, 1)
+		if err != nil {
+			t.Fatalf("Ошибка создания выражения: %v", err)
+		}
+
+		taskManager.ReapExpired(time.Now())
+		if got := status(taskManager, exprID); got != "PROCESSING" {
+			t.Fatalf("До истечения срока статус %s, ожидается PROCESSING", got)
+		}
+
+		taskManager.ReapExpired(time.Now().Add(2 * time.Second))
+		if got := status(taskManager, exprID); got != "TIMEOUT" {
+			t.Errorf("После истечения срока статус %s, ожидается TIMEOUT", got)
+		}
+		savedMu.Lock()
+		if saved[exprID] != "TIMEOUT" {
+			t.Errorf("В БД сохранён статус %q, ожидается TIMEOUT", saved[exprID])
+		}
+		savedMu.Unlock()
+		if task, ok := taskManager.GetNextTask(); ok {
+			t.Errorf("Выдана задача %s просроченного выражения", task.Operation)
+		}
+	})
+
+	t.Run("срок по умолчанию", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		exprID, err := taskManager.CreateExpression("1 + 2", 1)
+		if err != nil {
+			t.Fatalf("Ошибка создания выражения: %v", err)
+		}
+
+		taskManager.ReapExpired(time.Now().Add(59 * time.Second))
+		if got := status(taskManager, exprID); got != "PROCESSING" {
+			t.Fatalf("До истечения срока по умолчанию статус %s, ожидается PROCESSING", got)
+		}
+		taskManager.ReapExpired(time.Now().Add(61 * time.Second))
+		if got := status(taskManager, exprID); got != "TIMEOUT" {
+			t.Errorf("После истечения срока по умолчанию статус %s, ожидается TIMEOUT", got)
+		}
+	})
+
+	t.Run("фоновая проверка без агентов", func(t *testing.T) {
+		taskManager := orchestrator.NewTaskManager()
+		stop := taskManager.StartReaper(5 * time.Millisecond)
+		defer stop()
+
+		exprID, err := taskManager.CreateExpressionWithOptions("1 + 2", orchestrator.ExpressionOptions{Timeout: 20 * time.Millisecond}, 1)
+		if err != nil {
+			t.Fatalf("Ошибка создания выражения: %v", err)
+		}
+		for deadline := time.Now().Add(2 * time.Second); status(taskManager, exprID) != "TIMEOUT"; {
+			if time.Now().After(deadline) {
+				t.Fatalf("Выражение не завершено по сроку: статус %s", status(taskManager, exprID))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+}
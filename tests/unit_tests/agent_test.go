@@ -1,7 +1,10 @@
 package unit_tests
 
 import (
+	"gocalc/internal/calculator"
 	"gocalc/internal/types"
+	"math"
+	"math/big"
 	"testing"
 	"time"
 )
@@ -10,6 +13,8 @@ func calculateResultTest(task types.Task) float64 {
 	time.Sleep(10 * time.Millisecond)
 
 	switch task.Operation {
+	case "neg":
+		return -task.Arg1
 	case "+":
 		return task.Arg1 + task.Arg2
 	case "-":
@@ -21,6 +26,8 @@ func calculateResultTest(task types.Task) float64 {
 			return 0
 		}
 		return task.Arg1 / task.Arg2
+	case "^":
+		return math.Pow(task.Arg1, task.Arg2)
 	default:
 		return 0
 	}
@@ -82,6 +89,25 @@ func TestCalculateResult(t *testing.T) {
 			},
 			want: 0,
 		},
+		{
+			name: "Унарный минус",
+			task: types.Task{
+				ID:        "test-7",
+				Arg1:      6,
+				Operation: "neg",
+			},
+			want: -6,
+		},
+		{
+			name: "Возведение в степень",
+			task: types.Task{
+				ID:        "test-8",
+				Arg1:      2,
+				Arg2:      3,
+				Operation: "^",
+			},
+			want: 8,
+		},
 		{
 			name: "Неизвестная операция",
 			task: types.Task{
@@ -103,3 +129,49 @@ func TestCalculateResult(t *testing.T) {
 		})
 	}
 }
+
+// Агент передаёт унарной операции в режимах decimal и interval один текстовый операнд
+func TestUnaryTextOperands(t *testing.T) {
+	tests := []struct {
+		operation    string
+		operand      string
+		wantDecimal  string
+		wantInterval string
+	}{
+		{operation: calculator.UnaryMinus, operand: "2.5", wantDecimal: "-2.5", wantInterval: "[-2.5, -2.5]"},
+		{operation: calculator.UnaryPlus, operand: "2.5", wantDecimal: "2.5", wantInterval: "[2.5, 2.5]"},
+		{operation: calculator.UnaryNot, operand: "0", wantDecimal: "1", wantInterval: "[1, 1]"},
+		{operation: calculator.UnaryMinus, operand: "[4.8, 5.2]", wantInterval: "[-5.2, -4.8]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.operation+" "+tt.operand, func(t *testing.T) {
+			if !calculator.IsUnaryOperator(tt.operation) {
+				t.Fatalf("IsUnaryOperator(%q) = false, want true", tt.operation)
+			}
+			if tt.wantDecimal != "" {
+				arg, err := calculator.ParseDecimal(tt.operand)
+				if err != nil {
+					t.Fatalf("ParseDecimal(%q) error = %v", tt.operand, err)
+				}
+				got, err := calculator.ApplyDecimal(tt.operation, []*big.Rat{arg})
+				if err != nil || calculator.FormatDecimal(got) != tt.wantDecimal {
+					t.Errorf("ApplyDecimal() = %v, %v, want %s", got, err, tt.wantDecimal)
+				}
+			}
+			arg, err := calculator.ParseInterval(tt.operand)
+			if err != nil {
+				t.Fatalf("ParseInterval(%q) error = %v", tt.operand, err)
+			}
+			got, err := calculator.ApplyInterval(tt.operation, []calculator.Interval{arg})
+			if err != nil || calculator.FormatInterval(got) != tt.wantInterval {
+				t.Errorf("ApplyInterval() = %v, %v, want %s", got, err, tt.wantInterval)
+			}
+		})
+	}
+
+	for _, operation := range []string{"", "-", "+", "sqrt"} {
+		if calculator.IsUnaryOperator(operation) {
+			t.Errorf("IsUnaryOperator(%q) = true, want false", operation)
+		}
+	}
+}
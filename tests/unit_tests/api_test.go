@@ -30,12 +30,18 @@ func TestCalculatorHandler_Calculate(t *testing.T) {
 		return nil
 	}
 
+	originalUserLocale := api.UserLocaleFunc
+	defer func() { api.UserLocaleFunc = originalUserLocale }()
+
 	tests := []struct {
 		name           string
+		locale         string
 		requestBody    interface{}
 		wantStatus     int
 		wantResult     *float64
+		wantFormatted  string
 		wantErrMessage string
+		wantSyntaxCode string
 	}{
 		{
 			name: "корректное выражение",
@@ -45,6 +51,25 @@ func TestCalculatorHandler_Calculate(t *testing.T) {
 			wantStatus: http.StatusOK,
 			wantResult: func() *float64 { f := 6.0; return &f }(),
 		},
+		{
+			name: "выражение с переменными",
+			requestBody: api.CalculateRequest{
+				Expression: "rate * principal",
+				Variables:  map[string]float64{"rate": 0.05, "principal": 1000},
+			},
+			wantStatus: http.StatusOK,
+			wantResult: func() *float64 { f := 50.0; return &f }(),
+		},
+		{
+			name:   "десятичная запятая в локали ru",
+			locale: "ru",
+			requestBody: api.CalculateRequest{
+				Expression: "max(1 234,5; 2) * 2",
+			},
+			wantStatus:    http.StatusOK,
+			wantResult:    func() *float64 { f := 2469.0; return &f }(),
+			wantFormatted: "2 469",
+		},
 		{
 			name: "некорректное выражение",
 			requestBody: api.CalculateRequest{
@@ -53,6 +78,15 @@ func TestCalculatorHandler_Calculate(t *testing.T) {
 			wantStatus:     http.StatusUnprocessableEntity,
 			wantErrMessage: "Expression is not valid",
 		},
+		{
+			name: "синтаксическая ошибка с позицией",
+			requestBody: api.CalculateRequest{
+				Expression: "2 * (3 + )",
+			},
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantErrMessage: "Expression is not valid",
+			wantSyntaxCode: "unexpected_token",
+		},
 		{
 			name:           "пустой запрос",
 			requestBody:    nil,
@@ -81,6 +115,10 @@ func TestCalculatorHandler_Calculate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			api.UserLocaleFunc = func(userID int) (string, error) {
+				return tt.locale, nil
+			}
+
 			var body []byte
 			var err error
 			if tt.requestBody != nil {
@@ -111,6 +149,9 @@ func TestCalculatorHandler_Calculate(t *testing.T) {
 				if response.Result != *tt.wantResult {
 					t.Errorf("Calculate() result = %v, want %v", response.Result, *tt.wantResult)
 				}
+				if tt.wantFormatted != "" && response.Formatted != tt.wantFormatted {
+					t.Errorf("Calculate() formatted = %v, want %v", response.Formatted, tt.wantFormatted)
+				}
 			}
 
 			if tt.wantErrMessage != "" {
@@ -121,6 +162,14 @@ func TestCalculatorHandler_Calculate(t *testing.T) {
 				if response.Error != tt.wantErrMessage {
 					t.Errorf("Calculate() error = %v, want %v", response.Error, tt.wantErrMessage)
 				}
+				if tt.wantSyntaxCode != "" {
+					if response.SyntaxError == nil {
+						t.Fatalf("Calculate() syntax_error отсутствует в ответе")
+					}
+					if response.SyntaxError.Code != tt.wantSyntaxCode || response.SyntaxError.Offset != 9 {
+						t.Errorf("Calculate() syntax_error = %+v, want code %v at offset 9", response.SyntaxError, tt.wantSyntaxCode)
+					}
+				}
 			}
 		})
 	}
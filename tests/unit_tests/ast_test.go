@@ -0,0 +1,134 @@
+package unit_tests
+
+import (
+	"errors"
+	"gocalc/internal/ast"
+	"strings"
+	"testing"
+)
+
+// sexpr записывает дерево в виде S-выражения, чтобы сравнивать структуру разбора
+type sexpr struct{}
+
+func (sexpr) VisitNumber(n *ast.Number) (string, error) { return n.Value, nil }
+func (sexpr) VisitIdent(n *ast.Ident) (string, error)   { return n.Name, nil }
+
+func (s sexpr) VisitUnary(n *ast.UnaryOp) (string, error) {
+	operand, err := ast.Walk[string](n.Operand, s)
+	return "(" + n.Op + " " + operand + ")", err
+}
+
+func (s sexpr) VisitBinary(n *ast.BinaryOp) (string, error) {
+	left, err := ast.Walk[string](n.Left, s)
+	if err != nil {
+		return "", err
+	}
+	right, err := ast.Walk[string](n.Right, s)
+	return "(" + n.Op + " " + left + " " + right + ")", err
+}
+
+func (s sexpr) VisitCall(n *ast.Call) (string, error) {
+	parts := []string{n.Name}
+	for _, arg := range n.Args {
+		text, err := ast.Walk[string](arg, s)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, text)
+	}
+	return "(" + strings.Join(parts, " ") + ")", nil
+}
+
+func (s sexpr) VisitConditional(n *ast.Conditional) (string, error) {
+	parts := []string{"?:"}
+	for _, node := range []ast.Node{n.Cond, n.Then, n.Else} {
+		text, err := ast.Walk[string](node, s)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, text)
+	}
+	return "(" + strings.Join(parts, " ") + ")", nil
+}
+
+func (s sexpr) VisitVector(n *ast.Vector) (string, error) {
+	parts := make([]string, len(n.Elements))
+	for i, element := range n.Elements {
+		text, err := ast.Walk[string](element, s)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = text
+	}
+	return "[" + strings.Join(parts, " ") + "]", nil
+}
+
+func TestASTParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"приоритет умножения", "1 + 2 * 3", "(+ 1 (* 2 3))"},
+		{"левая ассоциативность", "8 - 3 - 2", "(- (- 8 3) 2)"},
+		{"правая ассоциативность степени", "2^3**2", "(^ 2 (^ 3 2))"},
+		{"унарный минус и степень", "-2^2", "(neg (^ 2 2))"},
+		{"унарный минус и умножение", "-2*3", "(* (neg 2) 3)"},
+		{"скобки", "(1 + 2) * 3", "(* (+ 1 2) 3)"},
+		{"вызов функции", "MAX(1, x + 1)", "(max 1 (+ x 1))"},
+		{"вызов без аргументов", "pi()", "(pi)"},
+		{"вложенный условный оператор", "a ? 1 : b ? 2 : 3", "(?: a 1 (?: b 2 3))"},
+		{"сравнение и логика", "1 < 2 && !0", "(&& (< 1 2) (not 0))"},
+		{"xor между & и |", "1 | 2 xor 3 & 4", "(| 1 (xor 2 (& 3 4)))"},
+		{"шестнадцатеричный литерал", "0x10 + 1", "(+ 16 1)"},
+		{"матрица", "[[1, 2], [3, x + 1]]", "[[1 2] [3 (+ x 1)]]"},
+		{"матричное произведение и сложение", "a @ b + c", "(+ (@ a b) c)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := ast.Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.input, err)
+			}
+			got, err := ast.Walk[string](node, sexpr{})
+			if err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Parse(%q) = %s, ожидалось %s", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestASTParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		code   string
+		offset int
+	}{
+		{"незакрытая скобка", "(1 + 2", ast.ErrCodeMismatchedParentheses, 0},
+		{"лишняя закрывающая скобка", "1 + 2)", ast.ErrCodeMismatchedParentheses, 5},
+		{"обрыв выражения", "1 +", ast.ErrCodeUnexpectedEnd, 3},
+		{"два числа подряд", "1 2", ast.ErrCodeUnexpectedToken, 2},
+		{"запятая вне вызова", "1, 2", ast.ErrCodeMisplacedComma, 1},
+		{"условие без ':'", "1 ? 2", ast.ErrCodeMismatchedConditional, 2},
+		{"незакрытая квадратная скобка", "[1, 2", ast.ErrCodeMismatchedBrackets, 0},
+		{"лишняя квадратная скобка", "[1] + 2]", ast.ErrCodeMismatchedBrackets, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ast.Parse(tt.input)
+			var synErr *ast.SyntaxError
+			if !errors.As(err, &synErr) {
+				t.Fatalf("Parse(%q) error = %v, ожидалась SyntaxError", tt.input, err)
+			}
+			if synErr.Code != tt.code || synErr.Offset != tt.offset {
+				t.Errorf("Parse(%q) = %s@%d, ожидалось %s@%d", tt.input, synErr.Code, synErr.Offset, tt.code, tt.offset)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package unit_tests
 
 import (
+	"errors"
 	"gocalc/internal/calculator"
+	"math"
 	"strings"
 	"testing"
 )
@@ -34,11 +36,24 @@ func TestCalc(t *testing.T) {
 		},
 		{
 			name:    "некорректный символ",
-			input:   "2+a",
+			input:   "2+$",
 			want:    0,
 			wantErr: true,
 			errMsg:  "invalid character",
 		},
+		{
+			name:    "неизвестная переменная",
+			input:   "2+a",
+			want:    0,
+			wantErr: true,
+			errMsg:  "undefined variable: a",
+		},
+		{
+			name:    "встроенные константы",
+			input:   "cos(pi) + log(e)",
+			want:    0,
+			wantErr: false,
+		},
 		{
 			name:    "деление на ноль",
 			input:   "2/0",
@@ -102,6 +117,300 @@ func TestCalc(t *testing.T) {
 			want:    0, // 5-(2*3)+1
 			wantErr: false,
 		},
+		{
+			name:    "унарный минус в начале",
+			input:   "-5+3",
+			want:    -2,
+			wantErr: false,
+		},
+		{
+			name:    "унарный минус в скобках",
+			input:   "2*(-4)",
+			want:    -8,
+			wantErr: false,
+		},
+		{
+			name:    "двойной унарный минус",
+			input:   "--1",
+			want:    1,
+			wantErr: false,
+		},
+		{
+			name:    "унарный минус после бинарного оператора",
+			input:   "2*-3",
+			want:    -6,
+			wantErr: false,
+		},
+		{
+			name:    "унарный плюс",
+			input:   "+2-+3",
+			want:    -1,
+			wantErr: false,
+		},
+		{
+			name:    "унарный минус перед скобкой",
+			input:   "-(2+3)*2",
+			want:    -10,
+			wantErr: false,
+		},
+		{
+			name:    "возведение в степень",
+			input:   "2^10",
+			want:    1024,
+			wantErr: false,
+		},
+		{
+			name:    "степень правоассоциативна",
+			input:   "2^3^2",
+			want:    512, // 2^(3^2)
+			wantErr: false,
+		},
+		{
+			name:    "синоним степени **",
+			input:   "3**2*2",
+			want:    18, // (3^2)*2
+			wantErr: false,
+		},
+		{
+			name:    "степень связывается сильнее унарного минуса",
+			input:   "-2^2",
+			want:    -4,
+			wantErr: false,
+		},
+		{
+			name:    "отрицательный показатель степени",
+			input:   "2^-1",
+			want:    0.5,
+			wantErr: false,
+		},
+		{
+			name:    "недопустимое возведение в степень",
+			input:   "0^-1",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid exponentiation",
+		},
+		{
+			name:    "функции с переменным числом аргументов",
+			input:   "sqrt(16) + max(2, 3, 7)",
+			want:    11,
+			wantErr: false,
+		},
+		{
+			name:    "вложенные вызовы функций",
+			input:   "min(abs(-5), round(2.6), 10)",
+			want:    3,
+			wantErr: false,
+		},
+		{
+			name:    "функция с выражениями в аргументах",
+			input:   "max(1+1, 2*(3-1)) ^ 2",
+			want:    16,
+			wantErr: false,
+		},
+		{
+			name:    "логарифм по основанию",
+			input:   "log(8, 2) + cos(0) + sin(0)",
+			want:    4,
+			wantErr: false,
+		},
+		{
+			name:    "сумма и среднее",
+			input:   "sum(1, 2, 3, 4) + avg(2, 4, 9)",
+			want:    15,
+			wantErr: false,
+		},
+		{
+			name:    "медиана",
+			input:   "median(5, 1, 3) + median(4, 1, 3, 2)",
+			want:    5.5,
+			wantErr: false,
+		},
+		{
+			name:    "дисперсия и стандартное отклонение",
+			input:   "variance(2, 4, 4, 4, 5, 5, 7, 9) + stddev(2, 4, 4, 4, 5, 5, 7, 9)",
+			want:    6,
+			wantErr: false,
+		},
+		{
+			name:    "процентиль с интерполяцией",
+			input:   "percentile(90, 10, 1, 2, 3, 4, 5, 6, 7, 8, 9) + percentile(0, 3, 2) + percentile(100, 3, 2)",
+			want:    14.1,
+			wantErr: false,
+		},
+		{
+			name:    "процентиль вне диапазона",
+			input:   "percentile(101, 1, 2)",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid function argument: percentile must be between 0 and 100",
+		},
+		{
+			name:    "процентиль без значений",
+			input:   "percentile(50)",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid number of arguments",
+		},
+		{
+			name:    "неизвестная функция",
+			input:   "foo(1)",
+			want:    0,
+			wantErr: true,
+			errMsg:  "unknown function",
+		},
+		{
+			name:    "неверное число аргументов",
+			input:   "sqrt(1, 2)",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid number of arguments",
+		},
+		{
+			name:    "корень из отрицательного числа",
+			input:   "sqrt(-4)",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid function argument",
+		},
+		{
+			name:    "запятая вне вызова функции",
+			input:   "(1, 2)",
+			want:    0,
+			wantErr: true,
+			errMsg:  "misplaced comma",
+		},
+		{
+			name:    "унарный минус без операнда",
+			input:   "2*-",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid expression",
+		},
+		{
+			name:    "экспоненциальная запись",
+			input:   "1.5e-3*1000 + 2E+2",
+			want:    201.5,
+			wantErr: false,
+		},
+		{
+			name:    "шестнадцатеричные и двоичные литералы",
+			input:   "0x1F + 0b1010",
+			want:    41,
+			wantErr: false,
+		},
+		{
+			name:    "разделители разрядов",
+			input:   "1_000_000 / 1e6",
+			want:    1,
+			wantErr: false,
+		},
+		{
+			name:    "несколько точек в числе",
+			input:   "1.2.3",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid number: 1.2.3",
+		},
+		{
+			name:    "неверная шестнадцатеричная цифра",
+			input:   "0x1G + 1",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid number: 0x1G",
+		},
+		{
+			name:    "неверная двоичная цифра",
+			input:   "0b102",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid number: 0b102",
+		},
+		{
+			name:    "разделитель не между цифрами",
+			input:   "1__000 + 1_",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid number: 1__000",
+		},
+		{
+			name:    "порядок без цифр",
+			input:   "2e+",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid number: 2e+",
+		},
+		{
+			name:    "остаток и целочисленное деление",
+			input:   "17 % 5 + 7 // 2 + -7 // 2 + -7 % 2",
+			want:    2 + 3 - 4 + 1,
+			wantErr: false,
+		},
+		{
+			name:    "побитовые операторы и сдвиги",
+			input:   "(0b1100 & 0b1010) | 1 << 4 + (5 XOR 3) - (-16 >> 2)",
+			want:    8 | 1<<14,
+			wantErr: false,
+		},
+		{
+			name:    "остаток от деления на ноль",
+			input:   "5 % (2 - 2)",
+			want:    0,
+			wantErr: true,
+			errMsg:  "division by zero",
+		},
+		{
+			name:    "целочисленное деление на ноль",
+			input:   "5 // 0",
+			want:    0,
+			wantErr: true,
+			errMsg:  "division by zero",
+		},
+		{
+			name:    "побитовая операция над дробным числом",
+			input:   "1.5 & 1",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid bitwise operand",
+		},
+		{
+			name:    "отрицательный сдвиг",
+			input:   "1 << -1",
+			want:    0,
+			wantErr: true,
+			errMsg:  "invalid shift count",
+		},
+		{
+			name:    "сравнения и логические операторы",
+			input:   "(2 < 3) + (2 >= 3) * 10 + (1 == 1 && 2 != 2) + (0 || 5) * 100 + !0",
+			want:    102,
+			wantErr: false,
+		},
+		{
+			name:    "условный оператор",
+			input:   "3*40 >= 100 ? 0.9 : 1",
+			want:    0.9,
+			wantErr: false,
+		},
+		{
+			name:    "вложенный условный оператор правоассоциативен",
+			input:   "0 ? 1 : 0 ? 2 : 3",
+			want:    3,
+			wantErr: false,
+		},
+		{
+			name:    "ошибка в невыбранной ветке не учитывается",
+			input:   "0 == 0 ? 1 : 1/0",
+			want:    1,
+			wantErr: false,
+		},
+		{
+			name:    "ошибка в выбранной ветке",
+			input:   "1 > 0 ? 1/0 : 1",
+			want:    0,
+			wantErr: true,
+			errMsg:  "division by zero",
+		},
 	}
 
 	for _, tt := range tests {
@@ -167,6 +476,51 @@ func TestRPNPriority(t *testing.T) {
 			input:    "2*((3+2)*2)",
 			expected: "2 3 2 + 2 * *",
 		},
+		{
+			name:     "унарный минус связывается сильнее умножения",
+			input:    "-2*3",
+			expected: "2 neg 3 *",
+		},
+		{
+			name:     "унарный минус после умножения",
+			input:    "2*-3+1",
+			expected: "2 3 neg * 1 +",
+		},
+		{
+			name:     "правоассоциативная степень",
+			input:    "2^3^2",
+			expected: "2 3 2 ^ ^",
+		},
+		{
+			name:     "степень старше умножения",
+			input:    "2*3**2",
+			expected: "2 3 2 ^ *",
+		},
+		{
+			name:     "вызов функции с несколькими аргументами",
+			input:    "sqrt(16) + max(2, 3*4, 7)",
+			expected: "16 sqrt 2 3 4 * 7 max +",
+		},
+		{
+			name:     "остаток и целочисленное деление как умножение",
+			input:    "1 + 7 // 2 % 3 * 4",
+			expected: "1 7 2 // 3 % 4 * +",
+		},
+		{
+			name:     "приоритет побитовых операторов",
+			input:    "1 | 2 xor 3 & 4 << 1 + 1",
+			expected: "1 2 3 4 1 1 + << & xor |",
+		},
+		{
+			name:     "сравнения младше сдвигов, логические операторы младше побитовых",
+			input:    "1 || 2 && 3 | 4 == 5 < 6 << 1",
+			expected: "1 2 3 4 5 6 1 << < == | && ||",
+		},
+		{
+			name:     "условный оператор с наименьшим приоритетом",
+			input:    "!1 || 2 > 1 ? 1 + 2 : 3 ? 4 : 5",
+			expected: "1 not 2 1 > || 1 2 + 3 4 5 ?: ?:",
+		},
 	}
 
 	for _, tt := range tests {
@@ -196,3 +550,862 @@ func TestRPNPriority(t *testing.T) {
 		})
 	}
 }
+
+func TestCalcWithVariables(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		variables map[string]float64
+		want      float64
+		wantErr   bool
+	}{
+		{
+			name:      "подстановка переменных",
+			input:     "rate * principal",
+			variables: map[string]float64{"rate": 0.05, "principal": 1000},
+			want:      50,
+		},
+		{
+			name:      "отрицательное значение переменной",
+			input:     "x^2 - -x",
+			variables: map[string]float64{"x": -3},
+			want:      6,
+		},
+		{
+			name:      "переменная перекрывает константу",
+			input:     "e + pi",
+			variables: map[string]float64{"e": 1},
+			want:      1 + math.Pi,
+		},
+		{
+			name:      "переменная в аргументе функции",
+			input:     "max(a, b_2)",
+			variables: map[string]float64{"a": 1, "b_2": 7},
+			want:      7,
+		},
+		{
+			name:      "переменная не задана",
+			input:     "a + b",
+			variables: map[string]float64{"a": 1},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calculator.CalcWithVariables(tt.input, tt.variables)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CalcWithVariables() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("CalcWithVariables() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateDecimal(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+		errMsg  string
+	}{
+		{name: "сумма десятичных дробей", input: "0.1+0.2", want: "0.3"},
+		{name: "периодическая дробь", input: "1/3", want: "1/3"},
+		{name: "возврат к десятичной записи", input: "1/3*3+0.5", want: "1.5"},
+		{name: "отрицательная степень", input: "-2^-3", want: "-0.125"},
+		{name: "точный корень", input: "sqrt(0.25)", want: "0.5"},
+		{name: "округление от нуля", input: "round(-2.5) + round(1.005, 2)", want: "-1.99"},
+		{name: "минимум", input: "min(0.3, 1/3, 0.31)", want: "0.3"},
+		{name: "экспоненциальная и шестнадцатеричная запись", input: "0x10 * 1e-1 + 1_0e-2", want: "1.7"},
+		{name: "точный остаток", input: "0.75 % 0.5 + 7 // 2 + -1/3 % 1", want: "47/12"},
+		{name: "побитовые операции без ограничения разрядности", input: "0x10 >> 2 | 1 << 70", want: "1180591620717411303428"},
+		{name: "точное сравнение", input: "0.1 + 0.2 == 0.3 ? 1/3 : 0", want: "1/3"},
+		{name: "ошибка в невыбранной ветке", input: "!(1/3 > 0.3) ? 1/0 : 2", want: "2"},
+		{name: "статистические функции", input: "avg(0.1, 0.2) + median(0.1, 0.3, 0.2)", want: "0.35"},
+		{name: "точная дисперсия", input: "variance(0.1, 0.2, 0.3)", want: "1/150"},
+		{name: "точный процентиль", input: "percentile(25, 1, 2, 3, 4) + stddev(1, 2)", want: "2.25"},
+		{name: "неточное стандартное отклонение", input: "stddev(1, 2, 3)", wantErr: true, errMsg: "inexact sqrt is not supported in decimal mode"},
+		{name: "побитовая операция над дробью", input: "1/2 & 1", wantErr: true, errMsg: "invalid bitwise operand: 0.5 is not an integer"},
+		{name: "деление на ноль", input: "1/(0.1-0.1)", wantErr: true, errMsg: "division by zero"},
+		{name: "дробный показатель", input: "2^0.5", wantErr: true, errMsg: "non-integer exponent is not supported in decimal mode"},
+		{name: "неточный корень", input: "sqrt(2)", wantErr: true, errMsg: "inexact sqrt is not supported in decimal mode"},
+		{name: "неподдерживаемая функция", input: "sin(0)", wantErr: true, errMsg: "function sin is not supported in decimal mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calculator.NewCalculator().CalculateDecimal(tt.input)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CalculateDecimal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if err.Error() != tt.errMsg {
+					t.Errorf("CalculateDecimal() error message = %v, want %v", err.Error(), tt.errMsg)
+				}
+				return
+			}
+
+			if text := calculator.FormatDecimal(got); text != tt.want {
+				t.Errorf("CalculateDecimal() = %v, want %v", text, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+		errMsg  string
+	}{
+		{name: "число с погрешностью", input: "5±0.2", want: "[4.8, 5.2]"},
+		{name: "запись +/-", input: "5+/-0.2", want: "[4.8, 5.2]"},
+		{name: "погрешность связывается сильнее умножения", input: "2*5±0.2", want: "[9.6, 10.4]"},
+		{name: "умножение интервалов", input: "[1, 2] * [3, 4]", want: "[3, 8]"},
+		{name: "умножение интервала со сменой знака", input: "[-1, 2] * [3, 4]", want: "[-4, 8]"},
+		{name: "деление", input: "(1±0.5) / (2±0.5)", want: "[0.2, 1]"},
+		{name: "квадрат и унарный минус", input: "-(5±1)^2", want: "[-36, -16]"},
+		{name: "монотонная функция", input: "sqrt([4, 9])", want: "[2, 3]"},
+		{name: "модуль интервала через ноль", input: "abs([-3, 2])", want: "[0, 3]"},
+		{name: "синус с максимумом внутри интервала", input: "sin([0, 4])", want: "[-0.7568024953079282, 1]"},
+		{name: "определённое условие", input: "[1, 2] > 0 ? 1 : 2", want: "[1, 1]"},
+		{name: "деление на интервал с нулём", input: "1 / [-1, 1]", wantErr: true, errMsg: "division by zero"},
+		{name: "неопределённое условие", input: "[0, 2] > 1 ? 1 : 2", wantErr: true, errMsg: "invalid condition: condition is uncertain over [0, 1]"},
+		{name: "отрицательная погрешность", input: "5±-1", wantErr: true, errMsg: "invalid interval: negative uncertainty -1"},
+		{name: "границы в обратном порядке", input: "[2, 1]", wantErr: true, errMsg: "invalid interval: lower bound 2 is greater than upper bound 1"},
+		{name: "литерал из трёх чисел", input: "[1, 2, 3]", wantErr: true, errMsg: "invalid interval: expected [low, high]"},
+		{name: "неподдерживаемая функция", input: "variance([1, 2], 3)", wantErr: true, errMsg: "function variance is not supported for intervals"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calculator.NewCalculator().CalculateInterval(tt.input)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CalculateInterval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if err.Error() != tt.errMsg {
+					t.Errorf("CalculateInterval() error message = %v, want %v", err.Error(), tt.errMsg)
+				}
+				return
+			}
+
+			if text := calculator.FormatInterval(got); text != tt.want {
+				t.Errorf("CalculateInterval() = %v, want %v", text, tt.want)
+			}
+		})
+	}
+
+	// Вне режима interval погрешность не поддерживается
+	if _, err := calculator.NewCalculator().Calculate("5±0.2"); err == nil {
+		t.Error("Calculate(\"5±0.2\") должен вернуть ошибку вне режима interval")
+	}
+}
+
+func TestUnits(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		variables map[string]float64
+		want      float64
+		unit      string
+	}{
+		{name: "скорость в СИ", input: "5 km / 2 h", want: 5000.0 / 7200, unit: "m/s"},
+		{name: "перевод скорости", input: "5 km / 2 h to km/h", want: 2.5, unit: "km/h"},
+		{name: "площадь", input: "3 m * 4 m", want: 12, unit: "m^2"},
+		{name: "степень единицы после числа", input: "3 m^2 to cm^2", want: 30000, unit: "cm^2"},
+		{name: "частное единиц после числа", input: "60 mi/h to mph", want: 60, unit: "mph"},
+		{name: "единица слитно с числом", input: "5km", want: 5000, unit: "m"},
+		{name: "единица через пробел", input: "5 km", want: 5000, unit: "m"},
+		{name: "порядок числа перед единицей", input: "2e3m to km", want: 2, unit: "km"},
+		{name: "производная единица", input: "2 kg * 9.8 m/s^2 to N", want: 19.6, unit: "N"},
+		{name: "корень из площади", input: "sqrt(16 m^2)", want: 4, unit: "m"},
+		{name: "функция сохраняет размерность", input: "max(1 km, 500 m) to m", want: 1000, unit: "m"},
+		{name: "условие над величинами", input: "1 km > 900 m ? 1 h : 30 min", want: 3600, unit: "s"},
+		{name: "обратная величина", input: "1 / 2 s", want: 0.5, unit: "1/s"},
+		{name: "безразмерное отношение", input: "1 km / 1 m", want: 1000, unit: ""},
+		{name: "переменная важнее единицы", input: "2 m * h", variables: map[string]float64{"h": 3}, want: 6, unit: "m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calc := calculator.NewCalculator()
+			calc.SetVariables(tt.variables)
+			got, err := calc.Calculate(tt.input)
+			if err != nil {
+				t.Fatalf("Calculate() error = %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Calculate() = %v, want %v", got, tt.want)
+			}
+			if calc.Unit() != tt.unit {
+				t.Errorf("Unit() = %q, want %q", calc.Unit(), tt.unit)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		name   string
+		input  string
+		code   string
+		errMsg string
+	}{
+		{name: "сложение разных размерностей", input: "1 m + 1 s", code: calculator.ErrCodeIncompatibleUnits, errMsg: "incompatible units: m and s"},
+		{name: "сравнение разных размерностей", input: "1 m < 1 kg ? 1 : 0", code: calculator.ErrCodeIncompatibleUnits, errMsg: "incompatible units: m and kg"},
+		{name: "перевод в другую размерность", input: "5 km to h", code: calculator.ErrCodeIncompatibleUnits, errMsg: "incompatible units: m and s"},
+		{name: "функция от размерной величины", input: "sin(1 m)", code: calculator.ErrCodeIncompatibleUnits, errMsg: "incompatible units: function sin requires a dimensionless argument, got m"},
+		{name: "дробная степень", input: "(2 m)^0.5", code: calculator.ErrCodeIncompatibleUnits, errMsg: "incompatible units: exponent of m must be an integer number"},
+		{name: "неизвестная единица", input: "5 furlong", code: calculator.ErrCodeUnexpectedToken, errMsg: `invalid expression: unexpected token "furlong"`},
+		{name: "константа после числа", input: "2 pi", code: calculator.ErrCodeUnexpectedToken, errMsg: `invalid expression: unexpected token "pi"`},
+		{name: "единица без числа", input: "h * 2", code: calculator.ErrCodeUndefinedVariable, errMsg: "undefined variable: h"},
+		{name: "опечатка в имени переменной", input: "s + 1", code: calculator.ErrCodeUndefinedVariable, errMsg: "undefined variable: s"},
+		{name: "перевод не в единицу", input: "5 km to 2 m", code: calculator.ErrCodeUnknownUnit, errMsg: "unknown unit: conversion target must be a unit"},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := calculator.NewCalculator().Calculate(tt.input)
+			synErr, ok := calculator.AsSyntaxError(err)
+			if !ok {
+				t.Fatalf("Calculate() error = %v, want syntax error %s", err, tt.code)
+			}
+			if synErr.Code != tt.code || synErr.Message != tt.errMsg {
+				t.Errorf("Calculate() error = %s (%s), want %s (%s)", synErr.Message, synErr.Code, tt.errMsg, tt.code)
+			}
+		})
+	}
+
+	// Перевод в точном режиме не теряет точности
+	calc := calculator.NewCalculator()
+	exact, err := calc.CalculateDecimal("0.1 mi + 1 ft to ft")
+	if err != nil || calculator.FormatDecimal(exact) != "529" || calc.Unit() != "ft" {
+		t.Errorf("CalculateDecimal() = %v %q, %v, want 529 ft", exact, calc.Unit(), err)
+	}
+}
+
+func TestCalculateTensor(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+		errMsg  string
+	}{
+		{name: "вектор", input: "[1, 2, 3]", want: "[1, 2, 3]"},
+		{name: "поэлементные операции", input: "[1, 2] * 2 + [10, 20]", want: "[12, 24]"},
+		{name: "унарный минус", input: "-[[1, -2], [3, 4]]", want: "[[-1, 2], [-3, -4]]"},
+		{name: "произведение матриц", input: "[[1, 2], [3, 4]] @ [[5, 6], [7, 8]]", want: "[[19, 22], [43, 50]]"},
+		{name: "матрица на вектор", input: "[[1, 2], [3, 4], [5, 6]] @ [1, 1]", want: "[3, 7, 11]"},
+		{name: "вектор на вектор", input: "[1, 2, 3] @ [4, 5, 6]", want: "32"},
+		{name: "скалярное произведение", input: "dot([1, 2], [3, 4])", want: "11"},
+		{name: "транспонирование", input: "transpose([[1, 2, 3], [4, 5, 6]])", want: "[[1, 4], [2, 5], [3, 6]]"},
+		{name: "определитель", input: "det([[0, 2, 1], [1, 0, 0], [2, 1, 3]])", want: "-5"},
+		{name: "элементы-выражения", input: "[1 + 1, max(2, 3)]", want: "[2, 3]"},
+		{name: "условный оператор", input: "det([[1, 0], [0, 1]]) == 1 ? [1, 2] : [3, 4]", want: "[1, 2]"},
+		{name: "строки разной длины", input: "[[1, 2], [3]]", wantErr: true,
+			errMsg: "invalid matrix: rows must have equal length, got vector of 2 and vector of 1"},
+		{name: "несовместимые размерности", input: "[1, 2] + [1, 2, 3]", wantErr: true,
+			errMsg: "incompatible shapes: vector of 2 and vector of 3"},
+		{name: "неверное произведение", input: "[[1, 2]] @ [[1, 2]]", wantErr: true,
+			errMsg: "invalid matrix product: 1x2 matrix @ 1x2 matrix"},
+		{name: "определитель неквадратной матрицы", input: "det([[1, 2]])", wantErr: true,
+			errMsg: "invalid function argument: det of 1x2 matrix, expected square matrix"},
+		{name: "функция над числами от вектора", input: "sqrt([4, 9])", wantErr: true,
+			errMsg: "invalid function argument: sqrt of vector of 2, expected numbers"},
+		{name: "вектор в условии", input: "[1] ? 1 : 2", wantErr: true,
+			errMsg: "invalid condition: condition must be a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calculator.NewCalculator().CalculateTensor(tt.input)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CalculateTensor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if err.Error() != tt.errMsg {
+					t.Errorf("CalculateTensor() error message = %v, want %v", err.Error(), tt.errMsg)
+				}
+				return
+			}
+
+			if got.String() != tt.want {
+				t.Errorf("CalculateTensor() = %v, want %v", got.String(), tt.want)
+			}
+		})
+	}
+
+	if _, err := calculator.Calc("[1, 2]"); err == nil {
+		t.Error("Calc() для вектора не вернул ошибку")
+	}
+	if _, err := calculator.NewCalculator().CalculateDecimal("[1, 2]"); err == nil {
+		t.Error("CalculateDecimal() для вектора не вернул ошибку")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		opts      calculator.EvaluateOptions
+		wantValue float64
+		wantText  string
+		wantUnit  string
+	}{
+		{name: "float", input: "2 * x", opts: calculator.EvaluateOptions{Variables: map[string]float64{"x": 3}}, wantValue: 6},
+		{name: "decimal", input: "0.1 + 0.2", opts: calculator.EvaluateOptions{Precision: calculator.PrecisionDecimal}, wantValue: 0.3, wantText: "0.3"},
+		{name: "единицы", input: "36 km/h to m/s", wantValue: 10, wantUnit: "m/s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calculator.Evaluate(tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if math.Abs(got.Value-tt.wantValue) > 1e-9 || got.Text != tt.wantText || got.Unit != tt.wantUnit {
+				t.Errorf("Evaluate() = %+v, want %v %q %q", got, tt.wantValue, tt.wantText, tt.wantUnit)
+			}
+		})
+	}
+
+	t.Run("interval", func(t *testing.T) {
+		got, err := calculator.Evaluate("(100±1) / (20±0.5)", calculator.EvaluateOptions{Precision: calculator.PrecisionInterval})
+		if err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+		if got.Text != "[4.829268292682927, 5.17948717948718]" || got.Low == nil || got.High == nil ||
+			*got.Low != 4.829268292682927 || *got.High != 5.17948717948718 || got.Value != (*got.Low+*got.High)/2 {
+			t.Errorf("Evaluate() = %+v, want [4.829268292682927, 5.17948717948718]", got)
+		}
+	})
+
+	t.Run("вектор", func(t *testing.T) {
+		got, err := calculator.Evaluate("[1, 2] * 2", calculator.EvaluateOptions{})
+		if err != nil || got.Tensor == nil || got.Tensor.String() != "[2, 4]" {
+			t.Errorf("Evaluate() = %+v, %v, want [2, 4]", got, err)
+		}
+	})
+
+	// Ошибки выражения отличаются от ошибок параметров типом, а не текстом
+	errorTests := []struct {
+		name    string
+		input   string
+		opts    calculator.EvaluateOptions
+		syntax  bool
+		message string
+	}{
+		{name: "синтаксис", input: "2 +", syntax: true, message: "invalid expression: unexpected end of expression"},
+		{name: "деление на ноль", input: "1 / 0", message: "division by zero"},
+		{name: "режим decimal", input: "sin(1)", opts: calculator.EvaluateOptions{Precision: calculator.PrecisionDecimal}, message: "function sin is not supported in decimal mode"},
+		{name: "пустое выражение", input: "", message: "empty expression"},
+		{name: "погрешность вне режима interval", input: "5±0.2", message: `numbers with uncertainty require precision "interval"`},
+		{name: "неопределённое условие", input: "[0, 2] > 1 ? 1 : 2", opts: calculator.EvaluateOptions{Precision: calculator.PrecisionInterval}, message: "invalid condition: condition is uncertain over [0, 1]"},
+		{name: "режим interval", input: "[1, 2] @ [3, 4]", opts: calculator.EvaluateOptions{Precision: calculator.PrecisionInterval}, message: "matrix product is not supported in interval mode"},
+	}
+	for _, tt := range errorTests {
+		t.Run("ошибка "+tt.name, func(t *testing.T) {
+			_, err := calculator.Evaluate(tt.input, tt.opts)
+			if !calculator.IsEvaluationError(err) {
+				t.Fatalf("Evaluate() error = %v, want EvaluationError", err)
+			}
+			if _, ok := calculator.AsSyntaxError(err); ok != tt.syntax {
+				t.Errorf("AsSyntaxError() = %v, want %v", ok, tt.syntax)
+			}
+			if err.Error() != tt.message {
+				t.Errorf("Evaluate() error = %q, want %q", err.Error(), tt.message)
+			}
+		})
+	}
+
+	_, err := calculator.Evaluate("1", calculator.EvaluateOptions{Precision: "exact"})
+	if !errors.Is(err, calculator.ErrUnsupportedPrecision) || calculator.IsEvaluationError(err) {
+		t.Errorf("Evaluate() с неизвестным режимом: error = %v, want ErrUnsupportedPrecision", err)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		code     string
+		offset   int
+		token    string
+		expected []string
+	}{
+		{name: "некорректный символ", input: "2 + $", code: calculator.ErrCodeInvalidCharacter, offset: 4, token: "$"},
+		{name: "некорректное число", input: "1.2.3 + 4", code: calculator.ErrCodeInvalidNumber, offset: 0, token: "1.2.3"},
+		{name: "неизвестная функция", input: "1 + foo(2)", code: calculator.ErrCodeUnknownFunction, offset: 4, token: "foo"},
+		{name: "неизвестная переменная", input: "rate * x", code: calculator.ErrCodeUndefinedVariable, offset: 0, token: "rate"},
+		{
+			name:     "два оператора подряд",
+			input:    "2 * / 3",
+			code:     calculator.ErrCodeUnexpectedToken,
+			offset:   4,
+			token:    "/",
+			expected: []string{"number", "variable", "function", "(", "["},
+		},
+		{
+			name:     "два числа подряд",
+			input:    "max(1 2)",
+			code:     calculator.ErrCodeUnexpectedToken,
+			offset:   6,
+			token:    "2",
+			expected: []string{"operator", ")", ","},
+		},
+		{
+			name:     "пустые скобки",
+			input:    "2 * ()",
+			code:     calculator.ErrCodeUnexpectedToken,
+			offset:   5,
+			token:    ")",
+			expected: []string{"number", "variable", "function", "(", "["},
+		},
+		{name: "лишняя закрывающая скобка", input: "(1 + 2))", code: calculator.ErrCodeMismatchedParentheses, offset: 7, token: ")"},
+		{
+			name:     "незакрытая скобка",
+			input:    "1 + (2 * 3",
+			code:     calculator.ErrCodeMismatchedParentheses,
+			offset:   4,
+			token:    "(",
+			expected: []string{")"},
+		},
+		{name: "запятая вне вызова", input: "(1, 2)", code: calculator.ErrCodeMisplacedComma, offset: 2, token: ","},
+		{
+			name:     "условие без двоеточия",
+			input:    "(1 ? 2) + 3",
+			code:     calculator.ErrCodeMismatchedConditional,
+			offset:   3,
+			token:    "?",
+			expected: []string{":"},
+		},
+		{name: "двоеточие без условия", input: "1 + 2 : 3", code: calculator.ErrCodeMismatchedConditional, offset: 6, token: ":"},
+		{
+			name:     "отрицание после операнда",
+			input:    "5!",
+			code:     calculator.ErrCodeUnexpectedToken,
+			offset:   1,
+			token:    "!",
+			expected: []string{"operator", ")"},
+		},
+		{
+			name:     "незаконченное выражение",
+			input:    "2 * -",
+			code:     calculator.ErrCodeUnexpectedEnd,
+			offset:   5,
+			expected: []string{"number", "variable", "function", "(", "["},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := calculator.Calc(tt.input)
+
+			synErr, ok := calculator.AsSyntaxError(err)
+			if !ok {
+				t.Fatalf("Calc() error = %v, want SyntaxError", err)
+			}
+
+			if synErr.Code != tt.code || synErr.Offset != tt.offset || synErr.Token != tt.token {
+				t.Errorf("SyntaxError = {%s %d %q}, want {%s %d %q}",
+					synErr.Code, synErr.Offset, synErr.Token, tt.code, tt.offset, tt.token)
+			}
+
+			if strings.Join(synErr.Expected, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("SyntaxError.Expected = %v, want %v", synErr.Expected, tt.expected)
+			}
+		})
+	}
+
+	t.Run("указатель под позицией ошибки", func(t *testing.T) {
+		// Смещение в байтах: "√" занимает 3 байта, "$" начинается с 7-го
+		synErr := &calculator.SyntaxError{Offset: 7}
+
+		want := "√2 + $\n     ^"
+		if caret := synErr.Caret("√2 + $"); caret != want {
+			t.Errorf("Caret() = %q, want %q", caret, want)
+		}
+	})
+}
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"пробелы вокруг операторов", "2+3*4", "2 + 3 * 4"},
+		{"лишние скобки", "((2+3))+(4*5)", "2 + 3 + 4 * 5"},
+		{"нужные скобки", "(2+3)*4", "(2 + 3) * 4"},
+		{"левая ассоциативность", "8-(3-2)", "8 - (3 - 2)"},
+		{"лишние скобки слева", "(8-3)-2", "8 - 3 - 2"},
+		{"степень", "2**3**2", "2 ^ 3 ^ 2"},
+		{"скобки в степени слева", "(2^3)^2", "(2 ^ 3) ^ 2"},
+		{"унарный минус и степень", "-2^2", "-2 ^ 2"},
+		{"степень отрицательного числа", "(-2)^2", "(-2) ^ 2"},
+		{"отрицательный показатель", "2^(-1)", "2 ^ -1"},
+		{"унарный минус над суммой", "-(1+2)", "-(1 + 2)"},
+		{"унарный плюс опускается", "+(1+2)*3", "(1 + 2) * 3"},
+		{"двойной минус", "--1", "--1"},
+		{"отрицание", "!(a && b)", "!(a && b)"},
+		{"запись чисел", "0x1F + 1_000 + 1.50 + 007 + 1E3", "31 + 1000 + 1.5 + 7 + 1e3"},
+		{"единицы и перевод", "5 km/2 h TO km / h", "5 km / 2 h to km/h"},
+		{"степень числа с единицей", "(2 m)^2 + 3 m**2", "(2 m) ^ 2 + 3 m^2"},
+		{"функции", "MAX( 1 ,2,x )", "max(1, 2, x)"},
+		{"xor", "a XOR b", "a xor b"},
+		{"условный оператор", "(a>b)?(a):(c?d:e)", "a > b ? a : c ? d : e"},
+		{"вложенное условие", "(a?b:c)?d:e", "(a ? b : c) ? d : e"},
+		{"условие в операнде", "1+(a?b:c)", "1 + (a ? b : c)"},
+		{"матрица", "[[1,2],[ 3,4 ]]@v", "[[1, 2], [3, 4]] @ v"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calculator.Canonicalize(tt.input)
+			if err != nil {
+				t.Fatalf("Canonicalize(%q) error = %v", tt.input, err)
+			}
+			if got != tt.expected {
+				t.Errorf("Canonicalize(%q) = %q, ожидалось %q", tt.input, got, tt.expected)
+			}
+
+			// Каноническая форма неподвижна: повторная нормализация её не меняет
+			again, err := calculator.Canonicalize(got)
+			if err != nil || again != got {
+				t.Errorf("Canonicalize(%q) = %q, %v, ожидалось %q", got, again, err, got)
+			}
+		})
+	}
+}
+
+func TestCanonicalizePreservesValue(t *testing.T) {
+	variables := map[string]float64{"a": 3, "b": 2, "c": 0, "d": 5, "e": 7, "x": 4}
+	expressions := []string{
+		"2+3*4-5/2", "(8-3)-2", "8-(3-2)", "2**3**2", "(2^3)^2", "-2^2", "(-2)^2", "2^(-1)",
+		"+(1+2)*3", "--1", "0x1F % 3 // 2", "1 << 2 >> 1", "a > b ? a : b", "(c ? d : e) * 2",
+		"max(1, -x, a^2) - sqrt(16)", "!(a && c) || b == 2",
+	}
+
+	for _, expr := range expressions {
+		canonical, err := calculator.Canonicalize(expr)
+		if err != nil {
+			t.Fatalf("Canonicalize(%q) error = %v", expr, err)
+		}
+		want, err := calculator.CalcWithVariables(expr, variables)
+		if err != nil {
+			t.Fatalf("CalcWithVariables(%q) error = %v", expr, err)
+		}
+		got, err := calculator.CalcWithVariables(canonical, variables)
+		if err != nil || got != want {
+			t.Errorf("%q -> %q: значение %v (%v), ожидалось %v", expr, canonical, got, err, want)
+		}
+	}
+}
+
+func TestCanonicalizeInvalid(t *testing.T) {
+	if _, err := calculator.Canonicalize("2 + (3"); err == nil {
+		t.Error("Canonicalize() для некорректного выражения не вернул ошибку")
+	}
+}
+
+func TestDifferentiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		variable string
+		want     string
+	}{
+		{"многочлен", "3*x^3 - 2*x + 7", "x", "9 * x ^ 2 - 2"},
+		{"произведение", "x^2 * sin(x)", "x", "2 * x * sin(x) + x ^ 2 * cos(x)"},
+		{"частное", "1/x", "x", "-1 / x ^ 2"},
+		{"деление на константу", "x/2", "x", "1 / 2"},
+		{"сложная функция", "cos(2*x)", "x", "-2 * sin(2 * x)"},
+		{"логарифм", "log(x^2+1)", "x", "2 * x / (x ^ 2 + 1)"},
+		{"логарифм по основанию", "log(x, 2)", "x", "1 / x / log(2)"},
+		{"показательная функция", "2^x", "x", "2 ^ x * log(2)"},
+		{"степенно-показательная функция", "x^x", "x", "x ^ x * (log(x) + 1)"},
+		{"корень", "sqrt(x)", "x", "1 / (2 * sqrt(x))"},
+		{"сумма", "sum(x^2, 3*x, 5)", "x", "2 * x + 3"},
+		{"среднее", "avg(x^2, 1)", "x", "x"},
+		{"среднее линейных", "avg(x, 2)", "x", "1 / 2"},
+		{"другие имена - константы", "a*t^2 + b*t + c", "t", "a * (2 * t) + b"},
+		{"условный оператор", "x > 0 ? x^2 : -x", "x", "x > 0 ? 2 * x : -1"},
+		{"константа", "pi * 2", "x", "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calculator.Differentiate(tt.input, tt.variable)
+			if err != nil {
+				t.Fatalf("Differentiate(%q, %s) error = %v", tt.input, tt.variable, err)
+			}
+			if got != tt.want {
+				t.Errorf("Differentiate(%q, %s) = %s, ожидалось %s", tt.input, tt.variable, got, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct{ input, variable string }{
+		{"max(x, 1)", "x"},
+		{"x % 2", "x"},
+		{"x + 1", "1"},
+		{"x + 1", "x y"},
+		{"x +", "x"},
+	} {
+		if _, err := calculator.Differentiate(tt.input, tt.variable); err == nil {
+			t.Errorf("Differentiate(%q, %q) должен вернуть ошибку", tt.input, tt.variable)
+		}
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"сумма", "1+2+3+4", "1 + 2 + (3 + 4)"},
+		{"нечётное число операндов", "1*2*3*4*5", "1 * 2 * (3 * 4 * 5)"},
+		{"три операнда не перестраиваются", "1e308*10*1e-308", "1e308 * 10 * 1e-308"},
+		{"скобки в цепочке", "(1+2)+(3+(4+5))", "1 + 2 + (3 + 4 + 5)"},
+		{"вложенные цепочки", "1+2*3*4*5+6", "1 + 2 * 3 * (4 * 5) + 6"},
+		{"вычитание не перестраивается", "1-2-3-4", "1 - 2 - 3 - 4"},
+		{"граница цепочки", "1+2+3+4-5+6+7", "1 + 2 + (3 + 4) - 5 + 6 + 7"},
+		{"аргументы функций и ветки", "max(1+2+3+4, 0) ? 1||0||1||0 : [1+1+1+1, 2]", "max(1 + 2 + (3 + 4), 0) ? 1 || 0 || (1 || 0) : [1 + 1 + (1 + 1), 2]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := calculator.NewCalculator().Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.input, err)
+			}
+			rebalanced := calculator.Rebalance(node)
+			if got := calculator.Format(rebalanced); got != tt.want {
+				t.Errorf("Rebalance(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+
+			original, _ := calculator.NewCalculator().CalculateTensor(tt.input)
+			got, err := calculator.NewCalculator().CalculateTensor(calculator.Format(rebalanced))
+			if err != nil || got.String() != original.String() {
+				t.Errorf("Перестроенное выражение = %v (%v), want %v", got, err, original)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format string
+		want   string
+	}{
+		{"дробь", "((1+2)/3)*4", calculator.RenderLaTeX, `\frac{1 + 2}{3} \cdot 4`},
+		{"степень", "x^(1/2)", calculator.RenderLaTeX, `x^{\frac{1}{2}}`},
+		{"дробь в основании", "(1/2)^2", calculator.RenderLaTeX, `\left(\frac{1}{2}\right)^{2}`},
+		{"унарный минус", "(-2)^2 - -2^2", calculator.RenderLaTeX, `\left(-2\right)^{2} - \left(-2^{2}\right)`},
+		{"отрицательный вычитаемый", "2 - -1", calculator.RenderLaTeX, `2 - \left(-1\right)`},
+		{"отрицательный множитель", "2 * -3", calculator.RenderLaTeX, `2 \cdot \left(-3\right)`},
+		{"отрицательный первый множитель", "-2 * 3", calculator.RenderLaTeX, `-2 \cdot 3`},
+		{"отрицательный показатель", "2 ^ -1", calculator.RenderLaTeX, `2^{-1}`},
+		{"MathML отрицательный множитель", "2 * -x", calculator.RenderMathML,
+			`<math xmlns="http://www.w3.org/1998/Math/MathML"><mrow><mn>2</mn><mo>&#x22C5;</mo><mrow><mo>(</mo><mrow><mo>&#x2212;</mo><mi>x</mi></mrow><mo>)</mo></mrow></mrow></math>`},
+		{"функции", "sqrt(x) + abs(y) + log(8, 2) + max(1, 2)", calculator.RenderLaTeX,
+			`\sqrt{x} + \left|y\right| + \log_{2}\left(8\right) + \max\left(1, 2\right)`},
+		{"имена и константы", "pi * rate", calculator.RenderLaTeX, `\pi \cdot \mathrm{rate}`},
+		{"число с порядком", "2 * 1.5e-3", calculator.RenderLaTeX, `2 \cdot 1.5 \cdot 10^{-3}`},
+		{"сравнения и логика", "a <= b && !c", calculator.RenderLaTeX, `a \le b \land \lnot c`},
+		{"условный оператор", "a > b ? a : b", calculator.RenderLaTeX,
+			`\begin{cases} a & \text{if } a > b \\ b & \text{otherwise} \end{cases}`},
+		{"MathML дробь", "(1+2)/3", calculator.RenderMathML,
+			`<math xmlns="http://www.w3.org/1998/Math/MathML"><mfrac><mrow><mn>1</mn><mo>+</mo><mn>2</mn></mrow><mn>3</mn></mfrac></math>`},
+		{"MathML степень и корень", "sqrt(x^2)", calculator.RenderMathML,
+			`<math xmlns="http://www.w3.org/1998/Math/MathML"><msqrt><msup><mi>x</mi><mn>2</mn></msup></msqrt></math>`},
+		{"MathML экранирование", "a < b", calculator.RenderMathML,
+			`<math xmlns="http://www.w3.org/1998/Math/MathML"><mrow><mi>a</mi><mo>&lt;</mo><mi>b</mi></mrow></math>`},
+		{"единицы измерения", "3 m^2 to cm^2", calculator.RenderLaTeX, `3\,\mathrm{m}^{2} \to \mathrm{cm}^{2}`},
+		{"матрица и транспонирование", "transpose([[1, 2], [3, 4]]) @ v", calculator.RenderLaTeX,
+			`\begin{pmatrix} 1 & 2 \\ 3 & 4 \end{pmatrix}^{\mathsf{T}} \mathbin{@} v`},
+		{"MathML вектор", "[1, x]", calculator.RenderMathML,
+			`<math xmlns="http://www.w3.org/1998/Math/MathML"><mrow><mo>(</mo><mtable><mtr><mtd><mn>1</mn></mtd><mtd><mi>x</mi></mtd></mtr></mtable><mo>)</mo></mrow></math>`},
+		{"MathML функция", "sin(x)", calculator.RenderMathML,
+			`<math xmlns="http://www.w3.org/1998/Math/MathML"><mrow><mi>sin</mi><mo>&#x2061;</mo><mrow><mo>(</mo><mi>x</mi><mo>)</mo></mrow></mrow></math>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calculator.Render(tt.input, tt.format)
+			if err != nil {
+				t.Fatalf("Render(%q, %s) error = %v", tt.input, tt.format, err)
+			}
+			if got != tt.want {
+				t.Errorf("Render(%q, %s) = %s, ожидалось %s", tt.input, tt.format, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := calculator.Render("1+2", "svg"); err == nil {
+		t.Error("Render() с неподдерживаемым форматом не вернул ошибку")
+	}
+	if _, err := calculator.Render("1+", calculator.RenderLaTeX); err == nil {
+		t.Error("Render() некорректного выражения не вернул ошибку")
+	}
+}
+
+func TestLocale(t *testing.T) {
+	normalizeTests := []struct {
+		locale string
+		input  string
+		want   string
+	}{
+		{locale: "en", input: "3.14 + max(1,234)", want: "3.14 + max(1,234)"},
+		{locale: "ru", input: "3,14 * 2", want: "3.14 * 2"},
+		{locale: "ru", input: "1 000 000,5 - 1", want: "1_000_000.5 - 1"},
+		{locale: "ru", input: "max(1,5; 2) + min(3, 4)", want: "max(1.5, 2) + min(3, 4)"},
+		{locale: "ru", input: "0x1F + x1,5", want: "0x1F + x1,5"},
+		{locale: "ru", input: "2 10", want: "2 10"},
+		{locale: "de", input: "1.234,5 + 0,5", want: "1_234.5 + 0.5"},
+		{locale: "de", input: "1.500", want: "1_500"},
+		{locale: "de", input: "1.500.000,25", want: "1_500_000.25"},
+		{locale: "ru", input: "[1,5; 2,5]", want: "[1.5, 2.5]"},
+		{locale: "ru", input: "sqrt((2,25)) * 2,5", want: "sqrt((2.25)) * 2.5"},
+	}
+	for _, tt := range normalizeTests {
+		t.Run("normalize "+tt.locale+" "+tt.input, func(t *testing.T) {
+			locale, ok := calculator.LookupLocale(tt.locale)
+			if !ok {
+				t.Fatalf("LookupLocale(%q) не нашёл локаль", tt.locale)
+			}
+			got, err := locale.Normalize(tt.input)
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Запятая между цифрами в списке аргументов без ";" может быть и десятичной,
+	// и разделителем: "max(1,2)" не должно молча стать "max(1.2)"
+	// Точка в локали с десятичной запятой допустима только перед группой из трёх цифр в de:
+	// иначе "1.50" молча стало бы 1.5, а "1.500" - 1500
+	ambiguousTests := []struct {
+		locale string
+		input  string
+		code   string
+		offset int
+	}{
+		{locale: "ru", input: "max(1,2)", code: calculator.ErrCodeMisplacedComma, offset: 5},
+		{locale: "de", input: "min (3, 4,5)", code: calculator.ErrCodeMisplacedComma, offset: 9},
+		{locale: "ru", input: "[1,5, 2]", code: calculator.ErrCodeMisplacedComma, offset: 2},
+		{locale: "ru", input: "max(sqrt(2,25); 1)", code: calculator.ErrCodeMisplacedComma, offset: 10},
+		{locale: "de", input: "1.50", code: calculator.ErrCodeInvalidNumber, offset: 1},
+		{locale: "de", input: "1.5", code: calculator.ErrCodeInvalidNumber, offset: 1},
+		{locale: "de", input: "2 * 1.5", code: calculator.ErrCodeInvalidNumber, offset: 5},
+		{locale: "de", input: "1.234,5.6", code: calculator.ErrCodeInvalidNumber, offset: 7},
+		{locale: "ru", input: "1.50", code: calculator.ErrCodeInvalidNumber, offset: 1},
+		{locale: "ru", input: "1.5", code: calculator.ErrCodeInvalidNumber, offset: 1},
+		{locale: "ru", input: "1.500", code: calculator.ErrCodeInvalidNumber, offset: 1},
+		{locale: "ru", input: "x + .5", code: calculator.ErrCodeInvalidNumber, offset: 4},
+	}
+	for _, tt := range ambiguousTests {
+		t.Run("ambiguous "+tt.locale+" "+tt.input, func(t *testing.T) {
+			locale, _ := calculator.LookupLocale(tt.locale)
+			_, err := locale.Normalize(tt.input)
+			synErr, ok := calculator.AsSyntaxError(err)
+			if !ok {
+				t.Fatalf("Normalize() error = %v, want SyntaxError", err)
+			}
+			if synErr.Code != tt.code || synErr.Offset != tt.offset {
+				t.Errorf("Normalize() error = %+v, want code %s at %d", synErr, tt.code, tt.offset)
+			}
+		})
+	}
+
+	formatTests := []struct {
+		locale string
+		input  string
+		want   string
+	}{
+		{locale: "en", input: "1234567.25", want: "1,234,567.25"},
+		{locale: "ru", input: "1234567.25", want: "1 234 567,25"},
+		{locale: "de", input: "-1234.5", want: "-1.234,5"},
+		{locale: "ru", input: "[1.5, 2.5]", want: "[1,5; 2,5]"},
+		{locale: "ru", input: "1e+21", want: "1e+21"},
+		{locale: "de", input: "1/3", want: "1/3"},
+	}
+	for _, tt := range formatTests {
+		t.Run("format "+tt.locale+" "+tt.input, func(t *testing.T) {
+			locale, _ := calculator.LookupLocale(tt.locale)
+			if got := locale.Format(tt.input); got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Приближённый результат записывается без порядка, чтобы разряды группировались
+	resultTests := []struct {
+		locale string
+		value  float64
+		want   string
+	}{
+		{locale: "ru", value: 1234567.891, want: "1 234 567,891"},
+		{locale: "de", value: -2e6, want: "-2.000.000"},
+		{locale: "ru", value: 0.00025, want: "0,00025"},
+		{locale: "ru", value: 1e21, want: "1e+21"},
+		{locale: "ru", value: 1.5e-7, want: "1,5e-07"},
+	}
+	for _, tt := range resultTests {
+		t.Run("format result "+tt.locale+" "+tt.want, func(t *testing.T) {
+			locale, _ := calculator.LookupLocale(tt.locale)
+			if got := locale.FormatResult(tt.value, "", nil); got != tt.want {
+				t.Errorf("FormatResult(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("вычисление в локали ru", func(t *testing.T) {
+		locale, _ := calculator.LookupLocale("ru")
+		expr, err := locale.Normalize("3,14 * 2")
+		if err != nil {
+			t.Fatalf("Normalize() error = %v", err)
+		}
+		got, err := calculator.NewCalculator().Calculate(expr)
+		if err != nil {
+			t.Fatalf("Calculate() error = %v", err)
+		}
+		if math.Abs(got-6.28) > 1e-9 {
+			t.Errorf("Calculate() = %v, want 6.28", got)
+		}
+	})
+
+	if _, ok := calculator.LookupLocale("xx"); ok {
+		t.Errorf("LookupLocale(\"xx\") должен вернуть ошибку")
+	}
+	if got := calculator.LocaleFor("ru", nil).Name; got != "ru" {
+		t.Errorf("LocaleFor(\"ru\", nil) = %q, want \"ru\"", got)
+	}
+	if got := calculator.LocaleFor("", errors.New("нет соединения с БД")).Name; got != calculator.DefaultLocale {
+		t.Errorf("LocaleFor() при ошибке = %q, want %q", got, calculator.DefaultLocale)
+	}
+	if got := calculator.LocaleFor("xx", nil).Name; got != calculator.DefaultLocale {
+		t.Errorf("LocaleFor(\"xx\", nil) = %q, want %q", got, calculator.DefaultLocale)
+	}
+	if locale, ok := calculator.LookupLocale(""); !ok || locale.Name != calculator.DefaultLocale {
+		t.Errorf("LookupLocale(\"\") = %v, want локаль по умолчанию", locale.Name)
+	}
+}
@@ -45,6 +45,18 @@ func TestExpressionSerialization(t *testing.T) {
 			},
 			expected: `{"id":"test-3","expression":"2-2","status":"COMPLETED","result":0,"created_at":"01.01.2024 12:00:00"}`,
 		},
+		{
+			name: "с привязками переменных",
+			expr: types.Expression{
+				ID:        "test-5",
+				Original:  "rate * principal",
+				Variables: map[string]float64{"principal": 1000, "rate": 0.05},
+				Status:    "COMPLETED",
+				Result:    50.0,
+				CreatedAt: "01.01.2024 12:00:00",
+			},
+			expected: `{"id":"test-5","expression":"rate * principal","variables":{"principal":1000,"rate":0.05},"status":"COMPLETED","result":50,"created_at":"01.01.2024 12:00:00"}`,
+		},
 		{
 			name: "в процессе обработки",
 			expr: types.Expression{
@@ -26,6 +26,11 @@ func TestRPN(t *testing.T) {
 			input:    "0 + 6 - 1 + (2*100)",
 			expected: "0 6 + 1 - 2 100 * +",
 		},
+		{
+			name:     "литералы приводятся к десятичной записи",
+			input:    "1_000 + 0x10 * 0b11",
+			expected: "1000 16 3 * +",
+		},
 	}
 
 	for _, tt := range tests {